@@ -0,0 +1,17 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0002_add_document_version"
+down_revision = "0001_create_docs_user_schema"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    # version of the S3 snapshot; the live version is this plus the pending operations
+    op.add_column(
+        "Documents",
+        sa.Column("version", sa.Integer, nullable=False, server_default=sa.text("0")),
+    )
+
+def downgrade():
+    op.drop_column("Documents", "version")
@@ -0,0 +1,37 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0003_create_auth_tables"
+down_revision = "0002_add_document_version"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    op.create_table(
+        "UserCredentials",
+        sa.Column("user_id", sa.Integer, sa.ForeignKey("Users.id", ondelete="CASCADE"), primary_key=True),
+        sa.Column("password_hash", sa.String(255), nullable=False),
+        sa.Column("created_at", sa.TIMESTAMP, nullable=False, server_default=sa.text('CURRENT_TIMESTAMP')),
+        sa.Column("updated_at", sa.TIMESTAMP, nullable=False, server_default=sa.text('CURRENT_TIMESTAMP')),
+    )
+
+    op.create_table(
+        "Sessions",
+        sa.Column("id", sa.String(64), primary_key=True),
+        sa.Column("user_id", sa.Integer, sa.ForeignKey("Users.id", ondelete="CASCADE"), nullable=False),
+        sa.Column("created_at", sa.TIMESTAMP, nullable=False, server_default=sa.text('CURRENT_TIMESTAMP')),
+        sa.Column("expires_at", sa.TIMESTAMP, nullable=False),
+        sa.Column("revoked_at", sa.TIMESTAMP, nullable=True),
+    )
+    op.create_index("ix_sessions_user_id", "Sessions", ["user_id"])
+
+    op.execute("""
+        CREATE TRIGGER update_credentials_updated_at BEFORE UPDATE ON "UserCredentials"
+            FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+    """)
+
+def downgrade():
+    op.execute("DROP TRIGGER IF EXISTS update_credentials_updated_at ON \"UserCredentials\"")
+    op.drop_index("ix_sessions_user_id", table_name="Sessions")
+    op.drop_table("Sessions")
+    op.drop_table("UserCredentials")
@@ -0,0 +1,40 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0004_document_ownership_transfer"
+down_revision = "0003_create_auth_tables"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    # Deleting a user must not silently delete the documents they own
+    op.drop_constraint("Documents_user_id_fkey", "Documents", type_="foreignkey")
+    op.create_foreign_key(
+        "Documents_user_id_fkey", "Documents", "Users",
+        ["user_id"], ["id"], ondelete="RESTRICT",
+    )
+
+    # Keep the owner's permission row in place when ownership changes hands
+    op.execute("""
+        DROP TRIGGER IF EXISTS trg_ensure_owner_permission ON "Documents";
+
+        CREATE TRIGGER trg_ensure_owner_permission
+            AFTER INSERT OR UPDATE OF user_id ON "Documents"
+            FOR EACH ROW
+            EXECUTE FUNCTION ensure_owner_permission();
+    """)
+
+def downgrade():
+    op.execute("""
+        DROP TRIGGER IF EXISTS trg_ensure_owner_permission ON "Documents";
+
+        CREATE TRIGGER trg_ensure_owner_permission
+            AFTER INSERT ON "Documents"
+            FOR EACH ROW
+            EXECUTE FUNCTION ensure_owner_permission();
+    """)
+    op.drop_constraint("Documents_user_id_fkey", "Documents", type_="foreignkey")
+    op.create_foreign_key(
+        "Documents_user_id_fkey", "Documents", "Users",
+        ["user_id"], ["id"], ondelete="CASCADE",
+    )
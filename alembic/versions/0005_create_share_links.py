@@ -0,0 +1,27 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0005_create_share_links"
+down_revision = "0004_document_ownership_transfer"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    op.create_table(
+        "ShareLinks",
+        sa.Column("id", sa.Integer, primary_key=True, autoincrement=True),
+        sa.Column("document_id", sa.Integer, sa.ForeignKey("Documents.id", ondelete="CASCADE"), nullable=False),
+        # Only the SHA-256 of the token is stored; the token itself is shown once on creation
+        sa.Column("token_hash", sa.String(64), nullable=False, unique=True),
+        sa.Column("permission", sa.String(16), nullable=False),
+        sa.Column("created_by", sa.Integer, sa.ForeignKey("Users.id", ondelete="SET NULL"), nullable=True),
+        sa.Column("created_at", sa.TIMESTAMP, nullable=False, server_default=sa.text('CURRENT_TIMESTAMP')),
+        sa.Column("expires_at", sa.TIMESTAMP, nullable=True),
+        sa.Column("revoked_at", sa.TIMESTAMP, nullable=True),
+        sa.CheckConstraint("permission IN ('view-only', 'comment', 'edit')", name="ck_share_links_permission"),
+    )
+    op.create_index("ix_share_links_document_id", "ShareLinks", ["document_id"])
+
+def downgrade():
+    op.drop_index("ix_share_links_document_id", table_name="ShareLinks")
+    op.drop_table("ShareLinks")
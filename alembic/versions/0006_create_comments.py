@@ -0,0 +1,59 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0006_create_comments"
+down_revision = "0005_create_share_links"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    # New enum values cannot be used in the transaction that adds them
+    with op.get_context().autocommit_block():
+        op.execute("ALTER TYPE permission_type ADD VALUE IF NOT EXISTS 'comment'")
+
+    op.create_table(
+        "Comments",
+        sa.Column("id", sa.Integer, primary_key=True, autoincrement=True),
+        sa.Column("document_id", sa.Integer, sa.ForeignKey("Documents.id", ondelete="CASCADE"), nullable=False),
+        # Replies point at the thread's root comment; only roots carry an anchor
+        sa.Column("parent_id", sa.Integer, sa.ForeignKey("Comments.id", ondelete="CASCADE"), nullable=True),
+        sa.Column("user_id", sa.Integer, sa.ForeignKey("Users.id", ondelete="SET NULL"), nullable=True),
+        sa.Column("body", sa.Text, nullable=False),
+        sa.Column("anchor_start", sa.Integer, nullable=True),
+        sa.Column("anchor_end", sa.Integer, nullable=True),
+        sa.Column("quoted_text", sa.Text, nullable=True),
+        sa.Column("resolved_at", sa.TIMESTAMP, nullable=True),
+        sa.Column("resolved_by", sa.Integer, sa.ForeignKey("Users.id", ondelete="SET NULL"), nullable=True),
+        sa.Column("created_at", sa.TIMESTAMP, nullable=False, server_default=sa.text('CURRENT_TIMESTAMP')),
+        sa.Column("updated_at", sa.TIMESTAMP, nullable=False, server_default=sa.text('CURRENT_TIMESTAMP')),
+        sa.CheckConstraint(
+            "(parent_id IS NULL AND anchor_start IS NOT NULL AND anchor_end IS NOT NULL "
+            "AND 0 <= anchor_start AND anchor_start <= anchor_end) "
+            "OR (parent_id IS NOT NULL AND anchor_start IS NULL AND anchor_end IS NULL)",
+            name="ck_comments_anchor",
+        ),
+    )
+    op.create_index("ix_comments_document_id", "Comments", ["document_id"])
+    op.create_index("ix_comments_parent_id", "Comments", ["parent_id"])
+
+    op.execute("""
+        CREATE TRIGGER update_comments_updated_at BEFORE UPDATE ON "Comments"
+            FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+    """)
+
+def downgrade():
+    op.execute("DROP TRIGGER IF EXISTS update_comments_updated_at ON \"Comments\"")
+    op.drop_index("ix_comments_parent_id", table_name="Comments")
+    op.drop_index("ix_comments_document_id", table_name="Comments")
+    op.drop_table("Comments")
+
+    # Postgres cannot drop an enum value, so rebuild the type without it
+    op.execute("""
+        UPDATE "DocumentPermissions" SET permission = 'view-only' WHERE permission = 'comment';
+
+        ALTER TYPE permission_type RENAME TO permission_type_old;
+        CREATE TYPE permission_type AS ENUM ('edit', 'view-only');
+        ALTER TABLE "DocumentPermissions"
+            ALTER COLUMN permission TYPE permission_type USING permission::text::permission_type;
+        DROP TYPE permission_type_old;
+    """)
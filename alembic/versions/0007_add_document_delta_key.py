@@ -0,0 +1,14 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0007_add_document_delta_key"
+down_revision = "0006_create_comments"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    # S3 key of the rich-text snapshot (JSON delta) stored alongside the plain text at s3_key
+    op.add_column("Documents", sa.Column("delta_key", sa.String(255), nullable=True))
+
+def downgrade():
+    op.drop_column("Documents", "delta_key")
@@ -0,0 +1,22 @@
+from alembic import op
+import sqlalchemy as sa
+
+revision = "0008_add_snapshot_hashes"
+down_revision = "0007_add_document_delta_key"
+branch_labels = None
+depends_on = None
+
+def upgrade():
+    # Hex SHA-256 of the uncompressed snapshots at s3_key and delta_key, checked on download.
+    # Snapshots written before this migration have no hash and are not verified.
+    op.add_column("Documents", sa.Column("content_sha256", sa.CHAR(64), nullable=True))
+    op.add_column("Documents", sa.Column("delta_sha256", sa.CHAR(64), nullable=True))
+    # Snapshots are shared by documents with identical content; deletes check for other references
+    op.create_index("ix_documents_s3_key", "Documents", ["s3_key"])
+    op.create_index("ix_documents_delta_key", "Documents", ["delta_key"])
+
+def downgrade():
+    op.drop_index("ix_documents_delta_key", table_name="Documents")
+    op.drop_index("ix_documents_s3_key", table_name="Documents")
+    op.drop_column("Documents", "delta_sha256")
+    op.drop_column("Documents", "content_sha256")
@@ -0,0 +1,230 @@
+package db
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Document listing filters
+const (
+	FilterAll       = "all"
+	FilterOwned     = "owned"
+	FilterShared    = "shared"
+	FilterTemplates = "templates"
+)
+
+// documentSortColumns maps the API sort keys onto Documents columns
+var documentSortColumns = map[string]string{
+	"updated_at": "d.updated_at",
+	"created_at": "d.created_at",
+	"title":      "d.title",
+}
+
+// trashSortColumns maps the API sort keys onto Documents columns
+var trashSortColumns = map[string]string{
+	"deleted_at": "deleted_at",
+	"title":      "title",
+}
+
+// userSortColumns maps the API sort keys onto Users columns
+var userSortColumns = map[string]string{
+	"updated_at": "updated_at",
+	"created_at": "created_at",
+	"name":       "name",
+}
+
+// Page is the ordering and keyset position shared by listings
+type Page struct {
+	Sort  string
+	Desc  bool
+	Limit int
+
+	// Keyset cursor: the sort value and id of the last row of the previous page
+	AfterValue interface{}
+	AfterID    int
+	HasCursor  bool
+}
+
+// DocumentListOptions selects, orders and pages the documents visible to a user
+type DocumentListOptions struct {
+	Page
+	Filter      string // FilterAll, FilterOwned, FilterShared or FilterTemplates
+	TitlePrefix string // case-insensitive title prefix, empty for all
+}
+
+// TrashListOptions orders and pages the documents in a user's trash
+type TrashListOptions struct {
+	Page
+}
+
+// UserListOptions selects, orders and pages users
+type UserListOptions struct {
+	Page
+	Prefix string // case-insensitive prefix of the name or email, empty for all
+}
+
+// sharedDocumentsCTE lists the documents shared with the user in $1, directly
+// or through any folder above them, as shared_documents(document_id,
+// permission) with the highest permission the user holds on each. It is the
+// set-based form of GetDocumentAccessQuery and follows a WITH RECURSIVE.
+const sharedDocumentsCTE = `
+	shared_folders AS (
+		SELECT fp.folder_id AS id, fp.permission 
+		FROM "FolderPermissions" fp 
+		WHERE fp.user_id = $1
+		UNION
+		SELECT f.id, s.permission 
+		FROM "Folders" f 
+		JOIN shared_folders s ON f.parent_id = s.id
+	),
+	shared_documents AS (
+		SELECT DISTINCT ON (document_id) document_id, permission::text AS permission 
+		FROM (
+			SELECT dp.document_id, dp.permission 
+			FROM "DocumentPermissions" dp 
+			WHERE dp.user_id = $1
+			UNION ALL
+			SELECT d.id, s.permission 
+			FROM "Documents" d 
+			JOIN shared_folders s ON s.id = d.folder_id
+		) grants 
+		ORDER BY document_id, CASE permission::text WHEN 'edit' THEN 3 WHEN 'comment' THEN 2 WHEN 'view-only' THEN 1 ELSE 0 END DESC
+	)`
+
+// ListAccessibleDocumentsQuery builds the query for documents a user owns or has
+// been shared, directly or through a folder, along with the caller's highest
+// permission level. The user ID is always $1.
+func ListAccessibleDocumentsQuery(userID int, opts DocumentListOptions) (string, []interface{}) {
+	args := []interface{}{userID}
+	where := []string{"(d.user_id = $1 OR sd.document_id IS NOT NULL)", "d.deleted_at IS NULL"}
+
+	switch opts.Filter {
+	case FilterOwned:
+		where = append(where, "d.user_id = $1")
+	case FilterShared:
+		where = append(where, "d.user_id <> $1")
+	case FilterTemplates:
+		where = append(where, "d.is_template")
+	}
+
+	if opts.TitlePrefix != "" {
+		args = append(args, likePrefix(opts.TitlePrefix))
+		where = append(where, fmt.Sprintf("d.title ILIKE $%d", len(args)))
+	}
+
+	column := documentSortColumns[opts.Sort]
+	if column == "" {
+		column = documentSortColumns["updated_at"]
+	}
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+	if opts.HasCursor {
+		var condition string
+		condition, args = keysetCondition(column, "d.id", column != "d.title", opts.Page, args)
+		where = append(where, condition)
+	}
+
+	args = append(args, opts.Limit)
+	query := fmt.Sprintf(`
+		WITH RECURSIVE %s
+		SELECT d.id, d.user_id, d.folder_id, d.title, d.is_template, d.created_at, d.updated_at,
+			d.version + json_array_length(d.operations) AS version,
+			CASE WHEN d.user_id = $1 THEN 'owner' ELSE sd.permission END AS permission
+		FROM "Documents" d
+		LEFT JOIN shared_documents sd ON sd.document_id = d.id
+		WHERE %s
+		ORDER BY %s %s, d.id %s
+		LIMIT $%d`,
+		sharedDocumentsCTE, strings.Join(where, " AND "), column, direction, direction, len(args))
+
+	return query, args
+}
+
+// ListTrashQuery builds the query for a page of the documents a user owns that
+// are in the trash. The user ID is always $1.
+func ListTrashQuery(userID int, opts TrashListOptions) (string, []interface{}) {
+	args := []interface{}{userID}
+	where := []string{"user_id = $1", "deleted_at IS NOT NULL"}
+
+	column := trashSortColumns[opts.Sort]
+	if column == "" {
+		column = trashSortColumns["deleted_at"]
+	}
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+	if opts.HasCursor {
+		var condition string
+		condition, args = keysetCondition(column, "id", column != "title", opts.Page, args)
+		where = append(where, condition)
+	}
+
+	args = append(args, opts.Limit)
+	query := fmt.Sprintf(`
+		SELECT id, user_id, folder_id, title, is_template, created_at, updated_at, deleted_at
+		FROM "Documents"
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT $%d`,
+		strings.Join(where, " AND "), column, direction, direction, len(args))
+
+	return query, args
+}
+
+// ListUsersQuery builds the query for a page of users
+func ListUsersQuery(opts UserListOptions) (string, []interface{}) {
+	args := []interface{}{}
+	where := []string{"TRUE"}
+
+	if opts.Prefix != "" {
+		args = append(args, likePrefix(opts.Prefix))
+		where = append(where, fmt.Sprintf("(name ILIKE $%d OR email ILIKE $%d)", len(args), len(args)))
+	}
+
+	column := userSortColumns[opts.Sort]
+	if column == "" {
+		column = userSortColumns["created_at"]
+	}
+	direction := "ASC"
+	if opts.Desc {
+		direction = "DESC"
+	}
+	if opts.HasCursor {
+		var condition string
+		condition, args = keysetCondition(column, "id", column != "name", opts.Page, args)
+		where = append(where, condition)
+	}
+
+	args = append(args, opts.Limit)
+	query := fmt.Sprintf(`
+		SELECT id, name, email, created_at, updated_at
+		FROM "Users"
+		WHERE %s
+		ORDER BY %s %s, id %s
+		LIMIT $%d`,
+		strings.Join(where, " AND "), column, direction, direction, len(args))
+
+	return query, args
+}
+
+// keysetCondition restricts a listing to the rows after the page cursor
+func keysetCondition(column, idColumn string, timestamp bool, page Page, args []interface{}) (string, []interface{}) {
+	comparison := ">"
+	if page.Desc {
+		comparison = "<"
+	}
+	cast := ""
+	if timestamp {
+		cast = "::timestamp"
+	}
+	args = append(args, page.AfterValue, page.AfterID)
+	return fmt.Sprintf("(%s, %s) %s ($%d%s, $%d)", column, idColumn, comparison, len(args)-1, cast, len(args)), args
+}
+
+// likePrefix turns user input into an ILIKE prefix pattern, escaping wildcards
+func likePrefix(prefix string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix) + "%"
+}
@@ -0,0 +1,302 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migrations are numbered SQL files, NNNN_name.up.sql and NNNN_name.down.sql,
+// embedded in the binary. 0001-0008 match the alembic revisions they replace;
+// alembic is frozen there.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var migrationFileName = regexp.MustCompile(`^(\d{4})_(\w+)\.(up|down)\.sql$`)
+
+// migrationLockKey serializes migration runs across processes (pg_advisory_lock)
+const migrationLockKey = 7_302_114
+
+// ErrSchemaOutdated is returned by Migrator.Check when the database has not
+// been migrated to the version this build expects
+var ErrSchemaOutdated = errors.New("database schema is out of date")
+
+// Migration is one schema change with the SQL to apply and revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// MigrationStatus reports whether a migration has been applied
+type MigrationStatus struct {
+	Migration
+	Applied bool
+}
+
+// Migrations returns the embedded migrations in version order
+func Migrations() ([]Migration, error) {
+	entries, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int]*Migration{}
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("unexpected migration file %q", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		body, err := migrationFiles.ReadFile("migrations/" + entry.Name())
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[1] + "_" + match[2]}
+			byVersion[version] = migration
+		} else if migration.Name != match[1]+"_"+match[2] {
+			return nil, fmt.Errorf("migration %d has two names: %s and %s_%s", version, migration.Name, match[1], match[2])
+		}
+		if match[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %s needs both an up and a down file", migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return nil, fmt.Errorf("migration versions must be consecutive from 1, found %s", migration.Name)
+		}
+	}
+	return migrations, nil
+}
+
+// rowQuerier is implemented by *sql.DB and *sql.Conn
+type rowQuerier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// Migrator applies the embedded migrations and records them in schema_migrations
+type Migrator struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// NewMigrator creates a migrator for the database
+func NewMigrator(conn *sql.DB) (*Migrator, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, fmt.Errorf("invalid embedded migrations: %w", err)
+	}
+	return &Migrator{db: conn, migrations: migrations}, nil
+}
+
+// Latest is the version the embedded migrations bring the schema to
+func (m *Migrator) Latest() int {
+	return len(m.migrations)
+}
+
+// Version returns the current schema version without changing anything.
+// Databases still managed by alembic report the version of their revision.
+func (m *Migrator) Version(ctx context.Context) (int, error) {
+	var tracked bool
+	err := m.db.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&tracked)
+	if err != nil {
+		return 0, err
+	}
+	if tracked {
+		var version int
+		err := m.db.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version)
+		return version, err
+	}
+	return m.alembicVersion(ctx, m.db)
+}
+
+// Check refuses to run against a schema older than this build expects. A newer
+// schema is accepted, since migrations only add what older builds ignore.
+func (m *Migrator) Check(ctx context.Context) error {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to read schema version: %w", err)
+	}
+	if version < m.Latest() {
+		return fmt.Errorf("%w: at version %d, this build needs %d; run \"migrate up\"", ErrSchemaOutdated, version, m.Latest())
+	}
+	return nil
+}
+
+// Status lists every embedded migration and whether it has been applied
+func (m *Migrator) Status(ctx context.Context) ([]MigrationStatus, error) {
+	version, err := m.Version(ctx)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]MigrationStatus, len(m.migrations))
+	for i, migration := range m.migrations {
+		statuses[i] = MigrationStatus{Migration: migration, Applied: migration.Version <= version}
+	}
+	return statuses, nil
+}
+
+// Up applies every pending migration, each in its own transaction, and
+// returns the ones it applied
+func (m *Migrator) Up(ctx context.Context) ([]Migration, error) {
+	var applied []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, version int) error {
+		for _, migration := range m.migrations[version:] {
+			if err := m.run(ctx, conn, migration.Up,
+				`INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name); err != nil {
+				return fmt.Errorf("migration %s failed: %w", migration.Name, err)
+			}
+			applied = append(applied, migration)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// Down reverts the latest steps migrations, newest first, and returns the ones
+// it reverted
+func (m *Migrator) Down(ctx context.Context, steps int) ([]Migration, error) {
+	var reverted []Migration
+	err := m.locked(ctx, func(conn *sql.Conn, version int) error {
+		if version > m.Latest() {
+			return fmt.Errorf("database is at version %d, newer than this build (%d)", version, m.Latest())
+		}
+		for i := version - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := m.migrations[i]
+			if err := m.run(ctx, conn, migration.Down,
+				`DELETE FROM schema_migrations WHERE version = $1`, migration.Version); err != nil {
+				return fmt.Errorf("reverting %s failed: %w", migration.Name, err)
+			}
+			reverted = append(reverted, migration)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// locked runs fn on one connection holding the migration lock, after making
+// sure schema_migrations exists, and passes it the current version
+func (m *Migrator) locked(ctx context.Context, fn func(conn *sql.Conn, version int) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, migrationLockKey); err != nil {
+		return fmt.Errorf("failed to take the migration lock: %w", err)
+	}
+	defer conn.ExecContext(context.WithoutCancel(ctx), `SELECT pg_advisory_unlock($1)`, migrationLockKey)
+
+	if err := m.ensureTable(ctx, conn); err != nil {
+		return err
+	}
+	var version int
+	if err := conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_migrations`).Scan(&version); err != nil {
+		return err
+	}
+	return fn(conn, version)
+}
+
+// ensureTable creates schema_migrations. A database previously migrated with
+// alembic is adopted by recording the migrations its revision covers.
+func (m *Migrator) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	var tracked bool
+	err := conn.QueryRowContext(ctx, `SELECT to_regclass('schema_migrations') IS NOT NULL`).Scan(&tracked)
+	if err != nil || tracked {
+		return err
+	}
+
+	adopted, err := m.alembicVersion(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		CREATE TABLE schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`)
+	if err != nil {
+		return fmt.Errorf("failed to create schema_migrations: %w", err)
+	}
+	for _, migration := range m.migrations[:adopted] {
+		_, err := tx.ExecContext(ctx, `INSERT INTO schema_migrations (version, name) VALUES ($1, $2)`, migration.Version, migration.Name)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// alembicVersion maps the revision in alembic_version onto a migration
+// version, or 0 if alembic never ran
+func (m *Migrator) alembicVersion(ctx context.Context, q rowQuerier) (int, error) {
+	var exists bool
+	err := q.QueryRowContext(ctx, `SELECT to_regclass('alembic_version') IS NOT NULL`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+
+	var revision string
+	err = q.QueryRowContext(ctx, `SELECT version_num FROM alembic_version`).Scan(&revision)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	for _, migration := range m.migrations {
+		if migration.Name == strings.TrimSpace(revision) {
+			return migration.Version, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown alembic revision %q", revision)
+}
+
+// run executes a migration script and its bookkeeping statement in one transaction
+func (m *Migrator) run(ctx context.Context, conn *sql.Conn, script, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,12 @@
+DROP TRIGGER IF EXISTS trg_ensure_owner_permission ON "Documents";
+DROP TRIGGER IF EXISTS update_users_updated_at ON "Users";
+DROP TRIGGER IF EXISTS update_documents_updated_at ON "Documents";
+DROP TRIGGER IF EXISTS update_permissions_updated_at ON "DocumentPermissions";
+DROP FUNCTION IF EXISTS ensure_owner_permission();
+DROP FUNCTION IF EXISTS update_updated_at_column();
+DROP TABLE "DocumentPermissions";
+DROP TABLE "Operations";
+DROP TABLE "Documents";
+DROP TABLE "Users";
+DROP TYPE IF EXISTS operation_type;
+DROP TYPE IF EXISTS permission_type;
@@ -0,0 +1,77 @@
+CREATE TYPE operation_type AS ENUM ('insert', 'delete');
+CREATE TYPE permission_type AS ENUM ('edit', 'view-only');
+
+CREATE TABLE "Users" (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    email VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE "Documents" (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "Users" (id) ON DELETE CASCADE,
+    title VARCHAR(255) NOT NULL,
+    operations JSON NOT NULL DEFAULT '[]',
+    s3_key VARCHAR(255),
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE "Operations" (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES "Documents" (id) ON DELETE CASCADE,
+    type operation_type NOT NULL,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    length INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT operations_validity CHECK (
+        (type = 'insert' AND text <> '' AND length = 0) OR
+        (type = 'delete' AND text = '' AND length > 0)
+    )
+);
+
+CREATE TABLE "DocumentPermissions" (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES "Documents" (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES "Users" (id) ON DELETE CASCADE,
+    permission permission_type NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_document_user UNIQUE (document_id, user_id)
+);
+
+CREATE OR REPLACE FUNCTION update_updated_at_column()
+RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at = CURRENT_TIMESTAMP;
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER update_users_updated_at BEFORE UPDATE ON "Users"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_documents_updated_at BEFORE UPDATE ON "Documents"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE TRIGGER update_permissions_updated_at BEFORE UPDATE ON "DocumentPermissions"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+CREATE OR REPLACE FUNCTION ensure_owner_permission()
+RETURNS TRIGGER AS $$
+BEGIN
+    INSERT INTO "DocumentPermissions"(document_id, user_id, permission)
+    VALUES (NEW.id, NEW.user_id, 'edit')
+    ON CONFLICT (document_id, user_id) DO UPDATE
+    SET permission = 'edit';
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_ensure_owner_permission
+    AFTER INSERT ON "Documents"
+    FOR EACH ROW
+    EXECUTE FUNCTION ensure_owner_permission();
@@ -0,0 +1,2 @@
+-- Version of the S3 snapshot; the live version is this plus the pending operations
+ALTER TABLE "Documents" ADD COLUMN version INTEGER NOT NULL DEFAULT 0;
@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS update_credentials_updated_at ON "UserCredentials";
+DROP INDEX ix_sessions_user_id;
+DROP TABLE "Sessions";
+DROP TABLE "UserCredentials";
@@ -0,0 +1,18 @@
+CREATE TABLE "UserCredentials" (
+    user_id INTEGER PRIMARY KEY REFERENCES "Users" (id) ON DELETE CASCADE,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE "Sessions" (
+    id VARCHAR(64) PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "Users" (id) ON DELETE CASCADE,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+CREATE INDEX ix_sessions_user_id ON "Sessions" (user_id);
+
+CREATE TRIGGER update_credentials_updated_at BEFORE UPDATE ON "UserCredentials"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
@@ -0,0 +1,10 @@
+DROP TRIGGER IF EXISTS trg_ensure_owner_permission ON "Documents";
+
+CREATE TRIGGER trg_ensure_owner_permission
+    AFTER INSERT ON "Documents"
+    FOR EACH ROW
+    EXECUTE FUNCTION ensure_owner_permission();
+
+ALTER TABLE "Documents" DROP CONSTRAINT "Documents_user_id_fkey";
+ALTER TABLE "Documents" ADD CONSTRAINT "Documents_user_id_fkey"
+    FOREIGN KEY (user_id) REFERENCES "Users" (id) ON DELETE CASCADE;
@@ -0,0 +1,12 @@
+-- Deleting a user must not silently delete the documents they own
+ALTER TABLE "Documents" DROP CONSTRAINT "Documents_user_id_fkey";
+ALTER TABLE "Documents" ADD CONSTRAINT "Documents_user_id_fkey"
+    FOREIGN KEY (user_id) REFERENCES "Users" (id) ON DELETE RESTRICT;
+
+-- Keep the owner's permission row in place when ownership changes hands
+DROP TRIGGER IF EXISTS trg_ensure_owner_permission ON "Documents";
+
+CREATE TRIGGER trg_ensure_owner_permission
+    AFTER INSERT OR UPDATE OF user_id ON "Documents"
+    FOR EACH ROW
+    EXECUTE FUNCTION ensure_owner_permission();
@@ -0,0 +1,2 @@
+DROP INDEX ix_share_links_document_id;
+DROP TABLE "ShareLinks";
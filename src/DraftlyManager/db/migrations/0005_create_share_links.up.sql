@@ -0,0 +1,13 @@
+CREATE TABLE "ShareLinks" (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES "Documents" (id) ON DELETE CASCADE,
+    -- Only the SHA-256 of the token is stored; the token itself is shown once on creation
+    token_hash VARCHAR(64) NOT NULL UNIQUE,
+    permission VARCHAR(16) NOT NULL,
+    created_by INTEGER REFERENCES "Users" (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    expires_at TIMESTAMP,
+    revoked_at TIMESTAMP,
+    CONSTRAINT ck_share_links_permission CHECK (permission IN ('view-only', 'comment', 'edit'))
+);
+CREATE INDEX ix_share_links_document_id ON "ShareLinks" (document_id);
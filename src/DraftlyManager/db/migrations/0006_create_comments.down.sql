@@ -0,0 +1,13 @@
+DROP TRIGGER IF EXISTS update_comments_updated_at ON "Comments";
+DROP INDEX ix_comments_parent_id;
+DROP INDEX ix_comments_document_id;
+DROP TABLE "Comments";
+
+-- Postgres cannot drop an enum value, so rebuild the type without it
+UPDATE "DocumentPermissions" SET permission = 'view-only' WHERE permission = 'comment';
+
+ALTER TYPE permission_type RENAME TO permission_type_old;
+CREATE TYPE permission_type AS ENUM ('edit', 'view-only');
+ALTER TABLE "DocumentPermissions"
+    ALTER COLUMN permission TYPE permission_type USING permission::text::permission_type;
+DROP TYPE permission_type_old;
@@ -0,0 +1,28 @@
+-- The new value cannot be used until this migration commits, and nothing below uses it
+ALTER TYPE permission_type ADD VALUE IF NOT EXISTS 'comment';
+
+CREATE TABLE "Comments" (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER NOT NULL REFERENCES "Documents" (id) ON DELETE CASCADE,
+    -- Replies point at the thread's root comment; only roots carry an anchor
+    parent_id INTEGER REFERENCES "Comments" (id) ON DELETE CASCADE,
+    user_id INTEGER REFERENCES "Users" (id) ON DELETE SET NULL,
+    body TEXT NOT NULL,
+    anchor_start INTEGER,
+    anchor_end INTEGER,
+    quoted_text TEXT,
+    resolved_at TIMESTAMP,
+    resolved_by INTEGER REFERENCES "Users" (id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT ck_comments_anchor CHECK (
+        (parent_id IS NULL AND anchor_start IS NOT NULL AND anchor_end IS NOT NULL
+            AND 0 <= anchor_start AND anchor_start <= anchor_end)
+        OR (parent_id IS NOT NULL AND anchor_start IS NULL AND anchor_end IS NULL)
+    )
+);
+CREATE INDEX ix_comments_document_id ON "Comments" (document_id);
+CREATE INDEX ix_comments_parent_id ON "Comments" (parent_id);
+
+CREATE TRIGGER update_comments_updated_at BEFORE UPDATE ON "Comments"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
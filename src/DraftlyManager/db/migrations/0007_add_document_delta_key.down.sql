@@ -0,0 +1 @@
+ALTER TABLE "Documents" DROP COLUMN delta_key;
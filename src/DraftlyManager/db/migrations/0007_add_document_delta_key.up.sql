@@ -0,0 +1,2 @@
+-- Key of the rich-text snapshot (JSON delta) stored alongside the plain text at s3_key
+ALTER TABLE "Documents" ADD COLUMN delta_key VARCHAR(255);
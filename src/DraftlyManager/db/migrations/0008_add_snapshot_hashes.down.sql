@@ -0,0 +1,4 @@
+DROP INDEX ix_documents_delta_key;
+DROP INDEX ix_documents_s3_key;
+ALTER TABLE "Documents" DROP COLUMN delta_sha256;
+ALTER TABLE "Documents" DROP COLUMN content_sha256;
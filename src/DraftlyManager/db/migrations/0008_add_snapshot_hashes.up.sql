@@ -0,0 +1,8 @@
+-- Hex SHA-256 of the uncompressed snapshots at s3_key and delta_key, checked on download.
+-- Snapshots written before this migration have no hash and are not verified.
+ALTER TABLE "Documents" ADD COLUMN content_sha256 CHAR(64);
+ALTER TABLE "Documents" ADD COLUMN delta_sha256 CHAR(64);
+
+-- Snapshots are shared by documents with identical content; deletes check for other references
+CREATE INDEX ix_documents_s3_key ON "Documents" (s3_key);
+CREATE INDEX ix_documents_delta_key ON "Documents" (delta_key);
@@ -0,0 +1,2 @@
+DROP INDEX ix_documents_title_search;
+DROP TABLE "DocumentSearch";
@@ -0,0 +1,12 @@
+-- Plain text of each document as of its last compaction or import, with the
+-- search vector derived from it. Titles are matched on "Documents" directly, so
+-- documents that were never compacted can still be found by title.
+CREATE TABLE "DocumentSearch" (
+    document_id INTEGER PRIMARY KEY REFERENCES "Documents" (id) ON DELETE CASCADE,
+    content TEXT NOT NULL,
+    content_tsv TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', content)) STORED,
+    indexed_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX ix_document_search_content ON "DocumentSearch" USING GIN (content_tsv);
+CREATE INDEX ix_documents_title_search ON "Documents" USING GIN (to_tsvector('english', title));
@@ -0,0 +1,4 @@
+DROP INDEX ix_documents_folder_id;
+ALTER TABLE "Documents" DROP COLUMN folder_id;
+DROP TABLE "FolderPermissions";
+DROP TABLE "Folders";
@@ -0,0 +1,33 @@
+-- Folders nest through parent_id. Everything filed in a folder, subfolders and
+-- documents alike, belongs to the folder's owner.
+CREATE TABLE "Folders" (
+    id SERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES "Users" (id) ON DELETE CASCADE,
+    parent_id INTEGER REFERENCES "Folders" (id) ON DELETE CASCADE,
+    name VARCHAR(255) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+CREATE INDEX ix_folders_user_id ON "Folders" (user_id);
+CREATE INDEX ix_folders_parent_id ON "Folders" (parent_id);
+
+-- Access granted on a folder applies to every folder and document beneath it
+CREATE TABLE "FolderPermissions" (
+    id SERIAL PRIMARY KEY,
+    folder_id INTEGER NOT NULL REFERENCES "Folders" (id) ON DELETE CASCADE,
+    user_id INTEGER NOT NULL REFERENCES "Users" (id) ON DELETE CASCADE,
+    permission permission_type NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT uq_folder_user UNIQUE (folder_id, user_id)
+);
+CREATE INDEX ix_folder_permissions_user_id ON "FolderPermissions" (user_id);
+
+CREATE TRIGGER update_folders_updated_at BEFORE UPDATE ON "Folders"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+CREATE TRIGGER update_folder_permissions_updated_at BEFORE UPDATE ON "FolderPermissions"
+    FOR EACH ROW EXECUTE FUNCTION update_updated_at_column();
+
+-- Documents outside any folder have no folder_id
+ALTER TABLE "Documents" ADD COLUMN folder_id INTEGER REFERENCES "Folders" (id) ON DELETE SET NULL;
+CREATE INDEX ix_documents_folder_id ON "Documents" (folder_id);
@@ -0,0 +1,2 @@
+DROP INDEX ix_documents_deleted_at;
+ALTER TABLE "Documents" DROP COLUMN deleted_at;
@@ -0,0 +1,4 @@
+-- Deleted documents stay in their owner's trash, with their content, until they
+-- are restored or purged after the retention period
+ALTER TABLE "Documents" ADD COLUMN deleted_at TIMESTAMP;
+CREATE INDEX ix_documents_deleted_at ON "Documents" (deleted_at) WHERE deleted_at IS NOT NULL;
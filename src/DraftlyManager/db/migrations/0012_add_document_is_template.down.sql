@@ -0,0 +1,2 @@
+DROP INDEX ix_documents_is_template;
+ALTER TABLE "Documents" DROP COLUMN is_template;
@@ -0,0 +1,4 @@
+-- Templates are documents their owner offers as a starting point: anyone who can
+-- read one can create a document from it with its placeholders filled in
+ALTER TABLE "Documents" ADD COLUMN is_template BOOLEAN NOT NULL DEFAULT FALSE;
+CREATE INDEX ix_documents_is_template ON "Documents" (user_id) WHERE is_template;
@@ -0,0 +1,5 @@
+-- Session expiry is written from UTC times and compared with NOW(), so it has to
+-- be an instant rather than a wall-clock time in the database's time zone.
+-- Existing rows hold UTC wall-clock times.
+ALTER TABLE "Sessions"
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ USING expires_at AT TIME ZONE 'UTC';
@@ -22,54 +22,125 @@ const (
 		DELETE FROM "Users" 
 		WHERE id = $1`
 
-	GetAllUsersQuery = `
-		SELECT id, name, email, created_at, updated_at 
-		FROM "Users" 
-		ORDER BY created_at DESC`
-
 	GetUserByEmailQuery = `
 		SELECT id, name, email, created_at, updated_at 
 		FROM "Users" 
 		WHERE email = $1`
 )
 
+// Credential and session queries
+const (
+	CreateCredentialsQuery = `
+		INSERT INTO "UserCredentials" (user_id, password_hash, created_at, updated_at) 
+		VALUES ($1, $2, NOW(), NOW())`
+
+	GetCredentialsByEmailQuery = `
+		SELECT u.id, u.name, u.email, u.created_at, u.updated_at, c.password_hash 
+		FROM "Users" u 
+		JOIN "UserCredentials" c ON c.user_id = u.id 
+		WHERE u.email = $1`
+
+	CreateSessionQuery = `
+		INSERT INTO "Sessions" (id, user_id, created_at, expires_at) 
+		VALUES ($1, $2, NOW(), $3)`
+
+	GetActiveSessionQuery = `
+		SELECT user_id 
+		FROM "Sessions" 
+		WHERE id = $1 AND revoked_at IS NULL AND expires_at > NOW()`
+
+	RevokeSessionQuery = `
+		UPDATE "Sessions" 
+		SET revoked_at = NOW() 
+		WHERE id = $1 AND revoked_at IS NULL`
+)
+
 // Document table queries
 const (
 	CreateDocumentQuery = `
 		INSERT INTO "Documents" (user_id, title, created_at, updated_at) 
 		VALUES ($1, $2, NOW(), NOW()) 
-		RETURNING id, user_id, title, created_at, updated_at`
-
-	GetUserDocumentsQuery = `
-		SELECT id, user_id, title, created_at, updated_at 
-		FROM "Documents" 
-		WHERE user_id = $1 
-		ORDER BY updated_at DESC`
-
-	GetDocumentQuery = `
-		SELECT id, user_id, title, operations, s3_key, created_at, updated_at 
-		FROM "Documents" 
-		WHERE id = $1 AND user_id = $2`
+		RETURNING id, user_id, folder_id, title, is_template, created_at, updated_at`
 
+	// GetDocumentByIDQuery treats documents in the trash as missing
 	GetDocumentByIDQuery = `
-		SELECT id, user_id, title, operations, s3_key, created_at, updated_at 
+		SELECT id, user_id, folder_id, title, is_template, operations, s3_key, content_sha256, delta_key, delta_sha256, version, created_at, updated_at 
 		FROM "Documents" 
-		WHERE id = $1`
+		WHERE id = $1 AND deleted_at IS NULL`
 
 	UpdateDocumentQuery = `
 		UPDATE "Documents" 
 		SET title = $1, updated_at = NOW() 
-		WHERE id = $2 AND user_id = $3 
-		RETURNING id, user_id, title, created_at, updated_at`
+		WHERE id = $2 AND deleted_at IS NULL 
+		RETURNING id, user_id, folder_id, title, is_template, created_at, updated_at`
+
+	// SetDocumentTemplateQuery marks a document as a template, or stops offering it as one
+	SetDocumentTemplateQuery = `
+		UPDATE "Documents" 
+		SET is_template = $1, updated_at = NOW() 
+		WHERE id = $2 AND deleted_at IS NULL 
+		RETURNING id, user_id, folder_id, title, is_template, created_at, updated_at`
+
+	// TrashDocumentQuery moves a document to the trash, keeping its content
+	TrashDocumentQuery = `
+		UPDATE "Documents" 
+		SET deleted_at = NOW() 
+		WHERE id = $1 AND deleted_at IS NULL`
+
+	RestoreDocumentQuery = `
+		UPDATE "Documents" 
+		SET deleted_at = NULL, updated_at = NOW() 
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL 
+		RETURNING id, user_id, folder_id, title, is_template, created_at, updated_at`
+
+	// PurgeDocumentQuery permanently deletes a document from its owner's trash
+	// and returns its snapshot keys
+	PurgeDocumentQuery = `
+		DELETE FROM "Documents" 
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL 
+		RETURNING id, s3_key, delta_key`
 
-	DeleteDocumentQuery = `
+	// PurgeExpiredDocumentsQuery permanently deletes up to $2 documents that have
+	// been in the trash for more than $1 seconds and returns their snapshot keys.
+	// Rows another purge is working on are skipped.
+	PurgeExpiredDocumentsQuery = `
 		DELETE FROM "Documents" 
-		WHERE id = $1 AND user_id = $2`
+		WHERE id IN (
+			SELECT id 
+			FROM "Documents" 
+			WHERE deleted_at < NOW() - make_interval(secs => $1) 
+			ORDER BY deleted_at 
+			LIMIT $2 
+			FOR UPDATE SKIP LOCKED) 
+		RETURNING id, s3_key, delta_key`
 
 	UpdateDocumentS3KeyQuery = `
 		UPDATE "Documents" 
-		SET s3_key = $1, updated_at = NOW() 
-		WHERE id = $2`
+		SET s3_key = $1, content_sha256 = $2, updated_at = NOW() 
+		WHERE id = $3`
+
+	UpdateDocumentDeltaKeyQuery = `
+		UPDATE "Documents" 
+		SET delta_key = $1, delta_sha256 = $2, updated_at = NOW() 
+		WHERE id = $3`
+
+	// ShareSnapshotLockQuery and DeleteSnapshotLockQuery lock a snapshot key
+	// until the transaction ends. Writers hold the shared lock while they upload
+	// a snapshot and point a document at it; deleting an unreferenced snapshot
+	// takes the exclusive lock, so it cannot run between the two.
+	ShareSnapshotLockQuery = `
+		SELECT pg_advisory_xact_lock_shared(7302116, hashtext($1))`
+
+	DeleteSnapshotLockQuery = `
+		SELECT pg_advisory_xact_lock(7302116, hashtext($1))`
+
+	// CountSnapshotReferencesQuery counts documents still using a snapshot key,
+	// since identical content is shared between documents. Documents in the
+	// trash still hold on to their content.
+	CountSnapshotReferencesQuery = `
+		SELECT COUNT(*) 
+		FROM "Documents" 
+		WHERE s3_key = $1 OR delta_key = $1`
 
 	GetDocumentOperationsQuery = `
 		SELECT operations 
@@ -81,37 +152,31 @@ const (
 		SET operations = $1, updated_at = NOW() 
 		WHERE id = $2`
 
-	ClearDocumentOperationsQuery = `
+	// TransferDocumentOwnerQuery takes the document out of the previous owner's folders
+	TransferDocumentOwnerQuery = `
 		UPDATE "Documents" 
-		SET operations = '[]'::json, updated_at = NOW() 
-		WHERE id = $1`
-)
-
-// Operation table queries
-const (
-	CreateOperationQuery = `
-		INSERT INTO "Operations" (document_id, type, position, text, length, created_at) 
-		VALUES ($1, $2, $3, $4, $5, NOW()) 
-		RETURNING id, document_id, type, position, text, length, created_at`
-
-	GetDocumentOperationsListQuery = `
-		SELECT id, document_id, type, position, text, length, created_at 
-		FROM "Operations" 
-		WHERE document_id = $1 
-		ORDER BY created_at ASC`
-
-	DeleteOperationQuery = `
-		DELETE FROM "Operations" 
-		WHERE id = $1`
+		SET user_id = $1, folder_id = NULL, updated_at = NOW() 
+		WHERE id = $2 AND deleted_at IS NULL 
+		RETURNING id, user_id, folder_id, title, is_template, created_at, updated_at`
 
-	DeleteAllDocumentOperationsQuery = `
-		DELETE FROM "Operations" 
-		WHERE document_id = $1`
+	GetOwnedDocumentIDsQuery = `
+		SELECT id 
+		FROM "Documents" 
+		WHERE user_id = $1 
+		ORDER BY id`
 
-	GetOperationByIDQuery = `
-		SELECT id, document_id, type, position, text, length, created_at 
-		FROM "Operations" 
-		WHERE id = $1`
+	// ClearDocumentOperationsQuery folds the first $2 operations into the snapshot
+	// version, keeping any appended since. It matches nothing if the snapshot has
+	// moved on from version $3.
+	ClearDocumentOperationsQuery = `
+		UPDATE "Documents" 
+		SET operations = COALESCE(
+				(SELECT json_agg(op ORDER BY position) 
+				FROM json_array_elements(operations) WITH ORDINALITY AS pending(op, position) 
+				WHERE position > $2), 
+				'[]'::json), 
+			version = version + $2, updated_at = NOW() 
+		WHERE id = $1 AND version = $3 AND json_array_length(operations) >= $2`
 )
 
 // Permission table queries
@@ -125,11 +190,6 @@ const (
 		FROM "DocumentPermissions" 
 		WHERE document_id = $1`
 
-	GetUserPermissionsQuery = `
-		SELECT document_id, permission, created_at, updated_at 
-		FROM "DocumentPermissions" 
-		WHERE user_id = $1`
-
 	UpdatePermissionQuery = `
 		UPDATE "DocumentPermissions" 
 		SET permission = $1, updated_at = NOW() 
@@ -139,18 +199,254 @@ const (
 		DELETE FROM "DocumentPermissions" 
 		WHERE document_id = $1 AND user_id = $2`
 
-	DeleteAllDocumentPermissionsQuery = `
-		DELETE FROM "DocumentPermissions" 
-		WHERE document_id = $1`
-
-	CheckUserPermissionQuery = `
-		SELECT permission 
-		FROM "DocumentPermissions" 
-		WHERE document_id = $1 AND user_id = $2`
+	UpsertPermissionQuery = `
+		INSERT INTO "DocumentPermissions" (document_id, user_id, permission, created_at, updated_at) 
+		VALUES ($1, $2, $3, NOW(), NOW()) 
+		ON CONFLICT (document_id, user_id) DO UPDATE 
+		SET permission = EXCLUDED.permission, updated_at = NOW()`
 
 	GetUsersWithDocumentAccessQuery = `
 		SELECT u.id, u.name, u.email, dp.permission 
 		FROM "Users" u 
 		JOIN "DocumentPermissions" dp ON u.id = dp.user_id 
-		WHERE dp.document_id = $1`
+		WHERE dp.document_id = $1 
+		ORDER BY u.name, u.id`
+
+	// LockDocumentQuery serializes sharing changes on a document within a transaction
+	LockDocumentQuery = `
+		SELECT user_id 
+		FROM "Documents" 
+		WHERE id = $1 
+		FOR UPDATE`
+)
+
+// Authorization queries
+const (
+	// GetDocumentAccessQuery returns the owner, the user's shared permission
+	// (NULL if none) and the permissions the user inherits from the folders
+	// containing the document. Documents in the trash are not found.
+	GetDocumentAccessQuery = `
+		WITH RECURSIVE ancestors AS (
+			SELECT f.id, f.parent_id 
+			FROM "Folders" f 
+			JOIN "Documents" d ON d.folder_id = f.id 
+			WHERE d.id = $1
+			UNION
+			SELECT f.id, f.parent_id 
+			FROM "Folders" f 
+			JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT d.user_id, dp.permission, ARRAY(
+			SELECT fp.permission::text 
+			FROM ancestors a 
+			JOIN "FolderPermissions" fp ON fp.folder_id = a.id AND fp.user_id = $2) 
+		FROM "Documents" d 
+		LEFT JOIN "DocumentPermissions" dp ON dp.document_id = d.id AND dp.user_id = $2 
+		WHERE d.id = $1 AND d.deleted_at IS NULL`
+
+	// GetFolderAccessQuery returns the folder's owner and the permissions the
+	// user holds on it or inherits from the folders above it
+	GetFolderAccessQuery = `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id 
+			FROM "Folders" 
+			WHERE id = $1
+			UNION
+			SELECT f.id, f.parent_id 
+			FROM "Folders" f 
+			JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT f.user_id, ARRAY(
+			SELECT fp.permission::text 
+			FROM ancestors a 
+			JOIN "FolderPermissions" fp ON fp.folder_id = a.id AND fp.user_id = $2) 
+		FROM "Folders" f 
+		WHERE f.id = $1`
+)
+
+// Folder queries
+const (
+	CreateFolderQuery = `
+		INSERT INTO "Folders" (user_id, parent_id, name, created_at, updated_at) 
+		VALUES ($1, $2, $3, NOW(), NOW()) 
+		RETURNING id, user_id, parent_id, name, created_at, updated_at`
+
+	GetFolderQuery = `
+		SELECT id, user_id, parent_id, name, created_at, updated_at 
+		FROM "Folders" 
+		WHERE id = $1`
+
+	RenameFolderQuery = `
+		UPDATE "Folders" 
+		SET name = $1, updated_at = NOW() 
+		WHERE id = $2 
+		RETURNING id, user_id, parent_id, name, created_at, updated_at`
+
+	MoveFolderQuery = `
+		UPDATE "Folders" 
+		SET parent_id = $1, updated_at = NOW() 
+		WHERE id = $2 
+		RETURNING id, user_id, parent_id, name, created_at, updated_at`
+
+	// DeleteFolderQuery only deletes empty folders. Documents in the trash do
+	// not count; they are restored to the top level.
+	DeleteFolderQuery = `
+		DELETE FROM "Folders" f 
+		WHERE f.id = $1 
+			AND NOT EXISTS (SELECT 1 FROM "Folders" c WHERE c.parent_id = f.id) 
+			AND NOT EXISTS (SELECT 1 FROM "Documents" d WHERE d.folder_id = f.id AND d.deleted_at IS NULL)`
+
+	// LockFolderTreeQuery serializes changes to one owner's folder tree until
+	// the transaction ends, so concurrent moves cannot form a cycle
+	LockFolderTreeQuery = `
+		SELECT pg_advisory_xact_lock(7302115, $1)`
+
+	// IsFolderWithinQuery reports whether folder $2 is folder $1 or lies beneath it
+	IsFolderWithinQuery = `
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id 
+			FROM "Folders" 
+			WHERE id = $2
+			UNION
+			SELECT f.id, f.parent_id 
+			FROM "Folders" f 
+			JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $1)`
+
+	// GetFolderRootsQuery returns the top-level folders a user owns and the
+	// folders shared with them directly, with the user's permission on each
+	GetFolderRootsQuery = `
+		SELECT f.id, f.user_id, f.parent_id, f.name, f.created_at, f.updated_at, 'owner' 
+		FROM "Folders" f 
+		WHERE f.user_id = $1 AND f.parent_id IS NULL
+		UNION ALL
+		SELECT f.id, f.user_id, f.parent_id, f.name, f.created_at, f.updated_at, fp.permission::text 
+		FROM "Folders" f 
+		JOIN "FolderPermissions" fp ON fp.folder_id = f.id AND fp.user_id = $1 
+		WHERE f.user_id <> $1`
+
+	// GetFolderSubtreeQuery returns the folders beneath any of the folders in $1,
+	// with the permission the user ($2) holds on each directly (NULL if none)
+	GetFolderSubtreeQuery = `
+		WITH RECURSIVE subtree AS (
+			SELECT id 
+			FROM "Folders" 
+			WHERE parent_id = ANY($1)
+			UNION
+			SELECT f.id 
+			FROM "Folders" f 
+			JOIN subtree s ON f.parent_id = s.id
+		)
+		SELECT f.id, f.user_id, f.parent_id, f.name, f.created_at, f.updated_at, fp.permission::text 
+		FROM "Folders" f 
+		JOIN subtree s ON s.id = f.id 
+		LEFT JOIN "FolderPermissions" fp ON fp.folder_id = f.id AND fp.user_id = $2 
+		ORDER BY f.name, f.id`
+
+	// GetFolderDocumentsQuery returns the documents filed in any of the folders
+	// in $1, with the permission the user ($2) holds on each directly
+	GetFolderDocumentsQuery = `
+		SELECT d.id, d.user_id, d.folder_id, d.title, d.is_template, d.created_at, d.updated_at, 
+			d.version + json_array_length(d.operations) AS version, 
+			CASE WHEN d.user_id = $2 THEN 'owner' ELSE dp.permission::text END AS permission 
+		FROM "Documents" d 
+		LEFT JOIN "DocumentPermissions" dp ON dp.document_id = d.id AND dp.user_id = $2 
+		WHERE d.folder_id = ANY($1) AND d.deleted_at IS NULL 
+		ORDER BY d.title, d.id`
+
+	MoveDocumentQuery = `
+		UPDATE "Documents" 
+		SET folder_id = $1, updated_at = NOW() 
+		WHERE id = $2 AND deleted_at IS NULL 
+		RETURNING id, user_id, folder_id, title, is_template, created_at, updated_at`
+)
+
+// Folder permission queries
+const (
+	UpsertFolderPermissionQuery = `
+		INSERT INTO "FolderPermissions" (folder_id, user_id, permission, created_at, updated_at) 
+		VALUES ($1, $2, $3, NOW(), NOW()) 
+		ON CONFLICT (folder_id, user_id) 
+		DO UPDATE SET permission = EXCLUDED.permission, updated_at = NOW()`
+
+	DeleteFolderPermissionQuery = `
+		DELETE FROM "FolderPermissions" 
+		WHERE folder_id = $1 AND user_id = $2`
+
+	GetFolderCollaboratorsQuery = `
+		SELECT u.id, u.name, u.email, fp.permission 
+		FROM "Users" u 
+		JOIN "FolderPermissions" fp ON u.id = fp.user_id 
+		WHERE fp.folder_id = $1 
+		ORDER BY u.name, u.id`
+)
+
+// Share link queries
+const (
+	CreateShareLinkQuery = `
+		INSERT INTO "ShareLinks" (document_id, token_hash, permission, created_by, created_at, expires_at) 
+		VALUES ($1, $2, $3, $4, NOW(), $5) 
+		RETURNING id, document_id, permission, created_by, created_at, expires_at, revoked_at`
+
+	GetDocumentShareLinksQuery = `
+		SELECT id, document_id, permission, created_by, created_at, expires_at, revoked_at 
+		FROM "ShareLinks" 
+		WHERE document_id = $1 AND revoked_at IS NULL 
+		ORDER BY created_at DESC, id DESC`
+
+	GetShareLinkByTokenQuery = `
+		SELECT id, document_id, permission, created_by, created_at, expires_at, revoked_at 
+		FROM "ShareLinks" 
+		WHERE token_hash = $1`
+
+	RevokeShareLinkQuery = `
+		UPDATE "ShareLinks" 
+		SET revoked_at = NOW() 
+		WHERE id = $1 AND document_id = $2 AND revoked_at IS NULL`
+)
+
+// Comment queries
+const (
+	CreateCommentQuery = `
+		INSERT INTO "Comments" (document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, created_at, updated_at) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), NOW()) 
+		RETURNING id, document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, resolved_at, resolved_by, created_at, updated_at`
+
+	GetDocumentCommentsQuery = `
+		SELECT id, document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, resolved_at, resolved_by, created_at, updated_at 
+		FROM "Comments" 
+		WHERE document_id = $1 
+		ORDER BY created_at, id`
+
+	GetCommentQuery = `
+		SELECT id, document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, resolved_at, resolved_by, created_at, updated_at 
+		FROM "Comments" 
+		WHERE id = $1 AND document_id = $2`
+
+	UpdateCommentBodyQuery = `
+		UPDATE "Comments" 
+		SET body = $1 
+		WHERE id = $2 AND document_id = $3 
+		RETURNING id, document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, resolved_at, resolved_by, created_at, updated_at`
+
+	// Only thread roots can be resolved or reopened
+	ResolveCommentQuery = `
+		UPDATE "Comments" 
+		SET resolved_at = NOW(), resolved_by = $1 
+		WHERE id = $2 AND document_id = $3 AND parent_id IS NULL 
+		RETURNING id, document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, resolved_at, resolved_by, created_at, updated_at`
+
+	ReopenCommentQuery = `
+		UPDATE "Comments" 
+		SET resolved_at = NULL, resolved_by = NULL 
+		WHERE id = $1 AND document_id = $2 AND parent_id IS NULL 
+		RETURNING id, document_id, parent_id, user_id, body, anchor_start, anchor_end, quoted_text, resolved_at, resolved_by, created_at, updated_at`
+
+	DeleteCommentQuery = `
+		DELETE FROM "Comments" 
+		WHERE id = $1 AND document_id = $2`
+
+	// NotifyCommentEventQuery publishes a models.CommentEvent to the WS server
+	NotifyCommentEventQuery = `SELECT pg_notify('comment_events', $1)`
 )
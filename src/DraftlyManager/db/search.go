@@ -0,0 +1,45 @@
+package db
+
+// Markers ts_headline puts around matched words in a snippet. They are control
+// characters stripped from indexed text, so they cannot appear in a document.
+const (
+	HighlightStart = "\x02"
+	HighlightStop  = "\x03"
+)
+
+// Search queries
+const (
+	// IndexDocumentQuery stores the text a document is searched by
+	IndexDocumentQuery = `
+		INSERT INTO "DocumentSearch" (document_id, content, indexed_at)
+		VALUES ($1, $2, NOW())
+		ON CONFLICT (document_id)
+		DO UPDATE SET content = EXCLUDED.content, indexed_at = NOW()`
+
+	// SearchDocumentsQuery ranks the documents a user can access, directly or
+	// through a folder, against a web search style query ($2), weighting title
+	// matches above content matches.
+	// Snippets are only built for the returned page. The user ID is $1.
+	SearchDocumentsQuery = `
+		WITH RECURSIVE ` + sharedDocumentsCTE + `,
+		hits AS (
+			SELECT d.id, d.user_id, d.folder_id, d.title, d.is_template, d.created_at, d.updated_at,
+				d.version + json_array_length(d.operations) AS version,
+				CASE WHEN d.user_id = $1 THEN 'owner' ELSE sd.permission END AS permission,
+				ts_rank(setweight(to_tsvector('english', d.title), 'A') || COALESCE(s.content_tsv, ''::tsvector), q.query) AS rank,
+				s.content, q.query
+			FROM "Documents" d
+			CROSS JOIN (SELECT websearch_to_tsquery('english', $2) AS query) q
+			LEFT JOIN shared_documents sd ON sd.document_id = d.id
+			LEFT JOIN "DocumentSearch" s ON s.document_id = d.id
+			WHERE (d.user_id = $1 OR sd.document_id IS NOT NULL) AND d.deleted_at IS NULL
+				AND (to_tsvector('english', d.title) @@ q.query OR s.content_tsv @@ q.query)
+			ORDER BY rank DESC, d.updated_at DESC, d.id DESC
+			LIMIT $3
+		)
+		SELECT id, user_id, folder_id, title, is_template, created_at, updated_at, version, permission, rank,
+			COALESCE(ts_headline('english', content, query,
+				'StartSel="` + HighlightStart + `", StopSel="` + HighlightStop + `", MaxWords=35, MinWords=15, MaxFragments=2, FragmentDelimiter=" … "'), '')
+		FROM hits
+		ORDER BY rank DESC, updated_at DESC, id DESC`
+)
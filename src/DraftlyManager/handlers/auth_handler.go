@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"Draftly/CRUD/middleware"
+	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
+	"Draftly/CRUD/services"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type AuthHandler struct {
+	store       repository.Store
+	authService *services.AuthService
+}
+
+func NewAuthHandler(store repository.Store, authService *services.AuthService) *AuthHandler {
+	return &AuthHandler{
+		store:       store,
+		authService: authService,
+	}
+}
+
+// Login handles POST /v1/auth/login
+func (h *AuthHandler) Login(w http.ResponseWriter, r *http.Request) {
+	var input models.LoginInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+
+	if input.Email == "" || input.Password == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Email and password are required", nil)
+		return
+	}
+
+	user, passwordHash, err := h.store.Repos().Users.GetCredentials(r.Context(), input.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	// Unknown emails and wrong passwords get the same response, and take as long
+	found := err == nil
+	if !found {
+		passwordHash = h.authService.DummyPasswordHash()
+	}
+	if !h.authService.VerifyPassword(passwordHash, input.Password) || !found {
+		writeError(w, r, http.StatusUnauthorized, CodeInvalidCredentials, "Invalid email or password", nil)
+		return
+	}
+
+	token, err := h.startSession(r.Context(), user.ID)
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to start session: %v\n", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to start session", nil)
+		return
+	}
+	token.User = user
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(token)
+}
+
+// Logout handles POST /v1/auth/logout
+func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
+	user, ok := middleware.AuthUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Authentication required", nil)
+		return
+	}
+
+	if err := h.store.Repos().Sessions.Revoke(r.Context(), user.SessionID); err != nil {
+		writeDBError(w, r, err, "Session not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// Me handles GET /v1/auth/me
+func (h *AuthHandler) Me(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := h.store.Repos().Users.Get(r.Context(), userID)
+	if err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(user)
+}
+
+// RequireAuth rejects requests without a valid bearer token for a live session
+// and attaches the authenticated user to the request context
+func (h *AuthHandler) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		token, found := strings.CutPrefix(header, "Bearer ")
+		if !found || token == "" {
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Authentication required", nil)
+			return
+		}
+
+		claims, err := h.authService.ParseToken(token)
+		if err != nil {
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Invalid or expired token", nil)
+			return
+		}
+
+		// The signature proves the token is ours; the session row lets logout revoke it
+		sessionUserID, err := h.store.Repos().Sessions.ActiveUserID(r.Context(), claims.SessionID)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Session has ended", nil)
+				return
+			}
+			writeDBError(w, r, err, "Session not found")
+			return
+		}
+		if sessionUserID != claims.UserID {
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Invalid or expired token", nil)
+			return
+		}
+
+		ctx := middleware.WithAuthUser(r.Context(), middleware.AuthUser{
+			UserID:    claims.UserID,
+			SessionID: claims.SessionID,
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// startSession stores a new session row and signs a token for it
+func (h *AuthHandler) startSession(ctx context.Context, userID int) (models.AuthToken, error) {
+	sessionID, err := h.authService.NewSessionID()
+	if err != nil {
+		return models.AuthToken{}, err
+	}
+
+	expiresAt := time.Now().Add(h.authService.SessionTTL()).UTC()
+	if err := h.store.Repos().Sessions.Create(ctx, sessionID, userID, expiresAt); err != nil {
+		return models.AuthToken{}, err
+	}
+
+	token, err := h.authService.IssueToken(services.TokenClaims{
+		SessionID: sessionID,
+		UserID:    userID,
+		ExpiresAt: expiresAt.Unix(),
+	})
+	if err != nil {
+		return models.AuthToken{}, err
+	}
+
+	return models.AuthToken{
+		Token:     token,
+		TokenType: "Bearer",
+		ExpiresAt: expiresAt,
+	}, nil
+}
+
+// requireUser returns the authenticated user ID, writing a 401 if there is none
+func requireUser(w http.ResponseWriter, r *http.Request) (int, bool) {
+	user, ok := middleware.AuthUserFromContext(r.Context())
+	if !ok {
+		writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "Authentication required", nil)
+		return 0, false
+	}
+	return user.UserID, true
+}
@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"Draftly/CRUD/services"
+	"errors"
+	"net/http"
+)
+
+// authorizeDocument checks that the caller may perform action on a document,
+// writing a 404 (no access) or 403 (insufficient access) when they may not
+func authorizeDocument(w http.ResponseWriter, r *http.Request, access *services.AccessService, documentID, userID int, action services.Action) (services.Role, bool) {
+	role, err := access.Authorize(r.Context(), documentID, userID, action)
+	switch {
+	case err == nil:
+		return role, true
+	case errors.Is(err, services.ErrDocumentNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Document not found", nil)
+	case errors.Is(err, services.ErrForbidden):
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "You do not have permission to "+string(action)+" this document",
+			map[string]string{"permission": role.String(), "action": string(action)})
+	default:
+		writeDBError(w, r, err, "Document not found")
+	}
+	return role, false
+}
+
+// authorizeFolder checks that the caller may perform action on a folder, with
+// the same responses as authorizeDocument
+func authorizeFolder(w http.ResponseWriter, r *http.Request, access *services.AccessService, folderID, userID int, action services.Action) (services.Role, bool) {
+	role, err := access.AuthorizeFolder(r.Context(), folderID, userID, action)
+	switch {
+	case err == nil:
+		return role, true
+	case errors.Is(err, services.ErrFolderNotFound):
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "Folder not found", nil)
+	case errors.Is(err, services.ErrForbidden):
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "You do not have permission to "+string(action)+" this folder",
+			map[string]string{"permission": role.String(), "action": string(action)})
+	default:
+		writeDBError(w, r, err, "Folder not found")
+	}
+	return role, false
+}
@@ -0,0 +1,394 @@
+package handlers
+
+import (
+	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
+	"Draftly/CRUD/services"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// Events for comments that do not fit in a pg_notify payload are sent
+	// without the comment, so this only bounds storage
+	maxCommentBodyBytes = 4000
+	maxQuotedTextRunes  = 200
+)
+
+// Comment list filters
+const (
+	commentStatusOpen     = "open"
+	commentStatusResolved = "resolved"
+	commentStatusAll      = "all"
+)
+
+type CommentHandler struct {
+	store         repository.Store
+	s3Service     *services.S3Service
+	accessService *services.AccessService
+}
+
+func NewCommentHandler(store repository.Store, s3Service *services.S3Service, accessService *services.AccessService) *CommentHandler {
+	return &CommentHandler{
+		store:         store,
+		s3Service:     s3Service,
+		accessService: accessService,
+	}
+}
+
+// ListComments handles GET /v1/documents/{documentId}/comments?status=open|resolved|all
+func (h *CommentHandler) ListComments(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = commentStatusOpen
+	}
+	if status != commentStatusOpen && status != commentStatusResolved && status != commentStatusAll {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid status",
+			map[string]interface{}{"status": status, "allowed": []string{commentStatusOpen, commentStatusResolved, commentStatusAll}})
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead); !ok {
+		return
+	}
+
+	comments, err := h.store.Repos().Comments.ForDocument(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	// Rows come back oldest first, so replies are appended in order
+	threads := make([]models.Comment, 0)
+	index := make(map[int]int)
+	var replies []models.Comment
+	for _, comment := range comments {
+		if comment.ParentID != nil {
+			replies = append(replies, comment)
+			continue
+		}
+		if status == commentStatusOpen && comment.Resolved || status == commentStatusResolved && !comment.Resolved {
+			continue
+		}
+		index[comment.ID] = len(threads)
+		threads = append(threads, comment)
+	}
+	for _, reply := range replies {
+		if i, ok := index[*reply.ParentID]; ok {
+			threads[i].Replies = append(threads[i].Replies, reply)
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(threads)
+}
+
+// CreateComment handles POST /v1/documents/{documentId}/comments
+func (h *CommentHandler) CreateComment(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.CommentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if !validCommentBody(w, r, input.Body) {
+		return
+	}
+	if input.AnchorStart == nil || input.AnchorEnd == nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "anchorStart and anchorEnd are required", nil)
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionComment); !ok {
+		return
+	}
+
+	// Anchors are checked against the current text, including pending operations
+	doc, err := h.store.Repos().Documents.Get(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	current, err := materialize(r.Context(), h.s3Service, doc)
+	if err != nil {
+		fmt.Printf("DEBUG: Error materializing document %d: %v\n", documentID, err)
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to load document content")
+		return
+	}
+
+	content := []rune(current.Content)
+	start, end := *input.AnchorStart, *input.AnchorEnd
+	if start < 0 || start > end || end > len(content) {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Anchor is outside the document",
+			map[string]interface{}{"anchorStart": start, "anchorEnd": end, "length": len(content)})
+		return
+	}
+	quoted := content[start:end]
+	if len(quoted) > maxQuotedTextRunes {
+		quoted = quoted[:maxQuotedTextRunes]
+	}
+
+	comment, err := h.store.Repos().Comments.CreateThread(r.Context(), documentID, userID, input.Body, start, end, string(quoted))
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	h.publish(r.Context(), models.CommentCreated, comment)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(comment)
+}
+
+// CreateReply handles POST /v1/documents/{documentId}/comments/{commentId}/replies
+func (h *CommentHandler) CreateReply(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := parseCommentID(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.CommentInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if !validCommentBody(w, r, input.Body) {
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionComment); !ok {
+		return
+	}
+
+	parent, ok := h.loadComment(w, r, commentID, documentID)
+	if !ok {
+		return
+	}
+	// Threads are one level deep; replying to a reply joins its thread
+	threadID := parent.ID
+	if parent.ParentID != nil {
+		threadID = *parent.ParentID
+	}
+
+	reply, err := h.store.Repos().Comments.CreateReply(r.Context(), documentID, threadID, userID, input.Body)
+	if err != nil {
+		writeDBError(w, r, err, "Comment not found")
+		return
+	}
+	h.publish(r.Context(), models.CommentCreated, reply)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(reply)
+}
+
+// UpdateComment handles PATCH /v1/documents/{documentId}/comments/{commentId}
+//
+// Only the author can change what they wrote.
+func (h *CommentHandler) UpdateComment(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := parseCommentID(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.CommentUpdateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if !validCommentBody(w, r, input.Body) {
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionComment); !ok {
+		return
+	}
+
+	comment, ok := h.loadComment(w, r, commentID, documentID)
+	if !ok {
+		return
+	}
+	if comment.UserID == nil || *comment.UserID != userID {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "You can only edit your own comments", nil)
+		return
+	}
+
+	updated, err := h.store.Repos().Comments.UpdateBody(r.Context(), commentID, documentID, input.Body)
+	h.writeUpdated(w, r, models.CommentUpdated, updated, err)
+}
+
+// ResolveComment handles POST /v1/documents/{documentId}/comments/{commentId}/resolve
+func (h *CommentHandler) ResolveComment(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := parseCommentID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionComment); !ok {
+		return
+	}
+
+	comment, err := h.store.Repos().Comments.Resolve(r.Context(), commentID, documentID, userID)
+	h.writeUpdated(w, r, models.CommentResolved, comment, err)
+}
+
+// ReopenComment handles POST /v1/documents/{documentId}/comments/{commentId}/reopen
+func (h *CommentHandler) ReopenComment(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := parseCommentID(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionComment); !ok {
+		return
+	}
+
+	comment, err := h.store.Repos().Comments.Reopen(r.Context(), commentID, documentID)
+	h.writeUpdated(w, r, models.CommentReopened, comment, err)
+}
+
+// DeleteComment handles DELETE /v1/documents/{documentId}/comments/{commentId}
+//
+// Authors can delete their own comments and the owner can delete any. Deleting
+// a thread root deletes its replies.
+func (h *CommentHandler) DeleteComment(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := parseCommentID(w, r)
+	if !ok {
+		return
+	}
+
+	role, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead)
+	if !ok {
+		return
+	}
+
+	comment, ok := h.loadComment(w, r, commentID, documentID)
+	if !ok {
+		return
+	}
+	isAuthor := comment.UserID != nil && *comment.UserID == userID
+	if !isAuthor && role != services.RoleOwner {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "You can only delete your own comments", nil)
+		return
+	}
+
+	if err := h.store.Repos().Comments.Delete(r.Context(), commentID, documentID); err != nil {
+		writeDBError(w, r, err, "Comment not found")
+		return
+	}
+
+	h.publish(r.Context(), models.CommentDeleted, comment)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeUpdated takes the result of updating a comment, publishes the event and
+// writes the updated comment
+func (h *CommentHandler) writeUpdated(w http.ResponseWriter, r *http.Request, event string, comment models.Comment, err error) {
+	if err != nil {
+		writeDBError(w, r, err, "Comment thread not found")
+		return
+	}
+
+	h.publish(r.Context(), event, comment)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(comment)
+}
+
+// loadComment fetches a comment on the document, writing a 404 if there is none
+func (h *CommentHandler) loadComment(w http.ResponseWriter, r *http.Request, commentID, documentID int) (models.Comment, bool) {
+	comment, err := h.store.Repos().Comments.Get(r.Context(), commentID, documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Comment not found")
+		return models.Comment{}, false
+	}
+	return comment, true
+}
+
+// publish notifies the WS server so connected clients see comment changes live.
+// The REST change has already happened, so failures are only logged and the
+// notification is sent even if the client has gone away.
+func (h *CommentHandler) publish(ctx context.Context, eventType string, comment models.Comment) {
+	err := h.store.Repos().Comments.Publish(context.WithoutCancel(ctx), models.CommentEvent{
+		Type:       eventType,
+		DocumentID: comment.DocumentID,
+		CommentID:  comment.ID,
+		Comment:    &comment,
+	})
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to publish comment event: %v\n", err)
+	}
+}
+
+// parseRequest returns the authenticated user and the document ID from the path
+func (h *CommentHandler) parseRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	documentID, err := strconv.Atoi(mux.Vars(r)["documentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return 0, 0, false
+	}
+	return userID, documentID, true
+}
+
+func parseCommentID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	commentID, err := strconv.Atoi(mux.Vars(r)["commentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid comment ID", nil)
+		return 0, false
+	}
+	return commentID, true
+}
+
+// validCommentBody rejects empty and oversized comment bodies
+func validCommentBody(w http.ResponseWriter, r *http.Request, body string) bool {
+	if strings.TrimSpace(body) == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Comment body is required", nil)
+		return false
+	}
+	if len(body) > maxCommentBodyBytes {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Comment body is too long",
+			map[string]interface{}{"maxBytes": maxCommentBodyBytes})
+		return false
+	}
+	return true
+}
@@ -3,37 +3,53 @@ package handlers
 import (
 	"Draftly/CRUD/db"
 	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
 	"Draftly/CRUD/services"
+	"context"
+	"crypto/sha256"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
 	"net/http"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
 type DocumentHandler struct {
-	dbService *services.DatabaseService
-	s3Service *services.S3Service
+	store         repository.Store
+	s3Service     *services.S3Service
+	accessService *services.AccessService
+	maxImport     int64 // largest file accepted by ImportDocument
 }
 
-func NewDocumentHandler(dbService *services.DatabaseService, s3Service *services.S3Service) *DocumentHandler {
+func NewDocumentHandler(store repository.Store, s3Service *services.S3Service, accessService *services.AccessService) *DocumentHandler {
 	return &DocumentHandler{
-		dbService: dbService,
-		s3Service: s3Service,
+		store:         store,
+		s3Service:     s3Service,
+		accessService: accessService,
+		maxImport:     services.ImportMaxBytes(),
 	}
 }
 
-// CreateDocument handles POST /v1/documents/{userId}
+// documentResponse is a document along with any collaborator permissions that
+// could not be applied, so partial failures are reported instead of dropped
+type documentResponse struct {
+	models.Document
+	FailedPermissions []models.PermissionFailure `json:"failedPermissions,omitempty"`
+}
+
+// CreateDocument handles POST /v1/documents
 func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request) {
 	fmt.Println("DEBUG: CreateDocument function called")
 
-	vars := mux.Vars(r)
-	userID, err := strconv.Atoi(vars["userId"])
-	if err != nil {
-		fmt.Printf("DEBUG: Invalid user ID error: %v\n", err)
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	userID, ok := requireUser(w, r)
+	if !ok {
 		return
 	}
 	fmt.Printf("DEBUG: Parsed userID: %d\n", userID)
@@ -41,33 +57,29 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 	var docInput models.DocumentInput
 	if err := json.NewDecoder(r.Body).Decode(&docInput); err != nil {
 		fmt.Printf("DEBUG: JSON decode error: %v\n", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
 		return
 	}
 	fmt.Printf("DEBUG: Parsed docInput: %+v\n", docInput)
 
 	fmt.Println("DEBUG: About to execute database query")
-	var doc models.Document
-	err = h.dbService.ExecuteQueryRow(db.CreateDocumentQuery,
-		[]interface{}{&doc.ID, &doc.UserID, &doc.Title, &doc.CreatedAt, &doc.UpdatedAt},
-		userID, docInput.Title)
-
+	doc, err := h.store.Repos().Documents.Create(r.Context(), userID, docInput.Title)
 	if err != nil {
 		fmt.Printf("DEBUG: Database error: %v\n", err)
-		http.Error(w, "Failed to create document", http.StatusInternalServerError)
+		writeDBError(w, r, err, "User not found")
 		return
 	}
 	fmt.Printf("DEBUG: Created document: %+v\n", doc)
 
-	// Handle permissions if provided
+	// Handle permissions if provided, reporting the ones that could not be granted
+	response := documentResponse{Document: doc}
 	if len(docInput.AllowedUsers) > 0 {
 		fmt.Printf("DEBUG: Processing %d permissions\n", len(docInput.AllowedUsers))
 		for _, permission := range docInput.AllowedUsers {
-			_, err := h.dbService.ExecuteNonQuery(db.CreatePermissionQuery,
-				doc.ID, permission.UserID, permission.Permission)
+			err := h.store.Repos().Permissions.Create(r.Context(), doc.ID, permission.UserID, permission.Permission)
 			if err != nil {
 				fmt.Printf("DEBUG: Permission error: %v\n", err)
-				continue
+				response.FailedPermissions = append(response.FailedPermissions, permissionFailure(permission, err))
 			}
 		}
 	}
@@ -75,209 +87,532 @@ func (h *DocumentHandler) CreateDocument(w http.ResponseWriter, r *http.Request)
 	fmt.Println("DEBUG: Sending successful response")
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(doc)
+	json.NewEncoder(w).Encode(response)
 }
 
-// GetUserDocuments handles GET /v1/documents/{userId}
-func (h *DocumentHandler) GetUserDocuments(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID, err := strconv.Atoi(vars["userId"])
+// ImportDocument handles POST /v1/documents/import
+//
+// Takes multipart/form-data with a "file" part and optional "title", "format"
+// (md, html, docx, txt) and "charset" fields. The file is converted to the
+// document model and stored as the content of a new document owned by the caller.
+func (h *DocumentHandler) ImportDocument(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Leave room for the multipart headers and the other form fields
+	r.Body = http.MaxBytesReader(w, r.Body, h.maxImport+1<<20)
+	if err := r.ParseMultipartForm(h.maxImport); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+				fmt.Sprintf("File must be at most %d bytes", h.maxImport), map[string]interface{}{"maxBytes": h.maxImport})
+			return
+		}
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Expected a multipart/form-data body", err.Error())
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "file is required", nil)
+		return
+	}
+	defer file.Close()
+	if header.Size > h.maxImport {
+		writeError(w, r, http.StatusRequestEntityTooLarge, CodePayloadTooLarge,
+			fmt.Sprintf("File must be at most %d bytes", h.maxImport), map[string]interface{}{"maxBytes": h.maxImport})
+		return
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Failed to read file", nil)
+		return
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(header.Header.Get("Content-Type"))
+	format := r.FormValue("format")
+	if format == "" {
+		format, _ = services.ImportFormatFor(header.Filename, mediaType)
+	}
+	charset := r.FormValue("charset")
+	if charset == "" {
+		charset = params["charset"]
+	}
+
+	delta, err := services.ImportDocument(data, format, charset)
+	switch {
+	case errors.Is(err, services.ErrUnsupportedImport):
+		writeError(w, r, http.StatusUnsupportedMediaType, CodeUnsupportedMedia,
+			"format must be one of: "+strings.Join(services.ImportFormats, ", "), map[string]interface{}{"formats": services.ImportFormats})
+		return
+	case errors.Is(err, services.ErrUnsupportedCharset):
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Unsupported charset", nil)
+		return
+	case err != nil:
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Could not read file as "+format, err.Error())
+		return
+	}
+
+	title := strings.TrimSpace(r.FormValue("title"))
+	if title == "" {
+		title = services.ImportTitle(header.Filename)
+	}
+
+	doc, err := h.store.Repos().Documents.Create(r.Context(), userID, title)
+	if err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	content := services.PlainText(delta)
+	if err := h.storeContent(r.Context(), doc.ID, content, delta); err != nil {
+		fmt.Printf("DEBUG: Error storing imported document %d: %v\n", doc.ID, err)
+		// Don't leave an empty document behind, even if the client has gone away
+		if err := h.discard(context.WithoutCancel(r.Context()), doc.ID, userID); err != nil {
+			fmt.Printf("DEBUG: Error removing document %d: %v\n", doc.ID, err)
+		}
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to store imported document")
+		return
+	}
+
+	doc.Content = content
+	doc.Permission = services.RoleOwner.String()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(documentResponse{Document: doc})
+}
+
+// storeContent stores the snapshots of a new document, such as an import or a
+// copy, and indexes its text
+func (h *DocumentHandler) storeContent(ctx context.Context, documentID int, content string, delta models.Delta) error {
+	if _, _, err := h.storeSnapshots(ctx, documentID, content, delta, nil); err != nil {
+		return err
+	}
+	h.indexContent(ctx, documentID, content)
+	return nil
+}
+
+var (
+	// errSnapshotUpload marks storeSnapshots failures that came from the blob
+	// store rather than the database
+	errSnapshotUpload = errors.New("snapshot upload failed")
+	// errCompactionConflict is returned when another compaction folded the
+	// operations first
+	errCompactionConflict = errors.New("document was compacted by another request")
+)
+
+// storeSnapshots uploads the plain text and delta snapshots of a document and
+// points the document at them. Both happen in one transaction holding shared
+// locks on the keys, so releaseSnapshots cannot delete identical content
+// another document is dropping before this document's reference is recorded.
+// If fold is set it runs in the same transaction, so the snapshot and the
+// operations it replaces change together.
+func (h *DocumentHandler) storeSnapshots(ctx context.Context, documentID int, content string, delta models.Delta, fold func(repository.Repos) error) (text, rich services.Snapshot, err error) {
+	deltaJSON, err := json.Marshal(delta)
+	if err != nil {
+		return text, rich, err
+	}
+	text = h.s3Service.DocumentSnapshot([]byte(content))
+	rich = h.s3Service.DeltaSnapshot(deltaJSON)
+
+	// Leave time for the two uploads on top of the statements
+	tx, err := h.store.BeginExtended(ctx, 2*h.s3Service.Timeout())
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return text, rich, err
+	}
+	defer tx.Rollback()
+
+	documents := tx.Repos().Documents
+	if err := documents.ShareSnapshots(ctx, text.Key, rich.Key); err != nil {
+		return text, rich, err
+	}
+	if err := h.s3Service.UploadSnapshot(ctx, text, []byte(content)); err != nil {
+		return text, rich, fmt.Errorf("%w: %w", errSnapshotUpload, err)
+	}
+	if err := h.s3Service.UploadSnapshot(ctx, rich, deltaJSON); err != nil {
+		return text, rich, fmt.Errorf("%w: %w", errSnapshotUpload, err)
+	}
+	if err := documents.SetSnapshot(ctx, documentID, text.Key, text.SHA256); err != nil {
+		return text, rich, err
+	}
+	if err := documents.SetDeltaSnapshot(ctx, documentID, rich.Key, rich.SHA256); err != nil {
+		return text, rich, err
+	}
+	if fold != nil {
+		if err := fold(tx.Repos()); err != nil {
+			return text, rich, err
+		}
+	}
+	return text, rich, tx.Commit()
+}
+
+// indexContent refreshes the search index with a document's compacted text.
+// The index is derived from the snapshot and rebuilt on the next compaction,
+// so a failure is logged rather than failing the request.
+func (h *DocumentHandler) indexContent(ctx context.Context, documentID int, content string) {
+	if err := h.store.Repos().Search.Index(context.WithoutCancel(ctx), documentID, content); err != nil {
+		fmt.Printf("DEBUG: Error indexing document %d: %v\n", documentID, err)
+	}
+}
+
+// GetUserDocuments handles GET /v1/documents
+//
+// Lists documents the caller owns or has been shared, directly or through a folder,
+// with their highest permission level.
+// Query parameters: filter (all, owned, shared, templates), q (title prefix), sort (updated_at,
+// created_at, title), order (asc, desc), limit and cursor. The next page's cursor is
+// returned in X-Next-Cursor and linked from the Link header.
+func (h *DocumentHandler) GetUserDocuments(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
 		return
 	}
 
-	results, err := h.dbService.ExecuteQuery(db.GetUserDocumentsQuery, userID)
+	query := r.URL.Query()
+	opts := db.DocumentListOptions{
+		Filter:      query.Get("filter"),
+		TitlePrefix: strings.TrimSpace(query.Get("q")),
+	}
 
+	if opts.Filter == "" {
+		opts.Filter = db.FilterAll
+	}
+	switch opts.Filter {
+	case db.FilterAll, db.FilterOwned, db.FilterShared, db.FilterTemplates:
+	default:
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "filter must be one of all, owned, shared, templates", nil)
+		return
+	}
+
+	// Timestamps default to newest first, titles to alphabetical
+	page, limit, err := parsePage(r, "title", "updated_at", "created_at", "title")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, err.Error(), nil)
+		return
+	}
+	opts.Page = page
+
+	documents, err := h.store.Repos().Documents.List(r.Context(), userID, opts)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeDBError(w, r, err, "Document not found")
 		return
 	}
 
+	if len(documents) > limit {
+		documents = documents[:limit]
+		last := documents[len(documents)-1]
+		var value interface{} = last.UpdatedAt
+		switch page.Sort {
+		case "title":
+			value = last.Title
+		case "created_at":
+			value = last.CreatedAt
+		}
+		setNextPage(w, r, pageCursorAfter(page, last.ID, value))
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results)
+	json.NewEncoder(w).Encode(documents)
 }
 
-// GetDocument handles GET /v1/documents/{userId}/{documentId}
+// GetDocument handles GET /v1/documents/{documentId}
 func (h *DocumentHandler) GetDocument(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
-	userID, err := strconv.Atoi(vars["userId"])
+	documentID, err := strconv.Atoi(vars["documentId"])
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
 		return
 	}
 
-	documentID, err := strconv.Atoi(vars["documentId"])
+	// Owners, editors and viewers can all read
+	role, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead)
+	if !ok {
+		return
+	}
+
+	doc, err := h.store.Repos().Documents.Get(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	current, err := materialize(r.Context(), h.s3Service, doc)
 	if err != nil {
-		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		fmt.Printf("DEBUG: Error materializing document %d: %v\n", documentID, err)
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to load document content")
 		return
 	}
 
-	results, err := h.dbService.ExecuteQuery(db.GetDocumentQuery, documentID, userID)
+	response := map[string]interface{}{
+		"id":         doc.ID,
+		"userId":     doc.UserID,
+		"folderId":   doc.FolderID,
+		"title":      doc.Title,
+		"isTemplate": doc.IsTemplate,
+		"content":    current.Content,
+		"delta":      current.Delta,
+		"version":    current.Version,
+		"permission": role.String(),
+		"created_at": doc.CreatedAt,
+		"updated_at": doc.UpdatedAt,
+	}
 
+	if doc.IsTemplate {
+		response["placeholders"] = services.TemplatePlaceholders(doc.Title, current.Content)
+	}
+
+	body, err := json.Marshal(response)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to encode document", nil)
 		return
 	}
 
-	if len(results) == 0 {
-		http.Error(w, "Document not found", http.StatusNotFound)
+	// The ETag covers the whole representation so title changes also invalidate caches
+	etag := fmt.Sprintf(`"%x"`, sha256.Sum256(body))
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "private, no-cache")
+	if match := r.Header.Get("If-None-Match"); match != "" && match == etag {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
 
-	doc := results[0]
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(body)
+}
 
-	// Convert database field names to API field names
-	response := map[string]interface{}{
-		"id":         doc["id"],
-		"userId":     doc["user_id"], // Convert user_id to userId
-		"title":      doc["title"],
-		"created_at": doc["created_at"],
-		"updated_at": doc["updated_at"],
-	}
-
-	// Get S3 content if available
-	if s3Key, exists := doc["s3_key"]; exists && s3Key != nil {
-		content, err := h.s3Service.DownloadDocument(s3Key.(string))
-		if err == nil {
-			response["content"] = string(content)
-		}
+// GetDocumentAccess handles GET /v1/documents/{documentId}/access
+//
+// Reports the caller's permission on a document without loading its content.
+// The collaboration server uses it to check the session a client connects with.
+func (h *DocumentHandler) GetDocumentAccess(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := parseDocumentRequest(w, r)
+	if !ok {
+		return
 	}
 
-	// Get operations if they exist
-	if operationsData, exists := doc["operations"]; exists && operationsData != nil {
-		var operations []models.Operation
-		if err := json.Unmarshal([]byte(operationsData.(string)), &operations); err == nil {
-			response["operations"] = operations
-		}
+	role, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead)
+	if !ok {
+		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(response)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"documentId": documentID,
+		"userId":     userID,
+		"permission": role.String(),
+	})
 }
 
-// UpdateDocument handles PUT /v1/documents/{userId}/{documentId}
-func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
+// ExportDocument handles GET /v1/documents/{documentId}/export?format=md|html|pdf|docx|txt
+func (h *DocumentHandler) ExportDocument(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
-	userID, err := strconv.Atoi(vars["userId"])
+	documentID, err := strconv.Atoi(vars["documentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if _, supported := services.ExportFormats[format]; !supported {
+		formats := make([]string, 0, len(services.ExportFormats))
+		for name := range services.ExportFormats {
+			formats = append(formats, name)
+		}
+		sort.Strings(formats)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "format must be one of: "+strings.Join(formats, ", "),
+			map[string]interface{}{"formats": formats})
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead); !ok {
+		return
+	}
+
+	doc, err := h.store.Repos().Documents.Get(r.Context(), documentID)
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeDBError(w, r, err, "Document not found")
 		return
 	}
 
+	current, err := materialize(r.Context(), h.s3Service, doc)
+	if err != nil {
+		fmt.Printf("DEBUG: Error materializing document %d: %v\n", documentID, err)
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to load document content")
+		return
+	}
+
+	title := doc.Title
+	body, exportFormat, err := services.ExportDocument(title, current.Delta, format)
+	if err != nil {
+		fmt.Printf("DEBUG: Error exporting document %d as %s: %v\n", documentID, format, err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to export document", nil)
+		return
+	}
+
+	// FormatMediaType falls back to RFC 2231 encoding for non-ASCII titles
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": services.ExportFileName(title, exportFormat)})
+	w.Header().Set("Content-Type", exportFormat.ContentType)
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.Write(body)
+}
+
+// UpdateDocument handles PUT /v1/documents/{documentId}
+func (h *DocumentHandler) UpdateDocument(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	vars := mux.Vars(r)
 	documentID, err := strconv.Atoi(vars["documentId"])
 	if err != nil {
-		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
 		return
 	}
 
 	var docInput models.DocumentInput
 	if err := json.NewDecoder(r.Body).Decode(&docInput); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
 		return
 	}
 
-	var doc models.Document
-	err = h.dbService.ExecuteQueryRow(db.UpdateDocumentQuery,
-		[]interface{}{&doc.ID, &doc.UserID, &doc.Title, &doc.CreatedAt, &doc.UpdatedAt},
-		docInput.Title, documentID, userID)
+	// Editors can rename; changing who has access is reserved for the owner
+	role, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionEdit)
+	if !ok {
+		return
+	}
+	if len(docInput.AllowedUsers) > 0 && role < services.RoleOwner {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Only the owner can change sharing",
+			map[string]string{"permission": role.String(), "action": string(services.ActionShare)})
+		return
+	}
 
+	doc, err := h.store.Repos().Documents.UpdateTitle(r.Context(), documentID, docInput.Title)
 	if err != nil {
-		http.Error(w, "Document not found", http.StatusNotFound)
+		writeDBError(w, r, err, "Document not found")
 		return
 	}
 
 	// Update permissions if provided
+	response := documentResponse{Document: doc}
 	if len(docInput.AllowedUsers) > 0 {
 		// Get existing permissions
-		existingResults, err := h.dbService.ExecuteQuery(db.GetDocumentPermissionsQuery, documentID)
+		permissions := h.store.Repos().Permissions
+		existing, err := permissions.ForDocument(r.Context(), documentID)
 		if err != nil {
-			// Log error but continue
+			writeDBError(w, r, err, "Document not found")
+			return
 		}
 
 		// Create map of existing permissions
-		existingPerms := make(map[int64]string)
-		for _, result := range existingResults {
-			userID := result["user_id"].(int64)
-			permission := result["permission"].(string)
-			existingPerms[userID] = permission
+		existingPerms := make(map[int]string)
+		for _, permission := range existing {
+			existingPerms[permission.UserID] = permission.Permission
 		}
 
 		// Create map of new permissions
-		newPerms := make(map[int64]string)
+		newPerms := make(map[int]string)
 		for _, permission := range docInput.AllowedUsers {
-			newPerms[int64(permission.UserID)] = permission.Permission
+			newPerms[permission.UserID] = permission.Permission
 		}
 
 		// Add or update permissions
 		for userID, permission := range newPerms {
+			var err error
 			if existingPerm, exists := existingPerms[userID]; exists {
 				// Update if permission changed
 				if existingPerm != permission {
-					h.dbService.ExecuteNonQuery(db.UpdatePermissionQuery, permission, documentID, userID)
+					err = permissions.Update(r.Context(), documentID, userID, permission)
 				}
 			} else {
 				// Add new permission
-				h.dbService.ExecuteNonQuery(db.CreatePermissionQuery, documentID, userID, permission)
+				err = permissions.Create(r.Context(), documentID, userID, permission)
+			}
+			if err != nil {
+				response.FailedPermissions = append(response.FailedPermissions,
+					permissionFailure(models.Permission{UserID: userID, Permission: permission}, err))
 			}
 		}
 
-		// Remove permissions that are no longer in the new list
-		for userID := range existingPerms {
+		// Remove permissions that are no longer in the new list, keeping the owner's own row
+		for userID, permission := range existingPerms {
+			if userID == doc.UserID {
+				continue
+			}
 			if _, exists := newPerms[userID]; !exists {
-				h.dbService.ExecuteNonQuery(db.DeletePermissionQuery, documentID, userID)
+				if err := permissions.Delete(r.Context(), documentID, userID); err != nil {
+					response.FailedPermissions = append(response.FailedPermissions,
+						permissionFailure(models.Permission{UserID: userID, Permission: permission}, err))
+				}
 			}
 		}
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(doc)
+	json.NewEncoder(w).Encode(response)
 }
 
-// DeleteDocument handles DELETE /v1/documents/{userId}/{documentId}
+// DeleteDocument handles DELETE /v1/documents/{documentId}
+//
+// Moves the document to the owner's trash. Its content is kept until it is
+// purged, either from the trash or once the retention period has passed.
 func (h *DocumentHandler) DeleteDocument(w http.ResponseWriter, r *http.Request) {
-	vars := mux.Vars(r)
-	userID, err := strconv.Atoi(vars["userId"])
-	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+	userID, ok := requireUser(w, r)
+	if !ok {
 		return
 	}
 
+	vars := mux.Vars(r)
 	documentID, err := strconv.Atoi(vars["documentId"])
 	if err != nil {
-		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
 		return
 	}
 
-	// Get S3 key before deleting
-	results, err := h.dbService.ExecuteQuery(db.GetDocumentQuery, documentID, userID)
-	if err == nil && len(results) > 0 {
-		if s3Key, exists := results[0]["s3_key"]; exists && s3Key != nil {
-			// Delete from S3
-			h.s3Service.DeleteDocument(s3Key.(string))
-		}
-	}
-
-	rowsAffected, err := h.dbService.ExecuteNonQuery(db.DeleteDocumentQuery, documentID, userID)
-	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+	// Only the owner can delete
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionDelete); !ok {
 		return
 	}
 
-	if rowsAffected == 0 {
-		http.Error(w, "Document not found", http.StatusNotFound)
+	if err := h.store.Repos().Documents.Trash(r.Context(), documentID); err != nil {
+		writeDBError(w, r, err, "Document not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
 
-// UpdateDocumentContent handles PUT /v1/documents/{documentId}
+// UpdateDocumentContent handles PUT /v1/documents/{documentId}/content
 func (h *DocumentHandler) UpdateDocumentContent(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
 	vars := mux.Vars(r)
 	documentID, err := strconv.Atoi(vars["documentId"])
 	if err != nil {
-		http.Error(w, "Invalid document ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return
+	}
+
+	// Compaction rewrites content, so it needs edit access
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionEdit); !ok {
 		return
 	}
 
@@ -286,114 +621,162 @@ func (h *DocumentHandler) UpdateDocumentContent(w http.ResponseWriter, r *http.R
 	// Read request body (but we're not using it for operations processing)
 	_, err = io.ReadAll(r.Body)
 	if err != nil {
-		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Failed to read request body", nil)
 		return
 	}
 
 	// Check if document exists
-	results, err := h.dbService.ExecuteQuery(db.GetDocumentByIDQuery, documentID)
-	if err != nil || len(results) == 0 {
-		fmt.Printf("DEBUG: Document not found or query error: %v\n", err)
-		http.Error(w, "Document not found", http.StatusNotFound)
+	doc, err := h.store.Repos().Documents.Get(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
 		return
 	}
 
 	fmt.Printf("DEBUG: Document found in database\n")
 
-	// Get current content from S3 (if exists)
-	var currentContent string
-	if s3Key, exists := results[0]["s3_key"]; exists && s3Key != nil {
-		fmt.Printf("DEBUG: Found s3_key: %v\n", s3Key)
-		s3Content, err := h.s3Service.DownloadDocument(s3Key.(string))
-		if err != nil {
-			fmt.Printf("DEBUG: Error downloading from S3: %v\n", err)
-			currentContent = ""
-		} else {
-			currentContent = string(s3Content)
-			fmt.Printf("DEBUG: Downloaded content from S3, length: %d\n", len(currentContent))
-			fmt.Printf("DEBUG: Content: '%s'\n", currentContent)
+	// Replay pending operations on top of the S3 snapshot
+	current, err := materialize(r.Context(), h.s3Service, doc)
+	if err != nil {
+		fmt.Printf("DEBUG: Error materializing document: %v\n", err)
+		if _, _, _, ok := classifyContextError(err); ok {
+			writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to apply operations")
+			return
 		}
-	} else {
-		fmt.Println("DEBUG: No s3_key found, starting with empty content")
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to apply operations", err.Error())
+		return
 	}
+	documentContent := current.Content
+	fmt.Printf("DEBUG: Applied %d operations, final content length: %d\n", current.Pending, len(documentContent))
 
-	// Get operations from database
-	var operations []models.Operation
-	if operationsData, exists := results[0]["operations"]; exists && operationsData != nil {
-		operationsStr := operationsData.(string)
-		fmt.Printf("DEBUG: Operations from DB: %s\n", operationsStr)
-
-		if err := json.Unmarshal([]byte(operationsStr), &operations); err != nil {
-			fmt.Printf("DEBUG: Error parsing operations: %v\n", err)
-			http.Error(w, "Failed to parse operations", http.StatusInternalServerError)
-			return
+	// Store the final content and its formatting, and drop the operations it
+	// folds in; unchanged content maps to the existing snapshots
+	text, rich, err := h.storeSnapshots(r.Context(), documentID, documentContent, current.Delta, func(repos repository.Repos) error {
+		err := repos.Operations.Clear(r.Context(), documentID, doc.Version, current.Pending)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errCompactionConflict
+		}
+		return err
+	})
+	if err != nil {
+		fmt.Printf("DEBUG: Error storing snapshots of document %d: %v\n", documentID, err)
+		switch {
+		case errors.Is(err, errSnapshotUpload):
+			writeStorageError(w, r, err, http.StatusBadGateway, "Failed to upload to S3")
+		case errors.Is(err, errCompactionConflict):
+			// Nothing was recorded, so drop what this attempt uploaded unless it is in use
+			h.releaseSnapshots(r.Context(), text.Key, rich.Key)
+			writeError(w, r, http.StatusConflict, CodeConflict, "Document was compacted by another request", nil)
+		default:
+			writeDBError(w, r, err, "Document not found")
 		}
-		fmt.Printf("DEBUG: Parsed %d operations\n", len(operations))
-	} else {
-		fmt.Println("DEBUG: No operations found in database")
+		return
 	}
+	fmt.Printf("DEBUG: Uploaded to S3 with key: %s\n", text.Key)
 
-	// Apply operations to content (forward order)
-	documentContent := currentContent
-	fmt.Printf("DEBUG: Starting content: '%s'\n", documentContent)
-
-	for i := 0; i < len(operations); i++ {
-		operation := operations[i]
-		fmt.Printf("DEBUG: Applying operation %d: type=%s, pos=%d, text='%s', len=%d\n",
-			i, operation.Type, operation.Position, operation.Text, operation.Length)
+	h.indexContent(r.Context(), documentID, documentContent)
 
-		beforeContent := documentContent
-		documentContent = h.applyOperation(documentContent, operation)
-		fmt.Printf("DEBUG: Content changed from '%s' to '%s'\n", beforeContent, documentContent)
+	// Drop the snapshots this compaction replaced
+	var replaced []string
+	for _, key := range snapshotKeys(doc) {
+		if key != text.Key && key != rich.Key {
+			replaced = append(replaced, key)
+		}
 	}
+	h.releaseSnapshots(r.Context(), replaced...)
 
-	fmt.Printf("DEBUG: Final content: '%s'\n", documentContent)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": "Document updated successfully in S3",
+		"version": current.Version,
+	})
+}
 
-	// Upload final content to S3
-	s3Key, err := h.s3Service.UploadDocument(documentID, []byte(documentContent))
-	if err != nil {
-		fmt.Printf("DEBUG: Error uploading to S3: %v\n", err)
-		http.Error(w, "Failed to upload to S3", http.StatusInternalServerError)
-		return
+// snapshotKeys returns the content keys a document points at
+func snapshotKeys(doc models.DocumentRecord) []string {
+	var keys []string
+	for _, key := range []string{doc.S3Key, doc.DeltaKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// releaseSnapshots deletes stored content no document refers to any more.
+// Failures only leave an orphaned object behind, so they are logged. Each key
+// is counted and deleted under its exclusive snapshot lock, so a document
+// storing identical content at the same moment either is counted or uploads
+// the object again after it is gone. The row change has already been made, so
+// the cleanup carries on if the client goes away.
+func (h *DocumentHandler) releaseSnapshots(ctx context.Context, keys ...string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, key := range keys {
+		if err := h.releaseSnapshot(ctx, key); err != nil {
+			fmt.Printf("DEBUG: Error releasing %s: %v\n", key, err)
+		}
 	}
-	fmt.Printf("DEBUG: Uploaded to S3 with key: %s\n", s3Key)
+}
 
-	// Update database with S3 key
-	_, err = h.dbService.ExecuteNonQuery(db.UpdateDocumentS3KeyQuery, s3Key, documentID)
+// releaseSnapshot deletes one snapshot if nothing refers to it
+func (h *DocumentHandler) releaseSnapshot(ctx context.Context, key string) error {
+	tx, err := h.store.BeginExtended(ctx, h.s3Service.Timeout())
 	if err != nil {
-		fmt.Printf("DEBUG: Error updating S3 key in DB: %v\n", err)
-		http.Error(w, "Failed to update document", http.StatusInternalServerError)
-		return
+		return err
 	}
+	defer tx.Rollback()
 
-	// Clear operations from database after successful S3 upload
-	_, err = h.dbService.ExecuteNonQuery(db.ClearDocumentOperationsQuery, documentID)
+	documents := tx.Repos().Documents
+	if err := documents.LockSnapshotForDelete(ctx, key); err != nil {
+		return err
+	}
+	references, err := documents.SnapshotReferences(ctx, key)
 	if err != nil {
-		fmt.Printf("DEBUG: Error clearing operations: %v\n", err)
-		http.Error(w, "Failed to clear operations", http.StatusInternalServerError)
-		return
+		return err
+	}
+	if references > 0 {
+		return nil
+	}
+	if err := h.s3Service.DeleteDocument(ctx, key); err != nil {
+		return err
 	}
+	return tx.Commit()
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Document updated successfully in S3"})
+// materializedDocument is the current state of a document: its S3 snapshot with
+// the pending operations replayed on top
+type materializedDocument struct {
+	Content string       // plain text
+	Delta   models.Delta // the same text with formatting
+	Version int          // snapshot version plus the pending operations
+	Pending int          // number of operations applied on top of the snapshot
 }
 
-// applyOperation applies a single operation to the document content
-func (h *DocumentHandler) applyOperation(content string, operation models.Operation) string {
-	contentRunes := []rune(content)
+// materialize rebuilds the current document text from a stored document using
+// the same engine as compaction
+func materialize(ctx context.Context, s3Service *services.S3Service, doc models.DocumentRecord) (materializedDocument, error) {
+	var current materializedDocument
 
-	switch operation.Type {
-	case "insert":
-		if operation.Position >= 0 && operation.Position <= len(contentRunes) {
-			result := string(contentRunes[:operation.Position]) + operation.Text + string(contentRunes[operation.Position:])
-			return result
+	// Prefer the rich-text snapshot; documents compacted before it existed only have plain text
+	snapshot := services.DeltaFromText("")
+	if doc.DeltaKey != "" {
+		data, err := s3Service.DownloadDocument(ctx, doc.DeltaKey, doc.DeltaSHA256)
+		if err != nil {
+			return current, err
 		}
-	case "delete":
-		start := operation.Position
-		end := start + operation.Length
-		if start >= 0 && start <= len(contentRunes) && end <= len(contentRunes) {
-			return string(contentRunes[:start]) + string(contentRunes[end:])
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return current, fmt.Errorf("failed to parse document delta: %w", err)
 		}
+	} else if doc.S3Key != "" {
+		content, err := s3Service.DownloadDocument(ctx, doc.S3Key, doc.ContentSHA256)
+		if err != nil {
+			return current, err
+		}
+		snapshot = services.DeltaFromText(string(content))
 	}
-	return content
+
+	current.Delta = services.ApplyRichOperations(snapshot, doc.Operations)
+	current.Content = services.PlainText(current.Delta)
+	current.Pending = len(doc.Operations)
+	current.Version = doc.Version + current.Pending
+	return current, nil
 }
@@ -0,0 +1,150 @@
+package handlers
+
+import (
+	"Draftly/CRUD/middleware"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lib/pq"
+)
+
+// Error codes returned in the error envelope
+const (
+	CodeInvalidJSON        = "invalid_json"
+	CodeInvalidArgument    = "invalid_argument"
+	CodeNotFound           = "not_found"
+	CodeConflict           = "conflict"
+	CodeInvalidRef         = "invalid_reference"
+	CodeUnprocessable      = "unprocessable"
+	CodeInternal           = "internal"
+	CodeUnauthorized       = "unauthorized"
+	CodeInvalidCredentials = "invalid_credentials"
+	CodeForbidden          = "forbidden"
+	CodeMethodNotAllowed   = "method_not_allowed"
+	CodeGone               = "gone"
+	CodePayloadTooLarge    = "payload_too_large"
+	CodeUnsupportedMedia   = "unsupported_media_type"
+	CodeTimeout            = "timeout"
+	CodeCanceled           = "canceled"
+)
+
+// statusClientClosedRequest is the non-standard status (from nginx) recorded
+// when the client went away before the response was ready
+const statusClientClosedRequest = 499
+
+// Postgres error codes we translate into client errors
+const (
+	pqUniqueViolation     = "23505"
+	pqForeignKeyViolation = "23503"
+	pqCheckViolation      = "23514"
+	pqNotNullViolation    = "23502"
+	pqInvalidTextRepr     = "22P02"
+)
+
+// writeError writes the JSON error envelope with the request ID attached
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(models.ErrorResponse{
+		Error: models.APIError{
+			Code:      code,
+			Message:   message,
+			Details:   details,
+			RequestID: middleware.RequestIDFromContext(r.Context()),
+		},
+	})
+}
+
+// writeDBError maps a database error onto the matching HTTP status. notFound is
+// used as the message when the query matched no rows.
+func writeDBError(w http.ResponseWriter, r *http.Request, err error, notFound string) {
+	status, code, message, details := classifyDBError(err, notFound)
+	if status >= http.StatusInternalServerError {
+		fmt.Printf("DEBUG: Database error: %v\n", err)
+	}
+	writeError(w, r, status, code, message, details)
+}
+
+// classifyDBError translates sql and Postgres errors into an HTTP status, error code,
+// message and details
+func classifyDBError(err error, notFound string) (int, string, string, interface{}) {
+	if status, code, message, ok := classifyContextError(err); ok {
+		return status, code, message, nil
+	}
+	if errors.Is(err, sql.ErrNoRows) {
+		return http.StatusNotFound, CodeNotFound, notFound, nil
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		details := map[string]string{}
+		if pqErr.Constraint != "" {
+			details["constraint"] = pqErr.Constraint
+		}
+		if pqErr.Column != "" {
+			details["column"] = pqErr.Column
+		}
+		if pqErr.Detail != "" {
+			details["detail"] = pqErr.Detail
+		}
+
+		switch string(pqErr.Code) {
+		case pqUniqueViolation:
+			return http.StatusConflict, CodeConflict, "Resource already exists", details
+		case pqForeignKeyViolation:
+			return http.StatusUnprocessableEntity, CodeInvalidRef, "Referenced resource does not exist", details
+		case pqCheckViolation, pqNotNullViolation, pqInvalidTextRepr:
+			return http.StatusUnprocessableEntity, CodeUnprocessable, "Invalid value", details
+		}
+	}
+
+	return http.StatusInternalServerError, CodeInternal, "Database error", nil
+}
+
+// writeStorageError writes a document storage failure. Timeouts and
+// cancellations are reported as such; anything else gets status and message.
+func writeStorageError(w http.ResponseWriter, r *http.Request, err error, status int, message string) {
+	if contextStatus, code, contextMessage, ok := classifyContextError(err); ok {
+		writeError(w, r, contextStatus, code, contextMessage, nil)
+		return
+	}
+	writeError(w, r, status, CodeInternal, message, nil)
+}
+
+// classifyContextError recognises calls cut short by a timeout or by the client
+// disconnecting
+func classifyContextError(err error) (int, string, string, bool) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeTimeout, "The request timed out", true
+	case errors.Is(err, context.Canceled):
+		return statusClientClosedRequest, CodeCanceled, "The request was canceled", true
+	}
+	return 0, "", "", false
+}
+
+// permissionFailure builds the partial-failure entry for a permission that could not be applied
+func permissionFailure(permission models.Permission, err error) models.PermissionFailure {
+	_, code, message, _ := classifyDBError(err, "User not found")
+	return models.PermissionFailure{
+		UserID:     permission.UserID,
+		Permission: permission.Permission,
+		Code:       code,
+		Message:    message,
+	}
+}
+
+// NotFound is the router fallback for unknown routes
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, CodeNotFound, "Route not found", r.URL.Path)
+}
+
+// MethodNotAllowed is the router fallback for known routes called with the wrong method
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusMethodNotAllowed, CodeMethodNotAllowed, "Method not allowed", r.Method)
+}
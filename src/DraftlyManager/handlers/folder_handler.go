@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
+	"Draftly/CRUD/services"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maxFolderNameLength matches Folders.name
+const maxFolderNameLength = 255
+
+type FolderHandler struct {
+	store         repository.Store
+	accessService *services.AccessService
+}
+
+func NewFolderHandler(store repository.Store, accessService *services.AccessService) *FolderHandler {
+	return &FolderHandler{
+		store:         store,
+		accessService: accessService,
+	}
+}
+
+// CreateFolder handles POST /v1/folders
+//
+// Subfolders can only be created in folders the caller owns.
+func (h *FolderHandler) CreateFolder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.FolderInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	name, ok := folderName(w, r, input.Name)
+	if !ok {
+		return
+	}
+
+	if input.ParentID != nil && !h.requireOwnedTarget(w, r, *input.ParentID, userID, "Subfolders can only be created in folders you own") {
+		return
+	}
+
+	folder, err := h.store.Repos().Folders.Create(r.Context(), userID, input.ParentID, name)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	folder.Permission = services.RoleOwner.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(folder)
+}
+
+// ListFolders handles GET /v1/folders
+//
+// Returns the caller's top-level folders and the folders shared with them, each
+// with every folder and document beneath it.
+func (h *FolderHandler) ListFolders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	folders := h.store.Repos().Folders
+	roots, err := folders.Roots(r.Context(), userID)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+
+	trees, err := h.folderTrees(r, userID, roots)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trees)
+}
+
+// GetFolder handles GET /v1/folders/{folderId}
+//
+// Returns the folder with every folder and document beneath it.
+func (h *FolderHandler) GetFolder(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	role, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionRead)
+	if !ok {
+		return
+	}
+
+	folder, err := h.store.Repos().Folders.Get(r.Context(), folderID)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	folder.Permission = role.String()
+
+	trees, err := h.folderTrees(r, userID, []models.Folder{folder})
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trees[0])
+}
+
+// RenameFolder handles PATCH /v1/folders/{folderId}
+func (h *FolderHandler) RenameFolder(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.FolderInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	name, ok := folderName(w, r, input.Name)
+	if !ok {
+		return
+	}
+
+	role, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionEdit)
+	if !ok {
+		return
+	}
+
+	folder, err := h.store.Repos().Folders.Rename(r.Context(), folderID, name)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	folder.Permission = role.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folder)
+}
+
+// MoveFolder handles PUT /v1/folders/{folderId}/parent
+//
+// Files the folder in another folder with the same owner, or at the top level
+// when folderId is null.
+func (h *FolderHandler) MoveFolder(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.FolderMoveInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+
+	if _, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionMove); !ok {
+		return
+	}
+	if input.FolderID != nil && !h.requireOwnedTarget(w, r, *input.FolderID, userID, "Folders can only be moved into folders you own") {
+		return
+	}
+
+	// Check for cycles and move under the tree lock so two moves cannot race
+	tx, err := h.store.Begin(r.Context())
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	defer tx.Rollback()
+
+	folders := tx.Repos().Folders
+	if err := folders.LockTree(r.Context(), userID); err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	if input.FolderID != nil {
+		within, err := folders.IsWithin(r.Context(), folderID, *input.FolderID)
+		if err != nil {
+			writeDBError(w, r, err, "Folder not found")
+			return
+		}
+		if within {
+			writeError(w, r, http.StatusConflict, CodeConflict, "A folder cannot be moved into itself or its subfolders", nil)
+			return
+		}
+	}
+
+	folder, err := folders.Move(r.Context(), folderID, input.FolderID)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+	folder.Permission = services.RoleOwner.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(folder)
+}
+
+// DeleteFolder handles DELETE /v1/folders/{folderId}
+//
+// Only empty folders can be deleted.
+func (h *FolderHandler) DeleteFolder(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionDelete); !ok {
+		return
+	}
+
+	// The folder exists, so matching no row means it still has something in it
+	err := h.store.Repos().Folders.Delete(r.Context(), folderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, http.StatusConflict, CodeConflict, "Folder must be empty to be deleted", nil)
+		return
+	}
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// MoveDocument handles PUT /v1/documents/{documentId}/folder
+//
+// Files the document in one of its owner's folders, or at the top level when
+// folderId is null. Moving changes the access the document inherits, so only
+// the owner can do it.
+func (h *FolderHandler) MoveDocument(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+	documentID, err := strconv.Atoi(mux.Vars(r)["documentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return
+	}
+
+	var input models.FolderMoveInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionMove); !ok {
+		return
+	}
+	if input.FolderID != nil && !h.requireOwnedTarget(w, r, *input.FolderID, userID, "Documents can only be moved into folders you own") {
+		return
+	}
+
+	doc, err := h.store.Repos().Documents.Move(r.Context(), documentID, input.FolderID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	doc.Permission = services.RoleOwner.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// ListFolderPermissions handles GET /v1/folders/{folderId}/permissions
+//
+// Lists the users the folder itself is shared with. Access inherited from the
+// folders above it is listed on those folders.
+func (h *FolderHandler) ListFolderPermissions(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionRead); !ok {
+		return
+	}
+
+	collaborators, err := h.store.Repos().Folders.Collaborators(r.Context(), folderID)
+	if err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborators)
+}
+
+// ShareFolder handles POST /v1/folders/{folderId}/permissions
+//
+// Grants a user access to the folder and everything beneath it, replacing the
+// permission they already hold on it.
+func (h *FolderHandler) ShareFolder(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.ShareInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if input.Email == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Email is required", nil)
+		return
+	}
+	if !models.ValidPermission(input.Permission) {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Invalid permission",
+			map[string]interface{}{"permission": input.Permission, "allowed": models.GrantablePermissions})
+		return
+	}
+
+	if _, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	user, err := h.store.Repos().Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		writeDBError(w, r, err, "No user with that email")
+		return
+	}
+	// Only the owner can share, so the caller is the owner
+	if user.ID == userID {
+		writeError(w, r, http.StatusConflict, CodeConflict, "The owner already has full access", nil)
+		return
+	}
+
+	if err := h.store.Repos().Folders.Share(r.Context(), folderID, user.ID, input.Permission); err != nil {
+		writeDBError(w, r, err, "Folder not found")
+		return
+	}
+
+	collaborator := models.Collaborator{
+		UserID:     user.ID,
+		Name:       user.Name,
+		Email:      user.Email,
+		Permission: input.Permission,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborator)
+}
+
+// UnshareFolder handles DELETE /v1/folders/{folderId}/permissions/{userId}
+//
+// The owner can revoke anyone; collaborators can remove themselves.
+func (h *FolderHandler) UnshareFolder(w http.ResponseWriter, r *http.Request) {
+	userID, folderID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid user ID", nil)
+		return
+	}
+
+	action := services.ActionShare
+	if targetID == userID {
+		action = services.ActionRead
+	}
+	if _, ok := authorizeFolder(w, r, h.accessService, folderID, userID, action); !ok {
+		return
+	}
+
+	if err := h.store.Repos().Folders.Unshare(r.Context(), folderID, targetID); err != nil {
+		writeDBError(w, r, err, "Folder is not shared with that user")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// requireOwnedTarget checks that a folder something is being filed in exists,
+// is visible to the caller and is owned by them
+func (h *FolderHandler) requireOwnedTarget(w http.ResponseWriter, r *http.Request, folderID, userID int, message string) bool {
+	role, ok := authorizeFolder(w, r, h.accessService, folderID, userID, services.ActionRead)
+	if !ok {
+		return false
+	}
+	if role != services.RoleOwner {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, message, map[string]string{"permission": role.String()})
+		return false
+	}
+	return true
+}
+
+// folderTrees loads everything beneath the given folders and assembles it into
+// trees. Roots that also appear beneath another root are only listed there.
+// Permissions are the caller's effective access: the highest of what they hold
+// directly and what they inherit from the folder above.
+func (h *FolderHandler) folderTrees(r *http.Request, userID int, roots []models.Folder) ([]models.FolderTree, error) {
+	folders := h.store.Repos().Folders
+	rootIDs := make([]int, len(roots))
+	for i, root := range roots {
+		rootIDs[i] = root.ID
+	}
+
+	subtree, err := folders.Subtree(r.Context(), rootIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	folderIDs := append([]int{}, rootIDs...)
+	children := map[int][]models.Folder{}
+	nested := map[int]bool{}
+	for _, folder := range subtree {
+		folderIDs = append(folderIDs, folder.ID)
+		children[*folder.ParentID] = append(children[*folder.ParentID], folder)
+		nested[folder.ID] = true
+	}
+
+	documents, err := folders.Documents(r.Context(), folderIDs, userID)
+	if err != nil {
+		return nil, err
+	}
+	filed := map[int][]models.Document{}
+	for _, doc := range documents {
+		filed[*doc.FolderID] = append(filed[*doc.FolderID], doc)
+	}
+
+	var build func(folder models.Folder, inherited services.Role) models.FolderTree
+	build = func(folder models.Folder, inherited services.Role) models.FolderTree {
+		role := max(inherited, services.RoleFromPermission(folder.Permission))
+		folder.Permission = role.String()
+		tree := models.FolderTree{Folder: folder, Folders: []models.FolderTree{}, Documents: []models.Document{}}
+		for _, child := range children[folder.ID] {
+			tree.Folders = append(tree.Folders, build(child, role))
+		}
+		for _, doc := range filed[folder.ID] {
+			doc.Permission = max(role, services.RoleFromPermission(doc.Permission)).String()
+			tree.Documents = append(tree.Documents, doc)
+		}
+		return tree
+	}
+
+	trees := []models.FolderTree{}
+	for _, root := range roots {
+		if !nested[root.ID] {
+			trees = append(trees, build(root, services.RoleNone))
+		}
+	}
+	return trees, nil
+}
+
+func (h *FolderHandler) parseRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	folderID, err := strconv.Atoi(mux.Vars(r)["folderId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid folder ID", nil)
+		return 0, 0, false
+	}
+	return userID, folderID, true
+}
+
+// folderName validates and trims a folder name
+func folderName(w http.ResponseWriter, r *http.Request, name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Name is required", nil)
+		return "", false
+	}
+	if len([]rune(name)) > maxFolderNameLength {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Name must be at most 255 characters", nil)
+		return "", false
+	}
+	return name, true
+}
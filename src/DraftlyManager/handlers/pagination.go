@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"Draftly/CRUD/db"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// NextCursorHeader carries the cursor for the next page of a listing. The same
+// page is also linked from the Link header with rel="next".
+const NextCursorHeader = "X-Next-Cursor"
+
+// pageCursor is the keyset position handed to clients as an opaque string. It
+// records the sort it was issued for so it cannot be replayed against another order.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Desc  bool   `json:"d"`
+	Value string `json:"v"`
+	ID    int    `json:"id"`
+}
+
+func encodeCursor(cursor pageCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(encoded string) (pageCursor, error) {
+	var cursor pageCursor
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cursor, errors.New("malformed cursor")
+	}
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return cursor, errors.New("malformed cursor")
+	}
+	return cursor, nil
+}
+
+// parseLimit reads the limit query parameter, defaulting to defaultPageSize
+func parseLimit(r *http.Request) (int, error) {
+	raw := r.URL.Query().Get("limit")
+	if raw == "" {
+		return defaultPageSize, nil
+	}
+	limit, err := strconv.Atoi(raw)
+	if err != nil || limit < 1 || limit > maxPageSize {
+		return 0, errors.New("limit must be between 1 and 100")
+	}
+	return limit, nil
+}
+
+// parsePage reads the sort, order, limit and cursor query parameters of a
+// listing. sorts are the accepted sort keys, the first being the default;
+// textSort is the one key ordered alphabetically by default, the rest being
+// timestamps listed newest first. Limit is one more than the page size so the
+// caller can tell whether a next page exists.
+func parsePage(r *http.Request, textSort string, sorts ...string) (db.Page, int, error) {
+	query := r.URL.Query()
+	page := db.Page{Sort: query.Get("sort")}
+
+	if page.Sort == "" {
+		page.Sort = sorts[0]
+	}
+	valid := false
+	for _, sort := range sorts {
+		valid = valid || page.Sort == sort
+	}
+	if !valid {
+		return page, 0, fmt.Errorf("sort must be one of %s", strings.Join(sorts, ", "))
+	}
+
+	switch query.Get("order") {
+	case "":
+		page.Desc = page.Sort != textSort
+	case "asc":
+		page.Desc = false
+	case "desc":
+		page.Desc = true
+	default:
+		return page, 0, errors.New("order must be asc or desc")
+	}
+
+	limit, err := parseLimit(r)
+	if err != nil {
+		return page, 0, err
+	}
+	page.Limit = limit + 1
+
+	if raw := query.Get("cursor"); raw != "" {
+		cursor, err := decodeCursor(raw)
+		if err != nil || cursor.Sort != page.Sort || cursor.Desc != page.Desc {
+			return page, 0, errors.New("Invalid cursor for this sort order")
+		}
+		page.AfterValue = cursor.Value
+		page.AfterID = cursor.ID
+		page.HasCursor = true
+	}
+	return page, limit, nil
+}
+
+// pageCursorAfter builds the cursor resuming a listing after the given row
+func pageCursorAfter(page db.Page, id int, sortValue interface{}) pageCursor {
+	cursor := pageCursor{Sort: page.Sort, Desc: page.Desc, ID: id}
+	switch value := sortValue.(type) {
+	case time.Time:
+		cursor.Value = value.Format(time.RFC3339Nano)
+	case string:
+		cursor.Value = value
+	}
+	return cursor
+}
+
+// setNextPage points the client at the next page, both as a bare cursor in
+// X-Next-Cursor and as a Link to the same request with that cursor
+func setNextPage(w http.ResponseWriter, r *http.Request, cursor pageCursor) {
+	encoded := encodeCursor(cursor)
+	next := *r.URL
+	query := next.Query()
+	query.Set("cursor", encoded)
+	next.RawQuery = query.Encode()
+
+	w.Header().Set(NextCursorHeader, encoded)
+	w.Header().Set("Link", fmt.Sprintf(`<%s>; rel="next"`, next.RequestURI()))
+}
@@ -0,0 +1,353 @@
+package handlers
+
+import (
+	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
+	"Draftly/CRUD/services"
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+type PermissionHandler struct {
+	store         repository.Store
+	accessService *services.AccessService
+}
+
+func NewPermissionHandler(store repository.Store, accessService *services.AccessService) *PermissionHandler {
+	return &PermissionHandler{
+		store:         store,
+		accessService: accessService,
+	}
+}
+
+// ListPermissions handles GET /v1/documents/{documentId}/permissions
+func (h *PermissionHandler) ListPermissions(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	// Anyone who can read the document can see who else has access
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead); !ok {
+		return
+	}
+
+	ownerID, err := h.accessService.OwnerID(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	collaborators, err := h.store.Repos().Permissions.Collaborators(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	for i := range collaborators {
+		if collaborators[i].UserID == ownerID {
+			collaborators[i].Permission = models.PermissionOwner
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborators)
+}
+
+// SharePermission handles POST /v1/documents/{documentId}/permissions
+func (h *PermissionHandler) SharePermission(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.ShareInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if input.Email == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Email is required", nil)
+		return
+	}
+	if !models.ValidPermission(input.Permission) {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Invalid permission",
+			map[string]interface{}{"permission": input.Permission, "allowed": models.GrantablePermissions})
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	// Look up the recipient and grant access in one transaction so a concurrent
+	// ownership change or duplicate share cannot interleave
+	tx, err := h.store.Begin(r.Context())
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	defer tx.Rollback()
+
+	ownerID, err := tx.Repos().Documents.Lock(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	user, err := tx.Repos().Users.GetByEmail(r.Context(), input.Email)
+	if err != nil {
+		writeDBError(w, r, err, "No user with that email")
+		return
+	}
+	if user.ID == ownerID {
+		writeError(w, r, http.StatusConflict, CodeConflict, "The owner already has full access", nil)
+		return
+	}
+
+	if err := tx.Repos().Permissions.Create(r.Context(), documentID, user.ID, input.Permission); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	collaborator := models.Collaborator{
+		UserID:     user.ID,
+		Name:       user.Name,
+		Email:      user.Email,
+		Permission: input.Permission,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(collaborator)
+}
+
+// UpdatePermission handles PATCH /v1/documents/{documentId}/permissions/{userId}
+func (h *PermissionHandler) UpdatePermission(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid user ID", nil)
+		return
+	}
+
+	var input models.PermissionInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if !models.ValidPermission(input.Permission) {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Invalid permission",
+			map[string]interface{}{"permission": input.Permission, "allowed": models.GrantablePermissions})
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	tx, err := h.store.Begin(r.Context())
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	defer tx.Rollback()
+
+	ownerID, err := tx.Repos().Documents.Lock(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	if targetID == ownerID {
+		writeError(w, r, http.StatusConflict, CodeConflict, "The owner's access cannot be changed", nil)
+		return
+	}
+
+	if err := tx.Repos().Permissions.Update(r.Context(), documentID, targetID, input.Permission); err != nil {
+		writeDBError(w, r, err, "Document is not shared with that user")
+		return
+	}
+
+	user, err := tx.Repos().Users.Get(r.Context(), targetID)
+	if err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	collaborator := models.Collaborator{
+		UserID:     user.ID,
+		Name:       user.Name,
+		Email:      user.Email,
+		Permission: input.Permission,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(collaborator)
+}
+
+// RevokePermission handles DELETE /v1/documents/{documentId}/permissions/{userId}
+//
+// The owner can revoke anyone; collaborators can remove themselves.
+func (h *PermissionHandler) RevokePermission(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	targetID, err := strconv.Atoi(mux.Vars(r)["userId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid user ID", nil)
+		return
+	}
+
+	action := services.ActionShare
+	if targetID == userID {
+		action = services.ActionRead
+	}
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, action); !ok {
+		return
+	}
+
+	tx, err := h.store.Begin(r.Context())
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	defer tx.Rollback()
+
+	ownerID, err := tx.Repos().Documents.Lock(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	if targetID == ownerID {
+		writeError(w, r, http.StatusConflict, CodeConflict, "The owner's access cannot be revoked", nil)
+		return
+	}
+
+	if err := tx.Repos().Permissions.Delete(r.Context(), documentID, targetID); err != nil {
+		writeDBError(w, r, err, "Document is not shared with that user")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TransferOwnership handles PUT /v1/documents/{documentId}/owner
+//
+// The new owner is promoted to full access and the previous owner stays on the
+// document as an editor.
+func (h *PermissionHandler) TransferOwnership(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.OwnershipInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if input.UserID == 0 && input.Email == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "userId or email is required", nil)
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	tx, err := h.store.Begin(r.Context())
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	defer tx.Rollback()
+
+	ownerID, err := tx.Repos().Documents.Lock(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	// Ownership may have moved between the access check and the lock
+	if ownerID != userID {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "Only the owner can transfer the document", nil)
+		return
+	}
+
+	var user models.User
+	if input.UserID != 0 {
+		user, err = tx.Repos().Users.Get(r.Context(), input.UserID)
+	} else {
+		user, err = tx.Repos().Users.GetByEmail(r.Context(), input.Email)
+	}
+	if err != nil {
+		writeDBError(w, r, err, "New owner not found")
+		return
+	}
+	if user.ID == ownerID {
+		writeError(w, r, http.StatusConflict, CodeConflict, "User already owns the document", nil)
+		return
+	}
+
+	document, err := tx.Repos().Documents.TransferOwner(r.Context(), documentID, user.ID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	// Promote the new owner and keep the previous owner as an editor
+	if err := tx.Repos().Permissions.Upsert(r.Context(), documentID, user.ID, models.PermissionEdit); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	if err := tx.Repos().Permissions.Upsert(r.Context(), documentID, ownerID, models.PermissionEdit); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	// The caller is now an editor
+	document.Permission = models.PermissionEdit
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(document)
+}
+
+// parseRequest returns the authenticated user and the document ID from the path
+func (h *PermissionHandler) parseRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	documentID, err := strconv.Atoi(mux.Vars(r)["documentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return 0, 0, false
+	}
+	return userID, documentID, true
+}
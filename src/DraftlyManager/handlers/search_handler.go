@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"Draftly/CRUD/repository"
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// maxSearchQueryLength bounds the q parameter of a search
+const maxSearchQueryLength = 256
+
+type SearchHandler struct {
+	store repository.Store
+}
+
+func NewSearchHandler(store repository.Store) *SearchHandler {
+	return &SearchHandler{store: store}
+}
+
+// Search handles GET /v1/search
+//
+// Searches the titles and contents of the documents the caller can access.
+// Query parameters: q (words, "quoted phrases", -excluded words, or) and limit.
+// Contents are searched as of each document's last compaction.
+func (h *SearchHandler) Search(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "q is required", nil)
+		return
+	}
+	if len(query) > maxSearchQueryLength {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "q must be at most 256 characters", nil)
+		return
+	}
+	limit, err := parseLimit(r)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, err.Error(), nil)
+		return
+	}
+
+	hits, err := h.store.Repos().Search.Search(r.Context(), userID, query, limit)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(hits)
+}
@@ -0,0 +1,190 @@
+package handlers
+
+import (
+	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
+	"Draftly/CRUD/services"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+type ShareLinkHandler struct {
+	store         repository.Store
+	s3Service     *services.S3Service
+	accessService *services.AccessService
+}
+
+func NewShareLinkHandler(store repository.Store, s3Service *services.S3Service, accessService *services.AccessService) *ShareLinkHandler {
+	return &ShareLinkHandler{
+		store:         store,
+		s3Service:     s3Service,
+		accessService: accessService,
+	}
+}
+
+// CreateShareLink handles POST /v1/documents/{documentId}/links
+func (h *ShareLinkHandler) CreateShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.ShareLinkInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if !models.ValidLinkPermission(input.Permission) {
+		writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "Invalid permission",
+			map[string]interface{}{"permission": input.Permission, "allowed": models.GrantablePermissions})
+		return
+	}
+
+	var expiresAt *time.Time
+	if input.ExpiresAt != nil {
+		if !input.ExpiresAt.After(time.Now()) {
+			writeError(w, r, http.StatusUnprocessableEntity, CodeUnprocessable, "expiresAt must be in the future", nil)
+			return
+		}
+		utc := input.ExpiresAt.UTC()
+		expiresAt = &utc
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	token, err := services.NewShareLinkToken()
+	if err != nil {
+		fmt.Printf("DEBUG: Failed to generate share link token: %v\n", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create share link", nil)
+		return
+	}
+
+	link, err := h.store.Repos().ShareLinks.Create(r.Context(), documentID,
+		services.HashShareLinkToken(token), input.Permission, userID, expiresAt)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	link.Token = token
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(link)
+}
+
+// ListShareLinks handles GET /v1/documents/{documentId}/links
+func (h *ShareLinkHandler) ListShareLinks(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	links, err := h.store.Repos().ShareLinks.ForDocument(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(links)
+}
+
+// RevokeShareLink handles DELETE /v1/documents/{documentId}/links/{linkId}
+func (h *ShareLinkHandler) RevokeShareLink(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := h.parseRequest(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, err := strconv.Atoi(mux.Vars(r)["linkId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid link ID", nil)
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	if err := h.store.Repos().ShareLinks.Revoke(r.Context(), linkID, documentID); err != nil {
+		writeDBError(w, r, err, "Share link not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ResolveShareLink handles GET /v1/share-links/{token}
+//
+// The token is the credential, so this route does not require a session.
+// Revoked and expired links return 410.
+func (h *ShareLinkHandler) ResolveShareLink(w http.ResponseWriter, r *http.Request) {
+	token := mux.Vars(r)["token"]
+
+	link, err := h.store.Repos().ShareLinks.GetByTokenHash(r.Context(), services.HashShareLinkToken(token))
+	if err != nil {
+		writeDBError(w, r, err, "Share link not found")
+		return
+	}
+	if link.RevokedAt != nil {
+		writeError(w, r, http.StatusGone, CodeGone, "Share link has been revoked", nil)
+		return
+	}
+	if link.ExpiresAt != nil && !link.ExpiresAt.After(time.Now()) {
+		writeError(w, r, http.StatusGone, CodeGone, "Share link has expired", nil)
+		return
+	}
+
+	doc, err := h.store.Repos().Documents.Get(r.Context(), link.DocumentID)
+	if err != nil {
+		writeDBError(w, r, err, "Share link not found")
+		return
+	}
+
+	current, err := materialize(r.Context(), h.s3Service, doc)
+	if err != nil {
+		fmt.Printf("DEBUG: Error materializing document %d: %v\n", link.DocumentID, err)
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to load document content")
+		return
+	}
+
+	resolved := models.ResolvedShareLink{
+		DocumentID: link.DocumentID,
+		Permission: link.Permission,
+		ExpiresAt:  link.ExpiresAt,
+		Title:      doc.Title,
+		Content:    current.Content,
+		Version:    current.Version,
+	}
+
+	// Link holders are not tied to a session, so never cache the content
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resolved)
+}
+
+// parseRequest returns the authenticated user and the document ID from the path
+func (h *ShareLinkHandler) parseRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	documentID, err := strconv.Atoi(mux.Vars(r)["documentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return 0, 0, false
+	}
+	return userID, documentID, true
+}
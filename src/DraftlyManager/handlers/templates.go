@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"Draftly/CRUD/models"
+	"Draftly/CRUD/services"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// duplicateResponse is a new copy of a document along with the template
+// placeholders that were left unfilled
+type duplicateResponse struct {
+	documentResponse
+	UnfilledPlaceholders []string `json:"unfilledPlaceholders,omitempty"`
+}
+
+// DuplicateDocument handles POST /v1/documents/{documentId}/duplicate
+//
+// Creates a new document owned by the caller from the current content of one
+// they can read, including edits not yet compacted. The body is optional. For
+// templates, placeholders with a value in "values" are filled in, in the title
+// as well as the content. Copies keep the folder only when the caller owns the
+// original, and never copy its collaborators or template flag.
+func (h *DocumentHandler) DuplicateDocument(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := parseDocumentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.DuplicateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if err := services.ValidateTemplateValues(input.Values); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, err.Error(), nil)
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionRead); !ok {
+		return
+	}
+
+	source, err := h.store.Repos().Documents.Get(r.Context(), documentID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	if len(input.Values) > 0 && !source.IsTemplate {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "values can only be filled in when copying a template", nil)
+		return
+	}
+
+	current, err := materialize(r.Context(), h.s3Service, source)
+	if err != nil {
+		fmt.Printf("DEBUG: Error materializing document %d: %v\n", documentID, err)
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to load document content")
+		return
+	}
+
+	delta := current.Delta
+	title := strings.TrimSpace(input.Title)
+	var unfilled []string
+	if source.IsTemplate {
+		delta = services.FillTemplate(delta, input.Values)
+		if title == "" {
+			title = services.TruncateTitle(services.FillTemplateText(source.Title, input.Values))
+		}
+		unfilled = services.TemplatePlaceholders(title, services.PlainText(delta))
+	} else if title == "" {
+		title = services.CopyTitle(source.Title)
+	}
+
+	documents := h.store.Repos().Documents
+	doc, err := documents.Create(r.Context(), userID, title)
+	if err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	// Don't leave a half-made copy behind, even if the client has gone away
+	cleanUp := func() {
+		if err := h.discard(context.WithoutCancel(r.Context()), doc.ID, userID); err != nil {
+			fmt.Printf("DEBUG: Error removing document %d: %v\n", doc.ID, err)
+		}
+	}
+
+	if source.UserID == userID && source.FolderID != nil {
+		moved, err := documents.Move(r.Context(), doc.ID, source.FolderID)
+		if err != nil {
+			cleanUp()
+			writeDBError(w, r, err, "Folder not found")
+			return
+		}
+		doc = moved
+	}
+
+	content := services.PlainText(delta)
+	if err := h.storeContent(r.Context(), doc.ID, content, delta); err != nil {
+		fmt.Printf("DEBUG: Error storing copy %d of document %d: %v\n", doc.ID, documentID, err)
+		cleanUp()
+		writeStorageError(w, r, err, http.StatusInternalServerError, "Failed to store copied document")
+		return
+	}
+
+	doc.Content = content
+	doc.Permission = services.RoleOwner.String()
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(duplicateResponse{
+		documentResponse:     documentResponse{Document: doc},
+		UnfilledPlaceholders: unfilled,
+	})
+}
+
+// SetTemplate handles PUT /v1/documents/{documentId}/template
+//
+// Only the owner can offer a document as a template. Anyone it is shared with
+// can then create documents from it.
+func (h *DocumentHandler) SetTemplate(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := parseDocumentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	var input models.TemplateInput
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
+		return
+	}
+	if input.IsTemplate == nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "isTemplate is required", nil)
+		return
+	}
+
+	if _, ok := authorizeDocument(w, r, h.accessService, documentID, userID, services.ActionShare); !ok {
+		return
+	}
+
+	doc, err := h.store.Repos().Documents.SetTemplate(r.Context(), documentID, *input.IsTemplate)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+	doc.Permission = services.RoleOwner.String()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// purgeBatchSize is how many expired documents PurgeTrash deletes per statement
+const purgeBatchSize = 100
+
+// ListTrash handles GET /v1/trash
+//
+// Lists the caller's deleted documents. Query parameters: sort (deleted_at,
+// title), order (asc, desc), limit and cursor, as for GET /v1/documents.
+func (h *DocumentHandler) ListTrash(w http.ResponseWriter, r *http.Request) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Most recently deleted first, titles alphabetical
+	page, limit, err := parsePage(r, "title", "deleted_at", "title")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, err.Error(), nil)
+		return
+	}
+
+	documents, err := h.store.Repos().Documents.ListTrash(r.Context(), userID, db.TrashListOptions{Page: page})
+	if err != nil {
+		writeDBError(w, r, err, "Document not found")
+		return
+	}
+
+	if len(documents) > limit {
+		documents = documents[:limit]
+		last := documents[len(documents)-1]
+		var value interface{} = *last.DeletedAt
+		if page.Sort == "title" {
+			value = last.Title
+		}
+		setNextPage(w, r, pageCursorAfter(page, last.ID, value))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(documents)
+}
+
+// RestoreDocument handles POST /v1/trash/{documentId}/restore
+//
+// Only the owner can restore. The document returns to its folder, or to the
+// top level if the folder has since been deleted.
+func (h *DocumentHandler) RestoreDocument(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := parseDocumentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	doc, err := h.store.Repos().Documents.Restore(r.Context(), documentID, userID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found in trash")
+		return
+	}
+	doc.Permission = models.PermissionOwner
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(doc)
+}
+
+// PurgeDocument handles DELETE /v1/trash/{documentId}
+//
+// Permanently deletes a document from the caller's trash, with its content.
+func (h *DocumentHandler) PurgeDocument(w http.ResponseWriter, r *http.Request) {
+	userID, documentID, ok := parseDocumentRequest(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := h.store.Repos().Documents.Purge(r.Context(), documentID, userID)
+	if err != nil {
+		writeDBError(w, r, err, "Document not found in trash")
+		return
+	}
+	h.releaseSnapshots(r.Context(), keys...)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PurgeTrash permanently deletes the documents that have been in the trash
+// longer than retention, along with content no other document uses, and
+// returns how many it deleted
+func (h *DocumentHandler) PurgeTrash(ctx context.Context, retention time.Duration) (int, error) {
+	total := 0
+	for {
+		purged, keys, err := h.store.Repos().Documents.PurgeExpired(ctx, retention, purgeBatchSize)
+		if err != nil {
+			return total, err
+		}
+		total += purged
+		h.releaseSnapshots(ctx, keys...)
+		if purged < purgeBatchSize {
+			return total, nil
+		}
+	}
+}
+
+// discard permanently deletes a document that was never handed to the client,
+// such as a failed import, with any content already stored for it
+func (h *DocumentHandler) discard(ctx context.Context, documentID, ownerID int) error {
+	documents := h.store.Repos().Documents
+	if err := documents.Trash(ctx, documentID); err != nil {
+		return err
+	}
+	keys, err := documents.Purge(ctx, documentID, ownerID)
+	if err != nil {
+		return fmt.Errorf("document %d is in the trash but could not be purged: %w", documentID, err)
+	}
+	h.releaseSnapshots(ctx, keys...)
+	return nil
+}
+
+func parseDocumentRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return 0, 0, false
+	}
+
+	documentID, err := strconv.Atoi(mux.Vars(r)["documentId"])
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid document ID", nil)
+		return 0, 0, false
+	}
+	return userID, documentID, true
+}
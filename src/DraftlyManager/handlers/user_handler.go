@@ -3,22 +3,29 @@ package handlers
 import (
 	"Draftly/CRUD/db"
 	"Draftly/CRUD/models"
+	"Draftly/CRUD/repository"
 	"Draftly/CRUD/services"
 	"encoding/json"
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 )
 
+// minPasswordLength is the shortest password accepted on signup
+const minPasswordLength = 8
+
 type UserHandler struct {
-	dbService *services.DatabaseService
+	store       repository.Store
+	authService *services.AuthService
 }
 
-func NewUserHandler(dbService *services.DatabaseService) *UserHandler {
+func NewUserHandler(store repository.Store, authService *services.AuthService) *UserHandler {
 	return &UserHandler{
-		dbService: dbService,
+		store:       store,
+		authService: authService,
 	}
 }
 
@@ -29,27 +36,53 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	var userInput models.UserInput
 	if err := json.NewDecoder(r.Body).Decode(&userInput); err != nil {
 		fmt.Printf("DEBUG: CreateUser JSON decode error: %v\n", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
 		return
 	}
-	fmt.Printf("DEBUG: CreateUser parsed input: %+v\n", userInput)
+	fmt.Printf("DEBUG: CreateUser parsed input: name=%q email=%q\n", userInput.Name, userInput.Email)
 
 	// Add validation for required fields
 	if userInput.Name == "" || userInput.Email == "" {
 		fmt.Println("DEBUG: CreateUser validation failed - missing fields")
-		http.Error(w, "Name and email are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Name and email are required", nil)
+		return
+	}
+	if len(userInput.Password) < minPasswordLength {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument,
+			fmt.Sprintf("Password must be at least %d characters", minPasswordLength), nil)
+		return
+	}
+
+	passwordHash, err := h.authService.HashPassword(userInput.Password)
+	if err != nil {
+		fmt.Printf("DEBUG: CreateUser hash error: %v\n", err)
+		writeError(w, r, http.StatusInternalServerError, CodeInternal, "Failed to create user", nil)
 		return
 	}
 
+	// The user and their credentials are created together or not at all
 	fmt.Println("DEBUG: CreateUser about to execute database query")
-	var user models.User
-	err := h.dbService.ExecuteQueryRow(db.CreateUserQuery,
-		[]interface{}{&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt},
-		userInput.Name, userInput.Email)
+	tx, err := h.store.Begin(r.Context())
+	if err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+	defer tx.Rollback()
 
+	user, err := tx.Repos().Users.Create(r.Context(), userInput.Name, userInput.Email)
 	if err != nil {
 		fmt.Printf("DEBUG: CreateUser database error: %v\n", err)
-		http.Error(w, "Failed to create user", http.StatusInternalServerError)
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	if err := tx.Repos().Users.CreateCredentials(r.Context(), user.ID, passwordHash); err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		writeDBError(w, r, err, "User not found")
 		return
 	}
 	fmt.Printf("DEBUG: CreateUser success: %+v\n", user)
@@ -59,28 +92,60 @@ func (h *UserHandler) CreateUser(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(user)
 }
 
+// ListUsers handles GET /v1/users
+//
+// Query parameters: q (name or email prefix), sort (created_at, updated_at, name),
+// order (asc, desc), limit and cursor. The next page's cursor is returned in
+// X-Next-Cursor and linked from the Link header.
+func (h *UserHandler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	// Timestamps default to newest first, names to alphabetical
+	page, limit, err := parsePage(r, "name", "created_at", "updated_at", "name")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, err.Error(), nil)
+		return
+	}
+	opts := db.UserListOptions{Page: page, Prefix: strings.TrimSpace(r.URL.Query().Get("q"))}
+
+	users, err := h.store.Repos().Users.List(r.Context(), opts)
+	if err != nil {
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+
+	if len(users) > limit {
+		users = users[:limit]
+		last := users[len(users)-1]
+		var value interface{} = last.CreatedAt
+		switch page.Sort {
+		case "name":
+			value = last.Name
+		case "updated_at":
+			value = last.UpdatedAt
+		}
+		setNextPage(w, r, pageCursorAfter(page, last.ID, value))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
 // GetUser handles GET /v1/users/{id}
 func (h *UserHandler) GetUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid user ID", nil)
 		return
 	}
 
-	results, err := h.dbService.ExecuteQuery(db.GetUserByIDQuery, id)
+	user, err := h.store.Repos().Users.Get(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
-		return
-	}
-
-	if len(results) == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeDBError(w, r, err, "User not found")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(results[0])
+	json.NewEncoder(w).Encode(user)
 }
 
 // UpdateUser handles PUT /v1/users/{id}
@@ -88,29 +153,30 @@ func (h *UserHandler) UpdateUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid user ID", nil)
+		return
+	}
+
+	// Users can only change their own account
+	if !requireSelf(w, r, id) {
 		return
 	}
 
 	var userInput models.UserInput
 	if err := json.NewDecoder(r.Body).Decode(&userInput); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidJSON, "Invalid JSON", err.Error())
 		return
 	}
 
 	// Add validation for required fields
 	if userInput.Name == "" || userInput.Email == "" {
-		http.Error(w, "Name and email are required", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Name and email are required", nil)
 		return
 	}
 
-	var user models.User
-	err = h.dbService.ExecuteQueryRow(db.UpdateUserQuery,
-		[]interface{}{&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt},
-		userInput.Name, userInput.Email, id)
-
+	user, err := h.store.Repos().Users.Update(r.Context(), id, userInput.Name, userInput.Email)
 	if err != nil {
-		http.Error(w, "User not found", http.StatusNotFound)
+		writeDBError(w, r, err, "User not found")
 		return
 	}
 
@@ -123,20 +189,46 @@ func (h *UserHandler) DeleteUser(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
 	if err != nil {
-		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		writeError(w, r, http.StatusBadRequest, CodeInvalidArgument, "Invalid user ID", nil)
+		return
+	}
+
+	// Users can only change their own account
+	if !requireSelf(w, r, id) {
 		return
 	}
 
-	rowsAffected, err := h.dbService.ExecuteNonQuery(db.DeleteUserQuery, id)
+	// Documents are never left without an owner; they must be transferred, or
+	// deleted and purged from the trash, first
+	owned, err := h.store.Repos().Documents.OwnedIDs(r.Context(), id)
 	if err != nil {
-		http.Error(w, "Database error", http.StatusInternalServerError)
+		writeDBError(w, r, err, "User not found")
+		return
+	}
+	if len(owned) > 0 {
+		writeError(w, r, http.StatusConflict, CodeConflict,
+			"Transfer your documents, or delete them and empty your trash, before deleting your account",
+			map[string]interface{}{"ownedDocuments": owned})
 		return
 	}
 
-	if rowsAffected == 0 {
-		http.Error(w, "User not found", http.StatusNotFound)
+	if err := h.store.Repos().Users.Delete(r.Context(), id); err != nil {
+		writeDBError(w, r, err, "User not found")
 		return
 	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// requireSelf checks that the authenticated user is the user being modified
+func requireSelf(w http.ResponseWriter, r *http.Request, id int) bool {
+	userID, ok := requireUser(w, r)
+	if !ok {
+		return false
+	}
+	if userID != id {
+		writeError(w, r, http.StatusForbidden, CodeForbidden, "You can only modify your own account", nil)
+		return false
+	}
+	return true
+}
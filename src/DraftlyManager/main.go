@@ -1,12 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
 
+	"Draftly/CRUD/db"
 	"Draftly/CRUD/handlers"
+	"Draftly/CRUD/middleware"
+	"Draftly/CRUD/repository"
 	"Draftly/CRUD/services"
 
 	"github.com/gorilla/mux"
@@ -20,46 +24,146 @@ func main() {
 	}
 	defer dbService.Close()
 
-	// Initialize S3 service with better error handling
-	fmt.Println("DEBUG: Attempting to initialize S3 service...")
-	s3Service, err := services.NewS3Service()
+	// Schema migrations are embedded; "migrate up|down|status" runs them and exits
+	migrator, err := db.NewMigrator(dbService.DB())
 	if err != nil {
-		log.Printf("WARNING: S3 service failed to initialize: %v", err)
-		log.Printf("Continuing without S3 service - content upload will fail")
-		// Don't exit - continue without S3 for now
-	} else {
-		fmt.Println("DEBUG: S3 service initialized successfully")
+		log.Fatalf("Failed to load migrations: %v", err)
 	}
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		if err := runMigrate(migrator, os.Args[2:]); err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		return
+	}
+
+	// Refuse to serve against a schema older than this build expects
+	ctx, cancel := dbService.WithTimeout(context.Background())
+	err = migrator.Check(ctx)
+	cancel()
+	if err != nil {
+		log.Fatalf("Schema check failed: %v", err)
+	}
+
+	// Initialize document content storage (S3, local disk or memory, see BLOB_STORE)
+	blobStore, err := services.NewBlobStore()
+	if err != nil {
+		log.Fatalf("Failed to initialize blob store: %v", err)
+	}
+	s3Service := services.NewS3Service(blobStore, services.BlobTimeout())
+
+	// Initialize auth service (signs session tokens)
+	authService, err := services.NewAuthService()
+	if err != nil {
+		log.Fatalf("Failed to initialize auth service: %v", err)
+	}
+
+	// Typed repositories over the same connection pool
+	store := repository.NewStore(dbService)
 
 	// Initialize handlers
-	userHandler := handlers.NewUserHandler(dbService)
-	documentHandler := handlers.NewDocumentHandler(dbService, s3Service)
+	authHandler := handlers.NewAuthHandler(store, authService)
+	userHandler := handlers.NewUserHandler(store, authService)
+	accessService := services.NewAccessService(store.Repos().Access)
+	documentHandler := handlers.NewDocumentHandler(store, s3Service, accessService)
+	permissionHandler := handlers.NewPermissionHandler(store, accessService)
+	shareLinkHandler := handlers.NewShareLinkHandler(store, s3Service, accessService)
+	commentHandler := handlers.NewCommentHandler(store, s3Service, accessService)
+	searchHandler := handlers.NewSearchHandler(store)
+	folderHandler := handlers.NewFolderHandler(store, accessService)
+
+	// Permanently delete documents once they have been in the trash too long
+	go runTrashPurge(context.Background(), documentHandler, services.TrashRetention(), services.TrashPurgeInterval())
 
 	// Create router
 	r := mux.NewRouter()
 
+	// Tag every request with an ID so errors can be correlated with logs
+	r.Use(middleware.RequestID)
+
 	// Add request logging middleware
 	r.Use(loggingMiddleware)
 
+	// Unknown routes and methods use the same JSON error envelope as the handlers
+	r.NotFoundHandler = middleware.RequestID(http.HandlerFunc(handlers.NotFound))
+	r.MethodNotAllowedHandler = middleware.RequestID(http.HandlerFunc(handlers.MethodNotAllowed))
+
 	// API version prefix
 	api := r.PathPrefix("/v1").Subrouter()
 
-	// User routes
+	// Public routes: signup, login and share links
 	api.HandleFunc("/users", userHandler.CreateUser).Methods("POST")
-	api.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
-	api.HandleFunc("/users/{id}", userHandler.UpdateUser).Methods("PUT")
-	api.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE")
+	api.HandleFunc("/auth/login", authHandler.Login).Methods("POST")
+
+	// Share link tokens are their own credential
+	api.HandleFunc("/share-links/{token}", shareLinkHandler.ResolveShareLink).Methods("GET")
+
+	// Everything else acts as the user identified by the bearer token
+	authed := api.NewRoute().Subrouter()
+	authed.Use(authHandler.RequireAuth)
+
+	// Auth routes
+	authed.HandleFunc("/auth/logout", authHandler.Logout).Methods("POST")
+	authed.HandleFunc("/auth/me", authHandler.Me).Methods("GET")
+
+	// User routes
+	authed.HandleFunc("/users", userHandler.ListUsers).Methods("GET")
+	authed.HandleFunc("/users/{id}", userHandler.GetUser).Methods("GET")
+	authed.HandleFunc("/users/{id}", userHandler.UpdateUser).Methods("PUT")
+	authed.HandleFunc("/users/{id}", userHandler.DeleteUser).Methods("DELETE")
 
 	// Document routes
-	api.HandleFunc("/documents/{userId}", documentHandler.CreateDocument).Methods("POST")
-	fmt.Println("DEBUG: Registered POST /documents/{userId} route")
-	api.HandleFunc("/documents/{userId}", documentHandler.GetUserDocuments).Methods("GET")
-	api.HandleFunc("/documents/{userId}/{documentId}", documentHandler.GetDocument).Methods("GET")
-	api.HandleFunc("/documents/{userId}/{documentId}", documentHandler.UpdateDocument).Methods("PUT")
-	api.HandleFunc("/documents/{userId}/{documentId}", documentHandler.DeleteDocument).Methods("DELETE")
+	authed.HandleFunc("/documents", documentHandler.CreateDocument).Methods("POST")
+	authed.HandleFunc("/documents", documentHandler.GetUserDocuments).Methods("GET")
+	authed.HandleFunc("/documents/import", documentHandler.ImportDocument).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}", documentHandler.GetDocument).Methods("GET")
+	authed.HandleFunc("/documents/{documentId}", documentHandler.UpdateDocument).Methods("PUT")
+	authed.HandleFunc("/documents/{documentId}", documentHandler.DeleteDocument).Methods("DELETE")
+	authed.HandleFunc("/documents/{documentId}/export", documentHandler.ExportDocument).Methods("GET")
+	authed.HandleFunc("/documents/{documentId}/access", documentHandler.GetDocumentAccess).Methods("GET")
+	authed.HandleFunc("/documents/{documentId}/duplicate", documentHandler.DuplicateDocument).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}/template", documentHandler.SetTemplate).Methods("PUT")
+
+	// Trash routes
+	authed.HandleFunc("/trash", documentHandler.ListTrash).Methods("GET")
+	authed.HandleFunc("/trash/{documentId}", documentHandler.PurgeDocument).Methods("DELETE")
+	authed.HandleFunc("/trash/{documentId}/restore", documentHandler.RestoreDocument).Methods("POST")
+
+	// Folder routes
+	authed.HandleFunc("/folders", folderHandler.CreateFolder).Methods("POST")
+	authed.HandleFunc("/folders", folderHandler.ListFolders).Methods("GET")
+	authed.HandleFunc("/folders/{folderId}", folderHandler.GetFolder).Methods("GET")
+	authed.HandleFunc("/folders/{folderId}", folderHandler.RenameFolder).Methods("PATCH")
+	authed.HandleFunc("/folders/{folderId}", folderHandler.DeleteFolder).Methods("DELETE")
+	authed.HandleFunc("/folders/{folderId}/parent", folderHandler.MoveFolder).Methods("PUT")
+	authed.HandleFunc("/folders/{folderId}/permissions", folderHandler.ListFolderPermissions).Methods("GET")
+	authed.HandleFunc("/folders/{folderId}/permissions", folderHandler.ShareFolder).Methods("POST")
+	authed.HandleFunc("/folders/{folderId}/permissions/{userId}", folderHandler.UnshareFolder).Methods("DELETE")
+	authed.HandleFunc("/documents/{documentId}/folder", folderHandler.MoveDocument).Methods("PUT")
+
+	// Search route
+	authed.HandleFunc("/search", searchHandler.Search).Methods("GET")
+
+	// Sharing routes
+	authed.HandleFunc("/documents/{documentId}/permissions", permissionHandler.ListPermissions).Methods("GET")
+	authed.HandleFunc("/documents/{documentId}/permissions", permissionHandler.SharePermission).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}/permissions/{userId}", permissionHandler.UpdatePermission).Methods("PATCH")
+	authed.HandleFunc("/documents/{documentId}/permissions/{userId}", permissionHandler.RevokePermission).Methods("DELETE")
+	authed.HandleFunc("/documents/{documentId}/owner", permissionHandler.TransferOwnership).Methods("PUT")
+	authed.HandleFunc("/documents/{documentId}/links", shareLinkHandler.ListShareLinks).Methods("GET")
+	authed.HandleFunc("/documents/{documentId}/links", shareLinkHandler.CreateShareLink).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}/links/{linkId}", shareLinkHandler.RevokeShareLink).Methods("DELETE")
+
+	// Comment routes
+	authed.HandleFunc("/documents/{documentId}/comments", commentHandler.ListComments).Methods("GET")
+	authed.HandleFunc("/documents/{documentId}/comments", commentHandler.CreateComment).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}/comments/{commentId}", commentHandler.UpdateComment).Methods("PATCH")
+	authed.HandleFunc("/documents/{documentId}/comments/{commentId}", commentHandler.DeleteComment).Methods("DELETE")
+	authed.HandleFunc("/documents/{documentId}/comments/{commentId}/replies", commentHandler.CreateReply).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}/comments/{commentId}/resolve", commentHandler.ResolveComment).Methods("POST")
+	authed.HandleFunc("/documents/{documentId}/comments/{commentId}/reopen", commentHandler.ReopenComment).Methods("POST")
 
 	// Document content route (S3 update)
-	api.HandleFunc("/documents/{documentId}", documentHandler.UpdateDocumentContent).Methods("PUT")
+	authed.HandleFunc("/documents/{documentId}/content", documentHandler.UpdateDocumentContent).Methods("PUT")
 
 	// CORS middleware
 	api.Use(corsMiddleware)
@@ -86,7 +190,7 @@ func main() {
 // loggingMiddleware logs all incoming requests
 func loggingMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		fmt.Printf("Request: %s %s\n", r.Method, r.URL.Path)
+		fmt.Printf("Request: %s %s [%s]\n", r.Method, r.URL.Path, middleware.RequestIDFromContext(r.Context()))
 		next.ServeHTTP(w, r)
 	})
 }
@@ -95,7 +199,7 @@ func loggingMiddleware(next http.Handler) http.Handler {
 func corsMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
 		// Handle preflight requests
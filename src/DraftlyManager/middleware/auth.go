@@ -0,0 +1,22 @@
+package middleware
+
+import "context"
+
+const authUserKey contextKey = "authUser"
+
+// AuthUser is the authenticated caller attached to the request context
+type AuthUser struct {
+	UserID    int
+	SessionID string
+}
+
+// WithAuthUser returns a copy of ctx carrying the authenticated user
+func WithAuthUser(ctx context.Context, user AuthUser) context.Context {
+	return context.WithValue(ctx, authUserKey, user)
+}
+
+// AuthUserFromContext returns the authenticated user, if the request was authenticated
+func AuthUserFromContext(ctx context.Context) (AuthUser, bool) {
+	user, ok := ctx.Value(authUserKey).(AuthUser)
+	return user, ok
+}
@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// LoginInput for POST /v1/auth/login
+type LoginInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// AuthToken is returned on login; Token goes in the Authorization: Bearer header
+type AuthToken struct {
+	Token     string    `json:"token"`
+	TokenType string    `json:"tokenType"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	User      User      `json:"user"`
+}
@@ -0,0 +1,55 @@
+package models
+
+import "time"
+
+// Comment event types published to the WS server
+const (
+	CommentCreated  = "comment.created"
+	CommentUpdated  = "comment.updated"
+	CommentResolved = "comment.resolved"
+	CommentReopened = "comment.reopened"
+	CommentDeleted  = "comment.deleted"
+)
+
+// Comment is a thread root anchored to a character range, or a reply to one.
+// Anchors are rune offsets into the document text and are kept up to date by
+// the WS server as the text changes.
+type Comment struct {
+	ID          int        `json:"id"`
+	DocumentID  int        `json:"documentId"`
+	ParentID    *int       `json:"parentId"`
+	UserID      *int       `json:"userId"`
+	Body        string     `json:"body"`
+	AnchorStart *int       `json:"anchorStart,omitempty"`
+	AnchorEnd   *int       `json:"anchorEnd,omitempty"`
+	QuotedText  string     `json:"quotedText,omitempty"`
+	Resolved    bool       `json:"resolved"`
+	ResolvedAt  *time.Time `json:"resolvedAt,omitempty"`
+	ResolvedBy  *int       `json:"resolvedBy,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+	Replies     []Comment  `json:"replies,omitempty"`
+}
+
+// CommentInput for POST /v1/documents/{documentId}/comments and replies.
+// Anchors are required for new threads and ignored for replies.
+type CommentInput struct {
+	Body        string `json:"body"`
+	AnchorStart *int   `json:"anchorStart,omitempty"`
+	AnchorEnd   *int   `json:"anchorEnd,omitempty"`
+}
+
+// CommentUpdateInput for PATCH /v1/documents/{documentId}/comments/{commentId}
+type CommentUpdateInput struct {
+	Body string `json:"body"`
+}
+
+// CommentEvent is published on the comment_events channel for live clients.
+// Comment is left out when the event would not fit in a notification; clients
+// then reload the document's comments.
+type CommentEvent struct {
+	Type       string   `json:"type"`
+	DocumentID int      `json:"documentId"`
+	CommentID  int      `json:"commentId"`
+	Comment    *Comment `json:"comment,omitempty"`
+}
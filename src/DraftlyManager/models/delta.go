@@ -0,0 +1,72 @@
+package models
+
+import "fmt"
+
+// Formatting attributes. Inline attributes apply to characters; block
+// attributes apply to the line ended by the "\n" they are set on.
+const (
+	AttributeBold   = "bold"   // inline, true
+	AttributeItalic = "italic" // inline, true
+	AttributeLink   = "link"   // inline, URL string
+	AttributeHeader = "header" // block, 1-6
+	AttributeList   = "list"   // block, "bullet" or "ordered"
+)
+
+// Attributes is the formatting of a run of text
+type Attributes map[string]interface{}
+
+// Run is a stretch of text with the same formatting
+type Run struct {
+	Insert     string     `json:"insert"`
+	Attributes Attributes `json:"attributes,omitempty"`
+}
+
+// Delta is the rich-text document model: the text as a list of formatted runs.
+// It uses the same JSON shape as Quill deltas so editors can load it directly.
+type Delta struct {
+	Ops []Run `json:"ops"`
+}
+
+// ValidateAttributes checks attribute names and values. Null values are
+// allowed and mean "remove".
+func ValidateAttributes(attributes Attributes) error {
+	for name, value := range attributes {
+		if value == nil {
+			continue
+		}
+		switch name {
+		case AttributeBold, AttributeItalic:
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("%s must be true or null", name)
+			}
+		case AttributeLink:
+			if link, ok := value.(string); !ok || link == "" {
+				return fmt.Errorf("link must be a URL")
+			}
+		case AttributeHeader:
+			if level := HeaderLevel(attributes); level < 1 || level > 6 {
+				return fmt.Errorf("header must be a level from 1 to 6")
+			}
+		case AttributeList:
+			if value != "bullet" && value != "ordered" {
+				return fmt.Errorf("list must be \"bullet\" or \"ordered\"")
+			}
+		default:
+			return fmt.Errorf("unknown attribute %q", name)
+		}
+	}
+	return nil
+}
+
+// HeaderLevel returns the heading level set in attributes, or 0 if there is none
+func HeaderLevel(attributes Attributes) int {
+	switch level := attributes[AttributeHeader].(type) {
+	case int:
+		return level
+	case float64: // JSON numbers decode as float64
+		if level == float64(int(level)) {
+			return int(level)
+		}
+	}
+	return 0
+}
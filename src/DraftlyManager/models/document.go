@@ -6,11 +6,26 @@ import "time"
 type Document struct {
 	ID         int         `json:"id" db:"id"`
 	UserID     int         `json:"userId" db:"user_id"`
+	FolderID   *int        `json:"folderId" db:"folder_id"` // nil outside any folder
 	Title      string      `json:"title" db:"title"`
+	IsTemplate bool        `json:"isTemplate" db:"is_template"`
 	Content    string      `json:"content,omitempty" db:"content"`
 	Operations []Operation `json:"operations,omitempty"`
+	Version    int         `json:"version" db:"version"`
+	Permission string      `json:"permission,omitempty"` // caller's access: owner, edit, comment or view-only
 	CreatedAt  time.Time   `json:"created_at" db:"created_at"`
 	UpdatedAt  time.Time   `json:"updated_at" db:"updated_at"`
+	DeletedAt  *time.Time  `json:"deleted_at,omitempty" db:"deleted_at"` // set while in the trash
+}
+
+// DocumentRecord is a Documents row as stored: the document, where its last
+// compacted snapshot lives, and in Operations the edits received since
+type DocumentRecord struct {
+	Document
+	S3Key         string
+	ContentSHA256 string
+	DeltaKey      string
+	DeltaSHA256   string
 }
 
 // DocumentInput for creating/updating documents
@@ -19,3 +34,14 @@ type DocumentInput struct {
 	UserID       int          `json:"userId"`
 	AllowedUsers []Permission `json:"allowedUsers,omitempty"`
 }
+
+// TemplateInput marks a document as a template or stops offering it as one
+type TemplateInput struct {
+	IsTemplate *bool `json:"isTemplate"`
+}
+
+// DuplicateInput for copying a document or creating one from a template
+type DuplicateInput struct {
+	Title  string            `json:"title,omitempty"`  // defaults to "Copy of <title>", or the filled-in template title
+	Values map[string]string `json:"values,omitempty"` // template placeholder values by name
+}
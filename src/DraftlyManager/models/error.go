@@ -0,0 +1,22 @@
+package models
+
+// APIError is the body of every error returned by the API
+type APIError struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	Details   interface{} `json:"details,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+}
+
+// ErrorResponse wraps an APIError in the response envelope
+type ErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+// PermissionFailure reports a collaborator permission that could not be applied
+type PermissionFailure struct {
+	UserID     int    `json:"userId"`
+	Permission string `json:"permission"`
+	Code       string `json:"code"`
+	Message    string `json:"message"`
+}
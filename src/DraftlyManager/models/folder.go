@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Folder groups documents and other folders. Everything filed in a folder has
+// the folder's owner.
+type Folder struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"userId"`
+	ParentID   *int      `json:"parentId"` // nil for top-level folders
+	Name       string    `json:"name"`
+	Permission string    `json:"permission,omitempty"` // caller's access: owner, edit, comment or view-only
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+// FolderTree is a folder with everything beneath it
+type FolderTree struct {
+	Folder
+	Folders   []FolderTree `json:"folders"`
+	Documents []Document   `json:"documents"`
+}
+
+// FolderInput for POST /v1/folders and PATCH /v1/folders/{folderId}
+type FolderInput struct {
+	Name     string `json:"name"`
+	ParentID *int   `json:"parentId,omitempty"`
+}
+
+// FolderMoveInput for PUT /v1/folders/{folderId}/parent and
+// PUT /v1/documents/{documentId}/folder. A nil FolderID moves to the top level.
+type FolderMoveInput struct {
+	FolderID *int `json:"folderId"`
+}
@@ -1,9 +1,12 @@
 package models
 
-// Operation represents an edit operation on a document
+// Operation represents an edit operation on a document. Inserts may carry the
+// attributes of the inserted text; format operations set Attributes on Length
+// characters from Position, with a null value removing an attribute.
 type Operation struct {
-	Type     string `json:"type"`
-	Position int    `json:"position"`
-	Text     string `json:"text,omitempty"`
-	Length   int    `json:"length,omitempty"`
+	Type       string     `json:"type"`
+	Position   int        `json:"position"`
+	Text       string     `json:"text,omitempty"`
+	Length     int        `json:"length,omitempty"`
+	Attributes Attributes `json:"attributes,omitempty"`
 }
@@ -1,7 +1,71 @@
 package models
 
+// Permission levels. Owner comes from Documents.user_id; the owner's own
+// DocumentPermissions row, kept by the ensure_owner_permission trigger, is 'edit'.
+const (
+	PermissionOwner    = "owner"
+	PermissionEdit     = "edit"
+	PermissionViewOnly = "view-only"
+	PermissionComment  = "comment"
+)
+
 // Permission defines user access to documents
 type Permission struct {
 	UserID     int    `json:"userId"`
 	Permission string `json:"permission"`
 }
+
+// GrantablePermissions are the levels that can be stored in DocumentPermissions
+// or granted through a share link
+var GrantablePermissions = []string{PermissionEdit, PermissionComment, PermissionViewOnly}
+
+// ValidPermission reports whether p can be stored in DocumentPermissions
+func ValidPermission(p string) bool {
+	return p == PermissionEdit || p == PermissionComment || p == PermissionViewOnly
+}
+
+// ValidLinkPermission reports whether p can be granted through a share link
+func ValidLinkPermission(p string) bool {
+	return ValidPermission(p)
+}
+
+// ShareInput for POST /v1/documents/{documentId}/permissions
+type ShareInput struct {
+	Email      string `json:"email"`
+	Permission string `json:"permission"`
+}
+
+// PermissionInput for PATCH /v1/documents/{documentId}/permissions/{userId}
+type PermissionInput struct {
+	Permission string `json:"permission"`
+}
+
+// Collaborator is a user with access to a document
+type Collaborator struct {
+	UserID     int    `json:"userId"`
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	Permission string `json:"permission"`
+}
+
+// OwnershipInput for PUT /v1/documents/{documentId}/owner. Either field identifies the new owner.
+type OwnershipInput struct {
+	UserID int    `json:"userId,omitempty"`
+	Email  string `json:"email,omitempty"`
+}
+
+// DocumentGrants is what a user has been granted on a document: its owner,
+// their own DocumentPermissions value ("" if none) and the FolderPermissions
+// they inherit from the folders containing it
+type DocumentGrants struct {
+	OwnerID    int
+	Permission string
+	Inherited  []string
+}
+
+// FolderGrants is a folder's owner and the FolderPermissions a user holds on it
+// or inherits from the folders above it
+type FolderGrants struct {
+	OwnerID     int
+	Permissions []string
+}
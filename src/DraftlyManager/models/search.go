@@ -0,0 +1,17 @@
+package models
+
+// SearchHit is a document matching a search, with the passages that matched
+type SearchHit struct {
+	Document
+	Rank float64 `json:"rank"`
+	// Snippet is plain text from the last compacted content; Highlights mark
+	// the matched words in it
+	Snippet    string      `json:"snippet"`
+	Highlights []TextRange `json:"highlights"`
+}
+
+// TextRange is the span [Start, End) of a string, counted in characters
+type TextRange struct {
+	Start int `json:"start"`
+	End   int `json:"end"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// ShareLink grants anyone holding its token access to a document
+type ShareLink struct {
+	ID         int        `json:"id"`
+	DocumentID int        `json:"documentId"`
+	Permission string     `json:"permission"`
+	CreatedBy  *int       `json:"createdBy"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+
+	// Token is only returned when the link is created
+	Token string `json:"token,omitempty"`
+}
+
+// ShareLinkInput for POST /v1/documents/{documentId}/links
+type ShareLinkInput struct {
+	Permission string     `json:"permission"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+}
+
+// ResolvedShareLink is what a share link token gives access to
+type ResolvedShareLink struct {
+	DocumentID int        `json:"documentId"`
+	Permission string     `json:"permission"`
+	ExpiresAt  *time.Time `json:"expiresAt"`
+	Title      string     `json:"title"`
+	Content    string     `json:"content"`
+	Version    int        `json:"version"`
+}
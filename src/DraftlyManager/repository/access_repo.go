@@ -0,0 +1,39 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// AccessRepo reads the grants services.AccessService evaluates
+type AccessRepo interface {
+	// DocumentGrants returns what a user has been granted on a document.
+	// Documents in the trash are not found.
+	DocumentGrants(ctx context.Context, documentID, userID int) (models.DocumentGrants, error)
+	// FolderGrants returns what a user holds on a folder or inherits from above it
+	FolderGrants(ctx context.Context, folderID, userID int) (models.FolderGrants, error)
+}
+
+type accessRepo struct {
+	conn
+}
+
+func (r *accessRepo) DocumentGrants(ctx context.Context, documentID, userID int) (models.DocumentGrants, error) {
+	var grants models.DocumentGrants
+	var permission sql.NullString
+	err := r.queryRow(ctx, db.GetDocumentAccessQuery,
+		[]interface{}{&grants.OwnerID, &permission, pq.Array(&grants.Inherited)}, documentID, userID)
+	grants.Permission = permission.String
+	return grants, err
+}
+
+func (r *accessRepo) FolderGrants(ctx context.Context, folderID, userID int) (models.FolderGrants, error) {
+	var grants models.FolderGrants
+	err := r.queryRow(ctx, db.GetFolderAccessQuery,
+		[]interface{}{&grants.OwnerID, pq.Array(&grants.Permissions)}, folderID, userID)
+	return grants, err
+}
@@ -0,0 +1,129 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+)
+
+// maxNotifyPayloadBytes is the most pg_notify accepts; it rejects payloads of
+// 8000 bytes or more
+const maxNotifyPayloadBytes = 7999
+
+// CommentRepo reads and writes Comments and publishes comment events to the WS
+// server. Every lookup is scoped to a document, so a comment ID from another
+// document is not found.
+type CommentRepo interface {
+	// ForDocument returns every comment on a document, oldest first
+	ForDocument(ctx context.Context, documentID int) ([]models.Comment, error)
+	Get(ctx context.Context, id, documentID int) (models.Comment, error)
+	// CreateThread starts a thread anchored to a range of the document text
+	CreateThread(ctx context.Context, documentID, userID int, body string, anchorStart, anchorEnd int, quotedText string) (models.Comment, error)
+	// CreateReply adds a reply to the thread rooted at threadID
+	CreateReply(ctx context.Context, documentID, threadID, userID int, body string) (models.Comment, error)
+	UpdateBody(ctx context.Context, id, documentID int, body string) (models.Comment, error)
+	// Resolve and Reopen only match thread roots
+	Resolve(ctx context.Context, id, documentID, resolvedBy int) (models.Comment, error)
+	Reopen(ctx context.Context, id, documentID int) (models.Comment, error)
+	Delete(ctx context.Context, id, documentID int) error
+	// Publish sends an event on the comment_events channel, without its comment
+	// if the whole event is too large for a notification
+	Publish(ctx context.Context, event models.CommentEvent) error
+}
+
+type commentRepo struct {
+	conn
+}
+
+func (r *commentRepo) ForDocument(ctx context.Context, documentID int) ([]models.Comment, error) {
+	comments := []models.Comment{}
+	err := r.query(ctx, db.GetDocumentCommentsQuery, func(row scanner) error {
+		comment, err := scanComment(row)
+		if err != nil {
+			return err
+		}
+		comments = append(comments, comment)
+		return nil
+	}, documentID)
+	return comments, err
+}
+
+func (r *commentRepo) Get(ctx context.Context, id, documentID int) (models.Comment, error) {
+	return r.queryComment(ctx, db.GetCommentQuery, id, documentID)
+}
+
+func (r *commentRepo) CreateThread(ctx context.Context, documentID, userID int, body string, anchorStart, anchorEnd int, quotedText string) (models.Comment, error) {
+	return r.queryComment(ctx, db.CreateCommentQuery, documentID, nil, userID, body, anchorStart, anchorEnd, quotedText)
+}
+
+func (r *commentRepo) CreateReply(ctx context.Context, documentID, threadID, userID int, body string) (models.Comment, error) {
+	return r.queryComment(ctx, db.CreateCommentQuery, documentID, threadID, userID, body, nil, nil, nil)
+}
+
+func (r *commentRepo) UpdateBody(ctx context.Context, id, documentID int, body string) (models.Comment, error) {
+	return r.queryComment(ctx, db.UpdateCommentBodyQuery, body, id, documentID)
+}
+
+func (r *commentRepo) Resolve(ctx context.Context, id, documentID, resolvedBy int) (models.Comment, error) {
+	return r.queryComment(ctx, db.ResolveCommentQuery, resolvedBy, id, documentID)
+}
+
+func (r *commentRepo) Reopen(ctx context.Context, id, documentID int) (models.Comment, error) {
+	return r.queryComment(ctx, db.ReopenCommentQuery, id, documentID)
+}
+
+func (r *commentRepo) Delete(ctx context.Context, id, documentID int) error {
+	return r.execOne(ctx, db.DeleteCommentQuery, id, documentID)
+}
+
+func (r *commentRepo) Publish(ctx context.Context, event models.CommentEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	// JSON escaping can make a payload several times the size of the comment
+	if len(payload) > maxNotifyPayloadBytes {
+		event.Comment = nil
+		if payload, err = json.Marshal(event); err != nil {
+			return err
+		}
+	}
+	_, err = r.exec(ctx, db.NotifyCommentEventQuery, string(payload))
+	return err
+}
+
+// queryComment runs a query returning a single comment row
+func (r *commentRepo) queryComment(ctx context.Context, query string, args ...interface{}) (models.Comment, error) {
+	var comment models.Comment
+	var quotedText sql.NullString
+	if err := r.queryRow(ctx, query, commentFields(&comment, &quotedText), args...); err != nil {
+		return models.Comment{}, err
+	}
+	comment.QuotedText = quotedText.String
+	comment.Resolved = comment.ResolvedAt != nil
+	return comment, nil
+}
+
+// scanComment scans one comment row from a list query
+func scanComment(row scanner) (models.Comment, error) {
+	var comment models.Comment
+	var quotedText sql.NullString
+	if err := row.Scan(commentFields(&comment, &quotedText)...); err != nil {
+		return models.Comment{}, err
+	}
+	comment.QuotedText = quotedText.String
+	comment.Resolved = comment.ResolvedAt != nil
+	return comment, nil
+}
+
+// commentFields lists the columns every comment query returns, in order.
+// quoted_text is only set on thread roots.
+func commentFields(comment *models.Comment, quotedText *sql.NullString) []interface{} {
+	return []interface{}{
+		&comment.ID, &comment.DocumentID, &comment.ParentID, &comment.UserID, &comment.Body,
+		&comment.AnchorStart, &comment.AnchorEnd, quotedText, &comment.ResolvedAt, &comment.ResolvedBy,
+		&comment.CreatedAt, &comment.UpdatedAt,
+	}
+}
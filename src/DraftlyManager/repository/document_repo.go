@@ -0,0 +1,242 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// DocumentRepo reads and writes Documents rows. UpdateTitle, SetTemplate,
+// TransferOwner and Move do not match documents in the trash, so a document
+// trashed after its access check is not found.
+type DocumentRepo interface {
+	Create(ctx context.Context, ownerID int, title string) (models.Document, error)
+	// Get returns the stored row, including snapshot keys and pending
+	// operations. Documents in the trash are not found.
+	Get(ctx context.Context, id int) (models.DocumentRecord, error)
+	// List returns the documents a user owns or has been shared, with the
+	// user's permission on each
+	List(ctx context.Context, userID int, opts db.DocumentListOptions) ([]models.Document, error)
+	// OwnedIDs returns the IDs of the documents a user owns
+	OwnedIDs(ctx context.Context, ownerID int) ([]int, error)
+	UpdateTitle(ctx context.Context, id int, title string) (models.Document, error)
+	// SetTemplate marks the document as a template, or stops offering it as one
+	SetTemplate(ctx context.Context, id int, isTemplate bool) (models.Document, error)
+	// Trash moves a document to its owner's trash
+	Trash(ctx context.Context, id int) error
+	// Restore takes a document out of its owner's trash
+	Restore(ctx context.Context, id, ownerID int) (models.Document, error)
+	// ListTrash returns a page of the documents in a user's trash
+	ListTrash(ctx context.Context, ownerID int, opts db.TrashListOptions) ([]models.Document, error)
+	// Purge permanently deletes a document in its owner's trash and returns
+	// the snapshot keys it used
+	Purge(ctx context.Context, id, ownerID int) ([]string, error)
+	// PurgeExpired permanently deletes up to limit documents that have been in
+	// the trash longer than retention and returns how many it deleted and the
+	// snapshot keys they used
+	PurgeExpired(ctx context.Context, retention time.Duration, limit int) (int, []string, error)
+	// Lock locks the row until the transaction ends and returns its owner
+	Lock(ctx context.Context, id int) (int, error)
+	// TransferOwner gives the document to another user, taking it out of the
+	// previous owner's folders
+	TransferOwner(ctx context.Context, id, newOwnerID int) (models.Document, error)
+	// Move files the document in a folder, or at the top level if folderID is nil
+	Move(ctx context.Context, id int, folderID *int) (models.Document, error)
+	// SetSnapshot records the plain text snapshot of a document
+	SetSnapshot(ctx context.Context, id int, key, sha256 string) error
+	// SetDeltaSnapshot records the rich-text snapshot of a document
+	SetDeltaSnapshot(ctx context.Context, id int, key, sha256 string) error
+	// SnapshotReferences counts the documents still using a snapshot key
+	SnapshotReferences(ctx context.Context, key string) (int, error)
+	// ShareSnapshots locks snapshot keys against deletion until the
+	// transaction ends, while they are uploaded and recorded
+	ShareSnapshots(ctx context.Context, keys ...string) error
+	// LockSnapshotForDelete waits for writers of a snapshot key to finish and
+	// keeps new ones out until the transaction ends
+	LockSnapshotForDelete(ctx context.Context, key string) error
+}
+
+type documentRepo struct {
+	conn
+}
+
+func (r *documentRepo) Create(ctx context.Context, ownerID int, title string) (models.Document, error) {
+	var doc models.Document
+	err := r.queryRow(ctx, db.CreateDocumentQuery, documentFields(&doc), ownerID, title)
+	return doc, err
+}
+
+func (r *documentRepo) Get(ctx context.Context, id int) (models.DocumentRecord, error) {
+	var record models.DocumentRecord
+	var operations, s3Key, contentSHA, deltaKey, deltaSHA sql.NullString
+	err := r.queryRow(ctx, db.GetDocumentByIDQuery, []interface{}{
+		&record.ID, &record.UserID, &record.FolderID, &record.Title, &record.IsTemplate, &operations,
+		&s3Key, &contentSHA, &deltaKey, &deltaSHA,
+		&record.Version, &record.CreatedAt, &record.UpdatedAt,
+	}, id)
+	if err != nil {
+		return record, err
+	}
+
+	record.S3Key, record.ContentSHA256 = s3Key.String, contentSHA.String
+	record.DeltaKey, record.DeltaSHA256 = deltaKey.String, deltaSHA.String
+	if operations.Valid {
+		if err := json.Unmarshal([]byte(operations.String), &record.Operations); err != nil {
+			return record, fmt.Errorf("failed to parse operations of document %d: %w", id, err)
+		}
+	}
+	return record, nil
+}
+
+func (r *documentRepo) List(ctx context.Context, userID int, opts db.DocumentListOptions) ([]models.Document, error) {
+	query, args := db.ListAccessibleDocumentsQuery(userID, opts)
+	documents := []models.Document{}
+	err := r.query(ctx, query, func(row scanner) error {
+		var doc models.Document
+		var permission sql.NullString
+		if err := row.Scan(&doc.ID, &doc.UserID, &doc.FolderID, &doc.Title, &doc.IsTemplate, &doc.CreatedAt, &doc.UpdatedAt, &doc.Version, &permission); err != nil {
+			return err
+		}
+		doc.Permission = permission.String
+		documents = append(documents, doc)
+		return nil
+	}, args...)
+	return documents, err
+}
+
+func (r *documentRepo) OwnedIDs(ctx context.Context, ownerID int) ([]int, error) {
+	ids := []int{}
+	err := r.query(ctx, db.GetOwnedDocumentIDsQuery, func(row scanner) error {
+		var id int
+		if err := row.Scan(&id); err != nil {
+			return err
+		}
+		ids = append(ids, id)
+		return nil
+	}, ownerID)
+	return ids, err
+}
+
+func (r *documentRepo) UpdateTitle(ctx context.Context, id int, title string) (models.Document, error) {
+	var doc models.Document
+	err := r.queryRow(ctx, db.UpdateDocumentQuery, documentFields(&doc), title, id)
+	return doc, err
+}
+
+func (r *documentRepo) SetTemplate(ctx context.Context, id int, isTemplate bool) (models.Document, error) {
+	var doc models.Document
+	err := r.queryRow(ctx, db.SetDocumentTemplateQuery, documentFields(&doc), isTemplate, id)
+	return doc, err
+}
+
+func (r *documentRepo) Trash(ctx context.Context, id int) error {
+	return r.execOne(ctx, db.TrashDocumentQuery, id)
+}
+
+func (r *documentRepo) Restore(ctx context.Context, id, ownerID int) (models.Document, error) {
+	var doc models.Document
+	err := r.queryRow(ctx, db.RestoreDocumentQuery, documentFields(&doc), id, ownerID)
+	return doc, err
+}
+
+func (r *documentRepo) ListTrash(ctx context.Context, ownerID int, opts db.TrashListOptions) ([]models.Document, error) {
+	query, args := db.ListTrashQuery(ownerID, opts)
+	documents := []models.Document{}
+	err := r.query(ctx, query, func(row scanner) error {
+		var doc models.Document
+		if err := row.Scan(append(documentFields(&doc), &doc.DeletedAt)...); err != nil {
+			return err
+		}
+		documents = append(documents, doc)
+		return nil
+	}, args...)
+	return documents, err
+}
+
+func (r *documentRepo) Purge(ctx context.Context, id, ownerID int) ([]string, error) {
+	purged, keys, err := r.purge(ctx, db.PurgeDocumentQuery, id, ownerID)
+	if err == nil && purged == 0 {
+		err = sql.ErrNoRows
+	}
+	return keys, err
+}
+
+func (r *documentRepo) PurgeExpired(ctx context.Context, retention time.Duration, limit int) (int, []string, error) {
+	return r.purge(ctx, db.PurgeExpiredDocumentsQuery, retention.Seconds(), limit)
+}
+
+// purge runs a query deleting documents and returning their id and snapshot keys
+func (r *documentRepo) purge(ctx context.Context, query string, args ...interface{}) (int, []string, error) {
+	purged := 0
+	var keys []string
+	err := r.query(ctx, query, func(row scanner) error {
+		var id int
+		var s3Key, deltaKey sql.NullString
+		if err := row.Scan(&id, &s3Key, &deltaKey); err != nil {
+			return err
+		}
+		purged++
+		for _, key := range []sql.NullString{s3Key, deltaKey} {
+			if key.String != "" {
+				keys = append(keys, key.String)
+			}
+		}
+		return nil
+	}, args...)
+	return purged, keys, err
+}
+
+func (r *documentRepo) Lock(ctx context.Context, id int) (int, error) {
+	var ownerID int
+	err := r.queryRow(ctx, db.LockDocumentQuery, []interface{}{&ownerID}, id)
+	return ownerID, err
+}
+
+func (r *documentRepo) TransferOwner(ctx context.Context, id, newOwnerID int) (models.Document, error) {
+	var doc models.Document
+	err := r.queryRow(ctx, db.TransferDocumentOwnerQuery, documentFields(&doc), newOwnerID, id)
+	return doc, err
+}
+
+func (r *documentRepo) Move(ctx context.Context, id int, folderID *int) (models.Document, error) {
+	var doc models.Document
+	err := r.queryRow(ctx, db.MoveDocumentQuery, documentFields(&doc), folderID, id)
+	return doc, err
+}
+
+func (r *documentRepo) SetSnapshot(ctx context.Context, id int, key, sha256 string) error {
+	return r.execOne(ctx, db.UpdateDocumentS3KeyQuery, key, sha256, id)
+}
+
+func (r *documentRepo) SetDeltaSnapshot(ctx context.Context, id int, key, sha256 string) error {
+	return r.execOne(ctx, db.UpdateDocumentDeltaKeyQuery, key, sha256, id)
+}
+
+func (r *documentRepo) SnapshotReferences(ctx context.Context, key string) (int, error) {
+	var references int
+	err := r.queryRow(ctx, db.CountSnapshotReferencesQuery, []interface{}{&references}, key)
+	return references, err
+}
+
+func (r *documentRepo) ShareSnapshots(ctx context.Context, keys ...string) error {
+	for _, key := range keys {
+		if _, err := r.exec(ctx, db.ShareSnapshotLockQuery, key); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *documentRepo) LockSnapshotForDelete(ctx context.Context, key string) error {
+	_, err := r.exec(ctx, db.DeleteSnapshotLockQuery, key)
+	return err
+}
+
+// documentFields lists the columns returned by the document write queries, in order
+func documentFields(doc *models.Document) []interface{} {
+	return []interface{}{&doc.ID, &doc.UserID, &doc.FolderID, &doc.Title, &doc.IsTemplate, &doc.CreatedAt, &doc.UpdatedAt}
+}
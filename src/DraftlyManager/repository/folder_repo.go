@@ -0,0 +1,150 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// FolderRepo reads and writes Folders and FolderPermissions. The owner is
+// implied by Folders.user_id and has no permission row of their own.
+type FolderRepo interface {
+	Create(ctx context.Context, ownerID int, parentID *int, name string) (models.Folder, error)
+	Get(ctx context.Context, id int) (models.Folder, error)
+	Rename(ctx context.Context, id int, name string) (models.Folder, error)
+	// Move files the folder in another folder, or at the top level if parentID is nil
+	Move(ctx context.Context, id int, parentID *int) (models.Folder, error)
+	// Delete removes an empty folder, returning sql.ErrNoRows if it still has
+	// folders or documents in it
+	Delete(ctx context.Context, id int) error
+	// LockTree serializes changes to an owner's folders until the transaction ends
+	LockTree(ctx context.Context, ownerID int) error
+	// IsWithin reports whether folderID is ancestorID or lies beneath it
+	IsWithin(ctx context.Context, ancestorID, folderID int) (bool, error)
+	// Roots returns the top-level folders a user owns and the folders shared
+	// with them directly, with the user's permission on each
+	Roots(ctx context.Context, userID int) ([]models.Folder, error)
+	// Subtree returns every folder beneath the given ones, with the permission
+	// the user holds on each directly
+	Subtree(ctx context.Context, folderIDs []int, userID int) ([]models.Folder, error)
+	// Documents returns the documents filed in the given folders, with the
+	// permission the user holds on each directly
+	Documents(ctx context.Context, folderIDs []int, userID int) ([]models.Document, error)
+	// Collaborators returns the users a folder is shared with, by name
+	Collaborators(ctx context.Context, id int) ([]models.Collaborator, error)
+	// Share creates or replaces a user's permission on a folder
+	Share(ctx context.Context, id, userID int, permission string) error
+	Unshare(ctx context.Context, id, userID int) error
+}
+
+type folderRepo struct {
+	conn
+}
+
+func (r *folderRepo) Create(ctx context.Context, ownerID int, parentID *int, name string) (models.Folder, error) {
+	var folder models.Folder
+	err := r.queryRow(ctx, db.CreateFolderQuery, folderFields(&folder), ownerID, parentID, name)
+	return folder, err
+}
+
+func (r *folderRepo) Get(ctx context.Context, id int) (models.Folder, error) {
+	var folder models.Folder
+	err := r.queryRow(ctx, db.GetFolderQuery, folderFields(&folder), id)
+	return folder, err
+}
+
+func (r *folderRepo) Rename(ctx context.Context, id int, name string) (models.Folder, error) {
+	var folder models.Folder
+	err := r.queryRow(ctx, db.RenameFolderQuery, folderFields(&folder), name, id)
+	return folder, err
+}
+
+func (r *folderRepo) Move(ctx context.Context, id int, parentID *int) (models.Folder, error) {
+	var folder models.Folder
+	err := r.queryRow(ctx, db.MoveFolderQuery, folderFields(&folder), parentID, id)
+	return folder, err
+}
+
+func (r *folderRepo) Delete(ctx context.Context, id int) error {
+	return r.execOne(ctx, db.DeleteFolderQuery, id)
+}
+
+func (r *folderRepo) LockTree(ctx context.Context, ownerID int) error {
+	_, err := r.exec(ctx, db.LockFolderTreeQuery, ownerID)
+	return err
+}
+
+func (r *folderRepo) IsWithin(ctx context.Context, ancestorID, folderID int) (bool, error) {
+	var within bool
+	err := r.queryRow(ctx, db.IsFolderWithinQuery, []interface{}{&within}, ancestorID, folderID)
+	return within, err
+}
+
+func (r *folderRepo) Roots(ctx context.Context, userID int) ([]models.Folder, error) {
+	return r.folders(ctx, db.GetFolderRootsQuery, userID)
+}
+
+func (r *folderRepo) Subtree(ctx context.Context, folderIDs []int, userID int) ([]models.Folder, error) {
+	return r.folders(ctx, db.GetFolderSubtreeQuery, pq.Array(folderIDs), userID)
+}
+
+func (r *folderRepo) Documents(ctx context.Context, folderIDs []int, userID int) ([]models.Document, error) {
+	documents := []models.Document{}
+	err := r.query(ctx, db.GetFolderDocumentsQuery, func(row scanner) error {
+		var doc models.Document
+		var permission sql.NullString
+		if err := row.Scan(&doc.ID, &doc.UserID, &doc.FolderID, &doc.Title, &doc.IsTemplate, &doc.CreatedAt, &doc.UpdatedAt, &doc.Version, &permission); err != nil {
+			return err
+		}
+		doc.Permission = permission.String
+		documents = append(documents, doc)
+		return nil
+	}, pq.Array(folderIDs), userID)
+	return documents, err
+}
+
+func (r *folderRepo) Collaborators(ctx context.Context, id int) ([]models.Collaborator, error) {
+	collaborators := []models.Collaborator{}
+	err := r.query(ctx, db.GetFolderCollaboratorsQuery, func(row scanner) error {
+		var collaborator models.Collaborator
+		if err := row.Scan(&collaborator.UserID, &collaborator.Name, &collaborator.Email, &collaborator.Permission); err != nil {
+			return err
+		}
+		collaborators = append(collaborators, collaborator)
+		return nil
+	}, id)
+	return collaborators, err
+}
+
+func (r *folderRepo) Share(ctx context.Context, id, userID int, permission string) error {
+	_, err := r.exec(ctx, db.UpsertFolderPermissionQuery, id, userID, permission)
+	return err
+}
+
+func (r *folderRepo) Unshare(ctx context.Context, id, userID int) error {
+	return r.execOne(ctx, db.DeleteFolderPermissionQuery, id, userID)
+}
+
+// folders scans folder rows followed by the user's permission on each
+func (r *folderRepo) folders(ctx context.Context, query string, args ...interface{}) ([]models.Folder, error) {
+	folders := []models.Folder{}
+	err := r.query(ctx, query, func(row scanner) error {
+		var folder models.Folder
+		var permission sql.NullString
+		if err := row.Scan(append(folderFields(&folder), &permission)...); err != nil {
+			return err
+		}
+		folder.Permission = permission.String
+		folders = append(folders, folder)
+		return nil
+	}, args...)
+	return folders, err
+}
+
+// folderFields lists the columns every folder query returns, in order
+func folderFields(folder *models.Folder) []interface{} {
+	return []interface{}{&folder.ID, &folder.UserID, &folder.ParentID, &folder.Name, &folder.CreatedAt, &folder.UpdatedAt}
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// OperationRepo manages the operations a document has received since its last
+// compaction, kept in Documents.operations
+type OperationRepo interface {
+	Pending(ctx context.Context, documentID int) ([]models.Operation, error)
+	Replace(ctx context.Context, documentID int, operations []models.Operation) error
+	// Clear drops the first count pending operations once compaction has folded
+	// them into the snapshot built on version, advancing the snapshot version by
+	// count. Operations appended since are kept. It returns sql.ErrNoRows if the
+	// document was compacted from a different version in the meantime.
+	Clear(ctx context.Context, documentID, version, count int) error
+}
+
+type operationRepo struct {
+	conn
+}
+
+func (r *operationRepo) Pending(ctx context.Context, documentID int) ([]models.Operation, error) {
+	var raw sql.NullString
+	if err := r.queryRow(ctx, db.GetDocumentOperationsQuery, []interface{}{&raw}, documentID); err != nil {
+		return nil, err
+	}
+	operations := []models.Operation{}
+	if raw.Valid {
+		if err := json.Unmarshal([]byte(raw.String), &operations); err != nil {
+			return nil, fmt.Errorf("failed to parse operations of document %d: %w", documentID, err)
+		}
+	}
+	return operations, nil
+}
+
+func (r *operationRepo) Replace(ctx context.Context, documentID int, operations []models.Operation) error {
+	if operations == nil {
+		operations = []models.Operation{}
+	}
+	data, err := json.Marshal(operations)
+	if err != nil {
+		return err
+	}
+	return r.execOne(ctx, db.UpdateDocumentOperationsQuery, string(data), documentID)
+}
+
+func (r *operationRepo) Clear(ctx context.Context, documentID, version, count int) error {
+	return r.execOne(ctx, db.ClearDocumentOperationsQuery, documentID, count, version)
+}
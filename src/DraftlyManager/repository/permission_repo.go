@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"time"
+)
+
+// PermissionRepo reads and writes DocumentPermissions. The ensure_owner_permission
+// trigger keeps an 'edit' row for the document's owner, which is listed along
+// with everyone else's; the owner role itself comes from Documents.user_id.
+type PermissionRepo interface {
+	// ForDocument returns the permissions stored for a document
+	ForDocument(ctx context.Context, documentID int) ([]models.Permission, error)
+	// Collaborators returns the users a document is shared with, by name
+	Collaborators(ctx context.Context, documentID int) ([]models.Collaborator, error)
+	Create(ctx context.Context, documentID, userID int, permission string) error
+	Update(ctx context.Context, documentID, userID int, permission string) error
+	// Upsert creates the permission or replaces an existing one
+	Upsert(ctx context.Context, documentID, userID int, permission string) error
+	Delete(ctx context.Context, documentID, userID int) error
+}
+
+type permissionRepo struct {
+	conn
+}
+
+func (r *permissionRepo) ForDocument(ctx context.Context, documentID int) ([]models.Permission, error) {
+	permissions := []models.Permission{}
+	err := r.query(ctx, db.GetDocumentPermissionsQuery, func(row scanner) error {
+		var permission models.Permission
+		var createdAt, updatedAt time.Time
+		if err := row.Scan(&permission.UserID, &permission.Permission, &createdAt, &updatedAt); err != nil {
+			return err
+		}
+		permissions = append(permissions, permission)
+		return nil
+	}, documentID)
+	return permissions, err
+}
+
+func (r *permissionRepo) Collaborators(ctx context.Context, documentID int) ([]models.Collaborator, error) {
+	collaborators := []models.Collaborator{}
+	err := r.query(ctx, db.GetUsersWithDocumentAccessQuery, func(row scanner) error {
+		var collaborator models.Collaborator
+		if err := row.Scan(&collaborator.UserID, &collaborator.Name, &collaborator.Email, &collaborator.Permission); err != nil {
+			return err
+		}
+		collaborators = append(collaborators, collaborator)
+		return nil
+	}, documentID)
+	return collaborators, err
+}
+
+func (r *permissionRepo) Create(ctx context.Context, documentID, userID int, permission string) error {
+	_, err := r.exec(ctx, db.CreatePermissionQuery, documentID, userID, permission)
+	return err
+}
+
+func (r *permissionRepo) Update(ctx context.Context, documentID, userID int, permission string) error {
+	return r.execOne(ctx, db.UpdatePermissionQuery, permission, documentID, userID)
+}
+
+func (r *permissionRepo) Upsert(ctx context.Context, documentID, userID int, permission string) error {
+	_, err := r.exec(ctx, db.UpsertPermissionQuery, documentID, userID, permission)
+	return err
+}
+
+func (r *permissionRepo) Delete(ctx context.Context, documentID, userID int) error {
+	return r.execOne(ctx, db.DeletePermissionQuery, documentID, userID)
+}
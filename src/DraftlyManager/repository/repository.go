@@ -0,0 +1,187 @@
+// Package repository maps the tables queried in db/schema.go onto models types,
+// so handlers never see raw rows. Lookups that match nothing return
+// sql.ErrNoRows, which handlers already translate into a 404.
+package repository
+
+import (
+	"Draftly/CRUD/services"
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Repos groups the repositories a handler can use
+type Repos struct {
+	Users       UserRepo
+	Documents   DocumentRepo
+	Permissions PermissionRepo
+	Operations  OperationRepo
+	Search      SearchRepo
+	Folders     FolderRepo
+	Comments    CommentRepo
+	ShareLinks  ShareLinkRepo
+	Sessions    SessionRepo
+	Access      AccessRepo
+}
+
+// Store hands out repositories that run on the connection pool, or inside a
+// transaction started with Begin. Handlers depend on this interface so it can
+// be replaced with a fake.
+type Store interface {
+	Repos() Repos
+	// Begin starts a transaction bounded by the query timeout
+	Begin(ctx context.Context) (Tx, error)
+	// BeginExtended starts a transaction bounded by the query timeout plus
+	// extra, for transactions that also wait on other services
+	BeginExtended(ctx context.Context, extra time.Duration) (Tx, error)
+}
+
+// Tx is an open transaction. Its repositories run every statement inside it.
+// Rollback after Commit is a no-op, so it can always be deferred.
+type Tx interface {
+	Repos() Repos
+	Commit() error
+	Rollback() error
+}
+
+// querier is implemented by both *sql.DB and *sql.Tx
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+type pgStore struct {
+	db      *sql.DB
+	timeout time.Duration
+	repos   Repos
+}
+
+// NewStore creates a Store on the database service's connection pool, using
+// its per-statement timeout
+func NewStore(dbService *services.DatabaseService) Store {
+	return &pgStore{
+		db:      dbService.DB(),
+		timeout: dbService.Timeout(),
+		repos:   newRepos(conn{q: dbService.DB(), timeout: dbService.Timeout()}),
+	}
+}
+
+func (s *pgStore) Repos() Repos {
+	return s.repos
+}
+
+func (s *pgStore) Begin(ctx context.Context) (Tx, error) {
+	return s.BeginExtended(ctx, 0)
+}
+
+func (s *pgStore) BeginExtended(ctx context.Context, extra time.Duration) (Tx, error) {
+	// The whole transaction shares one timeout; it is rolled back when it expires
+	ctx, cancel := context.WithTimeout(ctx, s.timeout+extra)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	return &pgTx{tx: tx, cancel: cancel, repos: newRepos(conn{q: tx, timeout: s.timeout})}, nil
+}
+
+type pgTx struct {
+	tx     *sql.Tx
+	cancel context.CancelFunc
+	repos  Repos
+}
+
+func (t *pgTx) Repos() Repos {
+	return t.repos
+}
+
+func (t *pgTx) Commit() error {
+	defer t.cancel()
+	return t.tx.Commit()
+}
+
+func (t *pgTx) Rollback() error {
+	defer t.cancel()
+	if err := t.tx.Rollback(); err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
+
+func newRepos(c conn) Repos {
+	return Repos{
+		Users:       &userRepo{c},
+		Documents:   &documentRepo{c},
+		Permissions: &permissionRepo{c},
+		Operations:  &operationRepo{c},
+		Search:      &searchRepo{c},
+		Folders:     &folderRepo{c},
+		Comments:    &commentRepo{c},
+		ShareLinks:  &shareLinkRepo{c},
+		Sessions:    &sessionRepo{c},
+		Access:      &accessRepo{c},
+	}
+}
+
+// conn runs statements with the per-statement timeout applied
+type conn struct {
+	q       querier
+	timeout time.Duration
+}
+
+// queryRow scans the single row returned by query into dest
+func (c conn) queryRow(ctx context.Context, query string, dest []interface{}, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	return c.q.QueryRowContext(ctx, query, args...).Scan(dest...)
+}
+
+// query calls scan once for each row returned by query
+func (c conn) query(ctx context.Context, query string, scan func(scanner) error, args ...interface{}) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	rows, err := c.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// exec runs a statement and returns the number of rows it affected
+func (c conn) exec(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	result, err := c.q.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// execOne runs a statement that must affect a row, returning sql.ErrNoRows if
+// it matched none
+func (c conn) execOne(ctx context.Context, query string, args ...interface{}) error {
+	rows, err := c.exec(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+	"strings"
+)
+
+// SearchRepo maintains and queries the full-text index of document contents
+type SearchRepo interface {
+	// Index replaces the text a document is searched by
+	Index(ctx context.Context, documentID int, content string) error
+	// Search returns up to limit documents the user can access that match the
+	// query, best match first
+	Search(ctx context.Context, userID int, query string, limit int) ([]models.SearchHit, error)
+}
+
+type searchRepo struct {
+	conn
+}
+
+// highlightMarkers removes the snippet markers from indexed text
+var highlightMarkers = strings.NewReplacer(db.HighlightStart, "", db.HighlightStop, "")
+
+func (r *searchRepo) Index(ctx context.Context, documentID int, content string) error {
+	_, err := r.exec(ctx, db.IndexDocumentQuery, documentID, highlightMarkers.Replace(content))
+	return err
+}
+
+func (r *searchRepo) Search(ctx context.Context, userID int, query string, limit int) ([]models.SearchHit, error) {
+	hits := []models.SearchHit{}
+	err := r.query(ctx, db.SearchDocumentsQuery, func(row scanner) error {
+		var hit models.SearchHit
+		var permission sql.NullString
+		var snippet string
+		if err := row.Scan(&hit.ID, &hit.UserID, &hit.FolderID, &hit.Title, &hit.IsTemplate, &hit.CreatedAt, &hit.UpdatedAt,
+			&hit.Version, &permission, &hit.Rank, &snippet); err != nil {
+			return err
+		}
+		hit.Permission = permission.String
+		hit.Snippet, hit.Highlights = splitHighlights(snippet)
+		hits = append(hits, hit)
+		return nil
+	}, userID, query, limit)
+	return hits, err
+}
+
+// splitHighlights strips the ts_headline markers from a snippet and returns
+// the character ranges they enclosed
+func splitHighlights(snippet string) (string, []models.TextRange) {
+	var text strings.Builder
+	highlights := []models.TextRange{}
+	position, start := 0, -1
+	for _, char := range snippet {
+		switch string(char) {
+		case db.HighlightStart:
+			start = position
+		case db.HighlightStop:
+			if start >= 0 && position > start {
+				highlights = append(highlights, models.TextRange{Start: start, End: position})
+			}
+			start = -1
+		default:
+			text.WriteRune(char)
+			position++
+		}
+	}
+	return text.String(), highlights
+}
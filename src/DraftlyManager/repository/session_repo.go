@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"context"
+	"time"
+)
+
+// SessionRepo reads and writes Sessions. A signed token is only accepted while
+// its session row is live, which is what lets logout revoke it.
+type SessionRepo interface {
+	Create(ctx context.Context, sessionID string, userID int, expiresAt time.Time) error
+	// ActiveUserID returns the user of a session that is neither revoked nor
+	// expired
+	ActiveUserID(ctx context.Context, sessionID string) (int, error)
+	// Revoke ends a session; revoking one that has already ended is not an error
+	Revoke(ctx context.Context, sessionID string) error
+}
+
+type sessionRepo struct {
+	conn
+}
+
+func (r *sessionRepo) Create(ctx context.Context, sessionID string, userID int, expiresAt time.Time) error {
+	_, err := r.exec(ctx, db.CreateSessionQuery, sessionID, userID, expiresAt)
+	return err
+}
+
+func (r *sessionRepo) ActiveUserID(ctx context.Context, sessionID string) (int, error) {
+	var userID int
+	err := r.queryRow(ctx, db.GetActiveSessionQuery, []interface{}{&userID}, sessionID)
+	return userID, err
+}
+
+func (r *sessionRepo) Revoke(ctx context.Context, sessionID string) error {
+	_, err := r.exec(ctx, db.RevokeSessionQuery, sessionID)
+	return err
+}
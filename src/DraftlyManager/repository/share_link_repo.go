@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+	"time"
+)
+
+// ShareLinkRepo reads and writes ShareLinks. Only token hashes are stored, so
+// links are looked up by the hash of the token a holder presents.
+type ShareLinkRepo interface {
+	// Create stores a link; a nil expiresAt never expires
+	Create(ctx context.Context, documentID int, tokenHash, permission string, createdBy int, expiresAt *time.Time) (models.ShareLink, error)
+	// ForDocument returns a document's links that have not been revoked, newest first
+	ForDocument(ctx context.Context, documentID int) ([]models.ShareLink, error)
+	// GetByTokenHash returns a link even if it is revoked or expired
+	GetByTokenHash(ctx context.Context, tokenHash string) (models.ShareLink, error)
+	Revoke(ctx context.Context, id, documentID int) error
+}
+
+type shareLinkRepo struct {
+	conn
+}
+
+func (r *shareLinkRepo) Create(ctx context.Context, documentID int, tokenHash, permission string, createdBy int, expiresAt *time.Time) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := r.queryRow(ctx, db.CreateShareLinkQuery, shareLinkFields(&link), documentID, tokenHash, permission, createdBy, expiresAt)
+	return link, err
+}
+
+func (r *shareLinkRepo) ForDocument(ctx context.Context, documentID int) ([]models.ShareLink, error) {
+	links := []models.ShareLink{}
+	err := r.query(ctx, db.GetDocumentShareLinksQuery, func(row scanner) error {
+		var link models.ShareLink
+		if err := row.Scan(shareLinkFields(&link)...); err != nil {
+			return err
+		}
+		links = append(links, link)
+		return nil
+	}, documentID)
+	return links, err
+}
+
+func (r *shareLinkRepo) GetByTokenHash(ctx context.Context, tokenHash string) (models.ShareLink, error) {
+	var link models.ShareLink
+	err := r.queryRow(ctx, db.GetShareLinkByTokenQuery, shareLinkFields(&link), tokenHash)
+	return link, err
+}
+
+func (r *shareLinkRepo) Revoke(ctx context.Context, id, documentID int) error {
+	return r.execOne(ctx, db.RevokeShareLinkQuery, id, documentID)
+}
+
+// shareLinkFields lists the columns every share link query returns, in order
+func shareLinkFields(link *models.ShareLink) []interface{} {
+	return []interface{}{&link.ID, &link.DocumentID, &link.Permission, &link.CreatedBy, &link.CreatedAt, &link.ExpiresAt, &link.RevokedAt}
+}
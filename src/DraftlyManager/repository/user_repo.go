@@ -0,0 +1,85 @@
+package repository
+
+import (
+	"Draftly/CRUD/db"
+	"Draftly/CRUD/models"
+	"context"
+)
+
+// UserRepo reads and writes Users and their credentials
+type UserRepo interface {
+	Create(ctx context.Context, name, email string) (models.User, error)
+	// CreateCredentials stores the password hash for a new user
+	CreateCredentials(ctx context.Context, userID int, passwordHash string) error
+	// GetCredentials returns the user with an email and their password hash
+	GetCredentials(ctx context.Context, email string) (models.User, string, error)
+	Get(ctx context.Context, id int) (models.User, error)
+	GetByEmail(ctx context.Context, email string) (models.User, error)
+	// List returns a page of users matching the options
+	List(ctx context.Context, opts db.UserListOptions) ([]models.User, error)
+	Update(ctx context.Context, id int, name, email string) (models.User, error)
+	Delete(ctx context.Context, id int) error
+}
+
+type userRepo struct {
+	conn
+}
+
+func (r *userRepo) Create(ctx context.Context, name, email string) (models.User, error) {
+	var user models.User
+	err := r.queryRow(ctx, db.CreateUserQuery, userFields(&user), name, email)
+	return user, err
+}
+
+func (r *userRepo) CreateCredentials(ctx context.Context, userID int, passwordHash string) error {
+	_, err := r.exec(ctx, db.CreateCredentialsQuery, userID, passwordHash)
+	return err
+}
+
+func (r *userRepo) GetCredentials(ctx context.Context, email string) (models.User, string, error) {
+	var user models.User
+	var passwordHash string
+	err := r.queryRow(ctx, db.GetCredentialsByEmailQuery, append(userFields(&user), &passwordHash), email)
+	return user, passwordHash, err
+}
+
+func (r *userRepo) Get(ctx context.Context, id int) (models.User, error) {
+	var user models.User
+	err := r.queryRow(ctx, db.GetUserByIDQuery, userFields(&user), id)
+	return user, err
+}
+
+func (r *userRepo) GetByEmail(ctx context.Context, email string) (models.User, error) {
+	var user models.User
+	err := r.queryRow(ctx, db.GetUserByEmailQuery, userFields(&user), email)
+	return user, err
+}
+
+func (r *userRepo) List(ctx context.Context, opts db.UserListOptions) ([]models.User, error) {
+	query, args := db.ListUsersQuery(opts)
+	users := []models.User{}
+	err := r.query(ctx, query, func(row scanner) error {
+		var user models.User
+		if err := row.Scan(userFields(&user)...); err != nil {
+			return err
+		}
+		users = append(users, user)
+		return nil
+	}, args...)
+	return users, err
+}
+
+func (r *userRepo) Update(ctx context.Context, id int, name, email string) (models.User, error) {
+	var user models.User
+	err := r.queryRow(ctx, db.UpdateUserQuery, userFields(&user), name, email, id)
+	return user, err
+}
+
+func (r *userRepo) Delete(ctx context.Context, id int) error {
+	return r.execOne(ctx, db.DeleteUserQuery, id)
+}
+
+// userFields lists the columns every user query returns, in order
+func userFields(user *models.User) []interface{} {
+	return []interface{}{&user.ID, &user.Name, &user.Email, &user.CreatedAt, &user.UpdatedAt}
+}
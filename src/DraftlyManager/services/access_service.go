@@ -0,0 +1,185 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// Role is a user's effective access to a document, ordered from least to most
+type Role int
+
+const (
+	RoleNone Role = iota
+	RoleViewer
+	RoleCommenter
+	RoleEditor
+	RoleOwner
+)
+
+// String returns the permission name used by the API
+func (r Role) String() string {
+	switch r {
+	case RoleViewer:
+		return models.PermissionViewOnly
+	case RoleCommenter:
+		return models.PermissionComment
+	case RoleEditor:
+		return models.PermissionEdit
+	case RoleOwner:
+		return models.PermissionOwner
+	}
+	return "none"
+}
+
+// Action is something a user can do to a document
+type Action string
+
+const (
+	ActionRead    Action = "read"    // view metadata, content and comments
+	ActionComment Action = "comment" // start, reply to, resolve and reopen comment threads
+	ActionEdit    Action = "edit"    // change content and title
+	ActionShare   Action = "share"   // grant, change or revoke other users' access
+	ActionDelete  Action = "delete"  // delete the document
+	ActionMove    Action = "move"    // file the document in a folder, or a folder in another
+)
+
+// requiredRoles is the minimum role for each action
+var requiredRoles = map[Action]Role{
+	ActionRead:    RoleViewer,
+	ActionComment: RoleCommenter,
+	ActionEdit:    RoleEditor,
+	ActionShare:   RoleOwner,
+	ActionDelete:  RoleOwner,
+	ActionMove:    RoleOwner,
+}
+
+var (
+	ErrDocumentNotFound = errors.New("document not found")
+	ErrFolderNotFound   = errors.New("folder not found")
+	ErrForbidden        = errors.New("insufficient permission")
+)
+
+// AccessService is the single place document and folder permissions are
+// evaluated. Access granted on a folder applies to everything beneath it, and a
+// user's role is the highest of their own and what they inherit.
+type AccessService struct {
+	grants GrantReader
+}
+
+// GrantReader looks up the grants AccessService evaluates. It is implemented by
+// repository.AccessRepo, which this package cannot import.
+type GrantReader interface {
+	DocumentGrants(ctx context.Context, documentID, userID int) (models.DocumentGrants, error)
+	FolderGrants(ctx context.Context, folderID, userID int) (models.FolderGrants, error)
+}
+
+// NewAccessService creates a new access service instance
+func NewAccessService(grants GrantReader) *AccessService {
+	return &AccessService{grants: grants}
+}
+
+// DocumentRole returns the user's role on a document. Missing documents return
+// ErrDocumentNotFound.
+func (a *AccessService) DocumentRole(ctx context.Context, documentID, userID int) (Role, error) {
+	grants, err := a.grants.DocumentGrants(ctx, documentID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RoleNone, ErrDocumentNotFound
+		}
+		return RoleNone, err
+	}
+
+	if grants.OwnerID == userID {
+		return RoleOwner, nil
+	}
+	return highestRole(append(grants.Inherited, grants.Permission)), nil
+}
+
+// OwnerID returns the user who owns the document
+func (a *AccessService) OwnerID(ctx context.Context, documentID int) (int, error) {
+	grants, err := a.grants.DocumentGrants(ctx, documentID, 0)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrDocumentNotFound
+	}
+	return grants.OwnerID, err
+}
+
+// Authorize checks that the user may perform action on the document. Users with
+// no access at all get ErrDocumentNotFound so document IDs are not leaked.
+func (a *AccessService) Authorize(ctx context.Context, documentID, userID int, action Action) (Role, error) {
+	role, err := a.DocumentRole(ctx, documentID, userID)
+	if err != nil {
+		return role, err
+	}
+	return role, checkRole(role, action, ErrDocumentNotFound)
+}
+
+// FolderRole returns the user's role on a folder. Missing folders return
+// ErrFolderNotFound.
+func (a *AccessService) FolderRole(ctx context.Context, folderID, userID int) (Role, error) {
+	grants, err := a.grants.FolderGrants(ctx, folderID, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return RoleNone, ErrFolderNotFound
+		}
+		return RoleNone, err
+	}
+
+	if grants.OwnerID == userID {
+		return RoleOwner, nil
+	}
+	return highestRole(grants.Permissions), nil
+}
+
+// AuthorizeFolder checks that the user may perform action on the folder, with
+// the same rules as Authorize. Reading a folder lists what is inside it.
+func (a *AccessService) AuthorizeFolder(ctx context.Context, folderID, userID int, action Action) (Role, error) {
+	role, err := a.FolderRole(ctx, folderID, userID)
+	if err != nil {
+		return role, err
+	}
+	return role, checkRole(role, action, ErrFolderNotFound)
+}
+
+// checkRole reports whether role allows action, returning notFound when the
+// user has no access at all
+func checkRole(role Role, action Action, notFound error) error {
+	required, ok := requiredRoles[action]
+	if !ok {
+		return fmt.Errorf("unknown action %q", action)
+	}
+	if role == RoleNone {
+		return notFound
+	}
+	if role < required {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// highestRole returns the strongest of a set of permissions
+func highestRole(permissions []string) Role {
+	role := RoleNone
+	for _, permission := range permissions {
+		role = max(role, RoleFromPermission(permission))
+	}
+	return role
+}
+
+// RoleFromPermission maps a DocumentPermissions value onto a Role
+func RoleFromPermission(permission string) Role {
+	switch permission {
+	case models.PermissionOwner:
+		return RoleOwner
+	case models.PermissionEdit:
+		return RoleEditor
+	case models.PermissionComment:
+		return RoleCommenter
+	case models.PermissionViewOnly:
+		return RoleViewer
+	}
+	return RoleNone
+}
@@ -0,0 +1,186 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	passwordScheme     = "pbkdf2-sha256"
+	passwordIterations = 600000
+	passwordSaltLength = 16
+	passwordKeyLength  = 32
+	defaultSessionTTL  = 24 * time.Hour
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrExpiredToken = errors.New("token expired")
+)
+
+// TokenClaims is the signed payload of a bearer token
+type TokenClaims struct {
+	SessionID string `json:"sid"`
+	UserID    int    `json:"uid"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// AuthService hashes passwords and signs session tokens
+type AuthService struct {
+	secret     []byte
+	sessionTTL time.Duration
+	dummyHash  string // verified against for unknown accounts, see DummyPasswordHash
+}
+
+// NewAuthService creates a new auth service from AUTH_SECRET and SESSION_TTL
+func NewAuthService() (*AuthService, error) {
+	secret := os.Getenv("AUTH_SECRET")
+	if len(secret) < 32 {
+		return nil, fmt.Errorf("AUTH_SECRET environment variable must be at least 32 characters")
+	}
+
+	ttl := defaultSessionTTL
+	if raw := os.Getenv("SESSION_TTL"); raw != "" {
+		parsed, err := time.ParseDuration(raw)
+		if err != nil || parsed <= 0 {
+			return nil, fmt.Errorf("invalid SESSION_TTL %q", raw)
+		}
+		ttl = parsed
+	}
+
+	service := &AuthService{
+		secret:     []byte(secret),
+		sessionTTL: ttl,
+	}
+	dummy := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(dummy); err != nil {
+		return nil, fmt.Errorf("failed to generate dummy password: %w", err)
+	}
+	dummyHash, err := service.HashPassword(hex.EncodeToString(dummy))
+	if err != nil {
+		return nil, err
+	}
+	service.dummyHash = dummyHash
+	return service, nil
+}
+
+// SessionTTL is how long newly issued sessions stay valid
+func (a *AuthService) SessionTTL() time.Duration {
+	return a.sessionTTL
+}
+
+// HashPassword derives a salted PBKDF2 hash encoded as scheme$iterations$salt$key
+func (a *AuthService) HashPassword(password string) (string, error) {
+	salt := make([]byte, passwordSaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, passwordIterations, passwordKeyLength)
+	if err != nil {
+		return "", fmt.Errorf("failed to hash password: %w", err)
+	}
+
+	return fmt.Sprintf("%s$%d$%s$%s", passwordScheme, passwordIterations,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// VerifyPassword checks a password against a hash produced by HashPassword
+func (a *AuthService) VerifyPassword(hash, password string) bool {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 4 || parts[0] != passwordScheme {
+		return false
+	}
+
+	iterations, err := strconv.Atoi(parts[1])
+	if err != nil || iterations <= 0 {
+		return false
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return false
+	}
+	expected, err := base64.RawStdEncoding.DecodeString(parts[3])
+	if err != nil {
+		return false
+	}
+
+	key, err := pbkdf2.Key(sha256.New, password, salt, iterations, len(expected))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare(key, expected) == 1
+}
+
+// DummyPasswordHash is a hash no password matches, with the same cost as real
+// ones. Checking against it when an account does not exist keeps logins for
+// unknown emails as slow as wrong passwords.
+func (a *AuthService) DummyPasswordHash() string {
+	return a.dummyHash
+}
+
+// NewSessionID returns a random identifier for a session row
+func (a *AuthService) NewSessionID() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate session id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IssueToken signs the claims into a bearer token of the form payload.signature
+func (a *AuthService) IssueToken(claims TokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode token: %w", err)
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + a.sign(encoded), nil
+}
+
+// ParseToken verifies the signature and expiry of a bearer token
+func (a *AuthService) ParseToken(token string) (TokenClaims, error) {
+	var claims TokenClaims
+
+	encoded, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, ErrInvalidToken
+	}
+	if !hmac.Equal([]byte(signature), []byte(a.sign(encoded))) {
+		return claims, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return claims, ErrInvalidToken
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return claims, ErrExpiredToken
+	}
+
+	return claims, nil
+}
+
+// sign returns the base64url HMAC-SHA256 of the encoded payload
+func (a *AuthService) sign(encoded string) string {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(encoded))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
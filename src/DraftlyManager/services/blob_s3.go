@@ -0,0 +1,121 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// S3BlobStore keeps blobs as objects in an S3 bucket
+type S3BlobStore struct {
+	client *s3.Client
+	bucket string
+}
+
+// NewS3BlobStore creates an S3 blob store from S3_BUCKET_NAME, AWS_REGION and
+// the default AWS credential chain
+func NewS3BlobStore() (*S3BlobStore, error) {
+	bucket := os.Getenv("S3_BUCKET_NAME")
+	if bucket == "" {
+		return nil, fmt.Errorf("S3_BUCKET_NAME environment variable is required")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithRegion(os.Getenv("AWS_REGION")),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &S3BlobStore{
+		client: s3.NewFromConfig(cfg),
+		bucket: bucket,
+	}, nil
+}
+
+func (s *S3BlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	_, err := s.client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload %s to S3: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	result, err := s.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrBlobNotFound
+		}
+		return nil, fmt.Errorf("failed to download %s from S3: %w", key, err)
+	}
+	defer result.Body.Close()
+
+	data, err := io.ReadAll(result.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s from S3: %w", key, err)
+	}
+	return data, nil
+}
+
+func (s *S3BlobStore) Delete(ctx context.Context, key string) error {
+	// S3 deletes succeed for missing keys
+	_, err := s.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from S3: %w", key, err)
+	}
+	return nil
+}
+
+func (s *S3BlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check %s in S3: %w", key, err)
+	}
+	return true, nil
+}
+
+func (s *S3BlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	keys := []string{}
+	paginator := s3.NewListObjectsV2Paginator(s.client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(prefix),
+	})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list S3 objects: %w", err)
+		}
+		for _, object := range page.Contents {
+			keys = append(keys, aws.ToString(object.Key))
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,140 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrBlobNotFound is returned by BlobStore.Get for keys that do not exist
+var ErrBlobNotFound = errors.New("blob not found")
+
+// BlobStore stores document content as opaque blobs addressed by key.
+// Keys are slash-separated paths such as "documents/12.txt".
+type BlobStore interface {
+	// Put creates or replaces the blob at key
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the blob at key, or ErrBlobNotFound
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Delete removes the blob at key; deleting a missing key is not an error
+	Delete(ctx context.Context, key string) error
+	// Exists reports whether a blob is stored at key
+	Exists(ctx context.Context, key string) (bool, error)
+	// List returns the keys starting with prefix in lexical order
+	List(ctx context.Context, prefix string) ([]string, error)
+}
+
+// NewBlobStore creates the backend named by BLOB_STORE: "s3", "local" or
+// "memory", and logs which one it chose. Without BLOB_STORE, S3 is used when
+// S3_BUCKET_NAME is set and the local disk otherwise, so the service runs
+// without AWS.
+func NewBlobStore() (BlobStore, error) {
+	backend := strings.ToLower(os.Getenv("BLOB_STORE"))
+	if backend == "" {
+		backend = "local"
+		if os.Getenv("S3_BUCKET_NAME") != "" {
+			backend = "s3"
+		}
+	}
+
+	switch backend {
+	case "s3":
+		store, err := NewS3BlobStore()
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using S3 blob store")
+		return store, nil
+	case "local":
+		root := os.Getenv("BLOB_STORE_PATH")
+		if root == "" {
+			root = "data/blobs"
+		}
+		store, err := NewLocalBlobStore(root)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using local blob store at %s", root)
+		return store, nil
+	case "memory":
+		log.Printf("WARNING: using in-memory blob store, document content is lost on restart")
+		return NewMemoryBlobStore(), nil
+	}
+	return nil, fmt.Errorf("unknown BLOB_STORE %q (want s3, local or memory)", backend)
+}
+
+// MemoryBlobStore keeps blobs in memory. It is meant for tests and local runs.
+type MemoryBlobStore struct {
+	mu    sync.RWMutex
+	blobs map[string][]byte
+}
+
+// NewMemoryBlobStore creates an empty in-memory blob store
+func NewMemoryBlobStore() *MemoryBlobStore {
+	return &MemoryBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (m *MemoryBlobStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	// Copy so callers can reuse their buffer
+	m.blobs[key] = append([]byte(nil), data...)
+	return nil
+}
+
+func (m *MemoryBlobStore) Get(ctx context.Context, key string) ([]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	data, ok := m.blobs[key]
+	if !ok {
+		return nil, ErrBlobNotFound
+	}
+	return append([]byte(nil), data...), nil
+}
+
+func (m *MemoryBlobStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.blobs, key)
+	return nil
+}
+
+func (m *MemoryBlobStore) Exists(ctx context.Context, key string) (bool, error) {
+	if err := ctx.Err(); err != nil {
+		return false, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	_, ok := m.blobs[key]
+	return ok, nil
+}
+
+func (m *MemoryBlobStore) List(ctx context.Context, prefix string) ([]string, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := []string{}
+	for key := range m.blobs {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
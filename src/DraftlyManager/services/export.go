@@ -0,0 +1,262 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"errors"
+	"fmt"
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// ErrUnsupportedFormat is returned for export formats we cannot produce
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+// ExportFormat describes one downloadable representation of a document
+type ExportFormat struct {
+	Extension   string
+	ContentType string
+	render      func(title string, lines []exportLine) ([]byte, error)
+}
+
+// ExportFormats lists the supported export formats by their query value
+var ExportFormats = map[string]ExportFormat{
+	"txt":  {Extension: "txt", ContentType: "text/plain; charset=utf-8", render: renderText},
+	"md":   {Extension: "md", ContentType: "text/markdown; charset=utf-8", render: renderMarkdown},
+	"html": {Extension: "html", ContentType: "text/html; charset=utf-8", render: renderHTML},
+	"pdf":  {Extension: "pdf", ContentType: "application/pdf", render: renderPDF},
+	"docx": {Extension: "docx", ContentType: "application/vnd.openxmlformats-officedocument.wordprocessingml.document", render: renderDOCX},
+}
+
+// ExportDocument renders a document in the requested format
+func ExportDocument(title string, delta models.Delta, format string) ([]byte, ExportFormat, error) {
+	exportFormat, ok := ExportFormats[format]
+	if !ok {
+		return nil, ExportFormat{}, ErrUnsupportedFormat
+	}
+	body, err := exportFormat.render(title, exportLines(delta))
+	if err != nil {
+		return nil, ExportFormat{}, fmt.Errorf("failed to render %s: %w", format, err)
+	}
+	return body, exportFormat, nil
+}
+
+// ExportFileName derives a download file name from the document title
+func ExportFileName(title string, format ExportFormat) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			return -1
+		case strings.ContainsRune(`/\:*?"<>|`, r):
+			return '_'
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+	if name == "" {
+		name = "document"
+	}
+	if len(name) > 200 {
+		// Cut on a rune boundary
+		name = strings.ToValidUTF8(name[:200], "")
+	}
+	return name + "." + format.Extension
+}
+
+// exportLine is one paragraph of the document: its inline runs without the
+// newline, and the block attributes (header, list) set on that newline
+type exportLine struct {
+	runs  []models.Run
+	block models.Attributes
+}
+
+func exportLines(delta models.Delta) []exportLine {
+	lines := []exportLine{{}}
+	for _, run := range delta.Ops {
+		for i, part := range strings.Split(run.Insert, "\n") {
+			if i > 0 {
+				lines[len(lines)-1].block = run.Attributes
+				lines = append(lines, exportLine{})
+			}
+			if part != "" {
+				current := &lines[len(lines)-1]
+				current.runs = append(current.runs, models.Run{Insert: part, Attributes: run.Attributes})
+			}
+		}
+	}
+	// A final newline terminates the last line rather than starting an empty one
+	if len(lines) > 1 && len(lines[len(lines)-1].runs) == 0 {
+		lines = lines[:len(lines)-1]
+	}
+	if len(lines) == 1 && len(lines[0].runs) == 0 {
+		return nil
+	}
+	return lines
+}
+
+func listType(block models.Attributes) string {
+	list, _ := block[models.AttributeList].(string)
+	return list
+}
+
+func isTrue(attributes models.Attributes, name string) bool {
+	value, _ := attributes[name].(bool)
+	return value
+}
+
+// safeLink returns the link of a run if it is safe to emit in other formats
+func safeLink(attributes models.Attributes) string {
+	link, _ := attributes[models.AttributeLink].(string)
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	switch strings.ToLower(parsed.Scheme) {
+	case "http", "https", "mailto":
+		return link
+	}
+	return ""
+}
+
+func renderText(title string, lines []exportLine) ([]byte, error) {
+	var b strings.Builder
+	for _, line := range lines {
+		for _, run := range line.runs {
+			b.WriteString(run.Insert)
+		}
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), nil
+}
+
+var (
+	markdownEscaper    = strings.NewReplacer(`\`, `\\`, "*", `\*`, "_", `\_`, "`", "\\`", "[", `\[`, "]", `\]`, "<", `\<`)
+	markdownLineMarker = regexp.MustCompile(`^(#|>|[-+] |\d+\. )`)
+)
+
+func renderMarkdown(title string, lines []exportLine) ([]byte, error) {
+	var b strings.Builder
+	ordered := 0
+	for i, line := range lines {
+		list := listType(line.block)
+		if i > 0 {
+			// List items stay together; everything else is its own paragraph
+			if list != "" && listType(lines[i-1].block) != "" {
+				b.WriteString("\n")
+			} else {
+				b.WriteString("\n\n")
+			}
+		}
+		if list != "ordered" {
+			ordered = 0
+		}
+
+		var text strings.Builder
+		for _, run := range line.runs {
+			text.WriteString(markdownRun(run))
+		}
+
+		switch level := models.HeaderLevel(line.block); {
+		case level > 0:
+			b.WriteString(strings.Repeat("#", level) + " ")
+		case list == "bullet":
+			b.WriteString("- ")
+		case list == "ordered":
+			ordered++
+			fmt.Fprintf(&b, "%d. ", ordered)
+		default:
+			// Keep plain paragraphs from being read as headings or lists
+			if markdownLineMarker.MatchString(text.String()) {
+				b.WriteString(`\`)
+			}
+		}
+		b.WriteString(text.String())
+	}
+	if b.Len() > 0 {
+		b.WriteString("\n")
+	}
+	return []byte(b.String()), nil
+}
+
+func markdownRun(run models.Run) string {
+	text := markdownEscaper.Replace(run.Insert)
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		return text
+	}
+	// Emphasis markers must hug the text, so keep surrounding spaces outside
+	start := strings.Index(text, trimmed)
+	leading, trailing := text[:start], text[start+len(trimmed):]
+
+	if isTrue(run.Attributes, models.AttributeItalic) {
+		trimmed = "*" + trimmed + "*"
+	}
+	if isTrue(run.Attributes, models.AttributeBold) {
+		trimmed = "**" + trimmed + "**"
+	}
+	if link := safeLink(run.Attributes); link != "" {
+		link = strings.NewReplacer(" ", "%20", "(", "%28", ")", "%29").Replace(link)
+		trimmed = "[" + trimmed + "](" + link + ")"
+	}
+	return leading + trimmed + trailing
+}
+
+var htmlListTags = map[string]string{"bullet": "ul", "ordered": "ol"}
+
+func renderHTML(title string, lines []exportLine) ([]byte, error) {
+	var b strings.Builder
+	b.WriteString("<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n")
+	fmt.Fprintf(&b, "<title>%s</title>\n</head>\n<body>\n", html.EscapeString(title))
+
+	openList := ""
+	for _, line := range lines {
+		list := listType(line.block)
+		if list != openList {
+			if openList != "" {
+				b.WriteString("</" + htmlListTags[openList] + ">\n")
+			}
+			if list != "" {
+				b.WriteString("<" + htmlListTags[list] + ">\n")
+			}
+			openList = list
+		}
+
+		var text strings.Builder
+		for _, run := range line.runs {
+			text.WriteString(htmlRun(run))
+		}
+		if text.Len() == 0 {
+			text.WriteString("<br>")
+		}
+
+		switch level := models.HeaderLevel(line.block); {
+		case list != "":
+			fmt.Fprintf(&b, "<li>%s</li>\n", text.String())
+		case level > 0:
+			fmt.Fprintf(&b, "<h%d>%s</h%d>\n", level, text.String(), level)
+		default:
+			fmt.Fprintf(&b, "<p>%s</p>\n", text.String())
+		}
+	}
+	if openList != "" {
+		b.WriteString("</" + htmlListTags[openList] + ">\n")
+	}
+
+	b.WriteString("</body>\n</html>\n")
+	return []byte(b.String()), nil
+}
+
+func htmlRun(run models.Run) string {
+	text := html.EscapeString(run.Insert)
+	if isTrue(run.Attributes, models.AttributeItalic) {
+		text = "<em>" + text + "</em>"
+	}
+	if isTrue(run.Attributes, models.AttributeBold) {
+		text = "<strong>" + text + "</strong>"
+	}
+	if link := safeLink(run.Attributes); link != "" {
+		text = `<a href="` + html.EscapeString(link) + `">` + text + "</a>"
+	}
+	return text
+}
@@ -0,0 +1,183 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strings"
+)
+
+// A DOCX file is a zip of WordprocessingML parts. We write the smallest set
+// Word and LibreOffice accept: content types, relationships, the document,
+// styles for headings and links, and numbering for lists.
+
+const docxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/word/document.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.document.main+xml"/>
+<Override PartName="/word/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.styles+xml"/>
+<Override PartName="/word/numbering.xml" ContentType="application/vnd.openxmlformats-officedocument.wordprocessingml.numbering+xml"/>
+<Override PartName="/docProps/core.xml" ContentType="application/vnd.openxmlformats-package.core-properties+xml"/>
+</Types>`
+
+const docxPackageRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="word/document.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/package/2006/relationships/metadata/core-properties" Target="docProps/core.xml"/>
+</Relationships>`
+
+const docxCoreProperties = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<cp:coreProperties xmlns:cp="http://schemas.openxmlformats.org/package/2006/metadata/core-properties" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<dc:title>%s</dc:title>
+</cp:coreProperties>`
+
+// docxHeadingSizes are font sizes in half-points for Heading1 to Heading6
+var docxHeadingSizes = [...]int{48, 40, 32, 28, 24, 22}
+
+func docxStyles() string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:styles xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:style w:type="paragraph" w:default="1" w:styleId="Normal"><w:name w:val="Normal"/><w:pPr><w:spacing w:after="160"/></w:pPr><w:rPr><w:sz w:val="22"/></w:rPr></w:style>
+`)
+	for i, size := range docxHeadingSizes {
+		fmt.Fprintf(&b, `<w:style w:type="paragraph" w:styleId="Heading%d"><w:name w:val="heading %d"/><w:basedOn w:val="Normal"/><w:next w:val="Normal"/><w:pPr><w:keepNext/><w:spacing w:before="240" w:after="120"/><w:outlineLvl w:val="%d"/></w:pPr><w:rPr><w:b/><w:sz w:val="%d"/></w:rPr></w:style>
+`, i+1, i+1, i, size)
+	}
+	b.WriteString(`<w:style w:type="paragraph" w:styleId="ListParagraph"><w:name w:val="List Paragraph"/><w:basedOn w:val="Normal"/><w:pPr><w:spacing w:after="0"/><w:ind w:left="720"/></w:pPr></w:style>
+<w:style w:type="character" w:styleId="Hyperlink"><w:name w:val="Hyperlink"/><w:rPr><w:color w:val="0563C1"/><w:u w:val="single"/></w:rPr></w:style>
+</w:styles>`)
+	return b.String()
+}
+
+// docxNumbering defines one bullet and one decimal list. Every ordered list in
+// the document gets its own numbering instance so it starts again at 1.
+func docxNumbering(orderedLists int) string {
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:numbering xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main">
+<w:abstractNum w:abstractNumId="0"><w:lvl w:ilvl="0"><w:start w:val="1"/><w:numFmt w:val="bullet"/><w:lvlText w:val="•"/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="720" w:hanging="360"/></w:pPr></w:lvl></w:abstractNum>
+<w:abstractNum w:abstractNumId="1"><w:lvl w:ilvl="0"><w:start w:val="1"/><w:numFmt w:val="decimal"/><w:lvlText w:val="%1."/><w:lvlJc w:val="left"/><w:pPr><w:ind w:left="720" w:hanging="360"/></w:pPr></w:lvl></w:abstractNum>
+<w:num w:numId="1"><w:abstractNumId w:val="0"/></w:num>
+`)
+	for i := 0; i < orderedLists; i++ {
+		fmt.Fprintf(&b, `<w:num w:numId="%d"><w:abstractNumId w:val="1"/><w:lvlOverride w:ilvl="0"><w:startOverride w:val="1"/></w:lvlOverride></w:num>
+`, i+2)
+	}
+	b.WriteString(`</w:numbering>`)
+	return b.String()
+}
+
+func renderDOCX(title string, lines []exportLine) ([]byte, error) {
+	var body strings.Builder
+	var links []string
+	orderedLists := 0
+
+	for i, line := range lines {
+		list := listType(line.block)
+		body.WriteString("<w:p>")
+		switch level := models.HeaderLevel(line.block); {
+		case list == "bullet":
+			body.WriteString(`<w:pPr><w:pStyle w:val="ListParagraph"/><w:numPr><w:ilvl w:val="0"/><w:numId w:val="1"/></w:numPr></w:pPr>`)
+		case list == "ordered":
+			if i == 0 || listType(lines[i-1].block) != "ordered" {
+				orderedLists++
+			}
+			fmt.Fprintf(&body, `<w:pPr><w:pStyle w:val="ListParagraph"/><w:numPr><w:ilvl w:val="0"/><w:numId w:val="%d"/></w:numPr></w:pPr>`, orderedLists+1)
+		case level > 0:
+			fmt.Fprintf(&body, `<w:pPr><w:pStyle w:val="Heading%d"/></w:pPr>`, level)
+		}
+
+		for _, run := range line.runs {
+			var properties strings.Builder
+			link := safeLink(run.Attributes)
+			if link != "" {
+				properties.WriteString(`<w:rStyle w:val="Hyperlink"/>`)
+			}
+			if isTrue(run.Attributes, models.AttributeBold) {
+				properties.WriteString("<w:b/>")
+			}
+			if isTrue(run.Attributes, models.AttributeItalic) {
+				properties.WriteString("<w:i/>")
+			}
+
+			r := "<w:r>"
+			if properties.Len() > 0 {
+				r += "<w:rPr>" + properties.String() + "</w:rPr>"
+			}
+			r += `<w:t xml:space="preserve">` + escapeXML(run.Insert) + "</w:t></w:r>"
+
+			if link != "" {
+				links = append(links, link)
+				// rId1 and rId2 are the styles and numbering parts
+				fmt.Fprintf(&body, `<w:hyperlink r:id="rId%d">%s</w:hyperlink>`, len(links)+2, r)
+			} else {
+				body.WriteString(r)
+			}
+		}
+		body.WriteString("</w:p>\n")
+	}
+
+	var document strings.Builder
+	document.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<w:document xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships">
+<w:body>
+`)
+	document.WriteString(body.String())
+	// A4 with one inch margins, in twentieths of a point
+	document.WriteString(`<w:sectPr><w:pgSz w:w="11906" w:h="16838"/><w:pgMar w:top="1440" w:right="1440" w:bottom="1440" w:left="1440" w:header="708" w:footer="708" w:gutter="0"/></w:sectPr>
+</w:body>
+</w:document>`)
+
+	var documentRels strings.Builder
+	documentRels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+<Relationship Id="rId2" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/numbering" Target="numbering.xml"/>
+`)
+	for i, link := range links {
+		fmt.Fprintf(&documentRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/hyperlink" Target="%s" TargetMode="External"/>
+`, i+3, escapeXML(link))
+	}
+	documentRels.WriteString(`</Relationships>`)
+
+	parts := []struct {
+		name    string
+		content string
+	}{
+		{"[Content_Types].xml", docxContentTypes},
+		{"_rels/.rels", docxPackageRels},
+		{"docProps/core.xml", fmt.Sprintf(docxCoreProperties, escapeXML(title))},
+		{"word/document.xml", document.String()},
+		{"word/styles.xml", docxStyles()},
+		{"word/numbering.xml", docxNumbering(orderedLists)},
+		{"word/_rels/document.xml.rels", documentRels.String()},
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, part := range parts {
+		f, err := archive.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := f.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// escapeXML escapes text for element content and attribute values. Characters
+// XML cannot represent are replaced with U+FFFD.
+func escapeXML(text string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(text))
+	return b.String()
+}
@@ -0,0 +1,353 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"strings"
+)
+
+// PDFs are written by hand with the standard Helvetica fonts, which every
+// reader has built in, so no font files need to be embedded. Text is encoded
+// as WinAnsi; characters outside it are printed as "?".
+
+const (
+	pdfPageWidth  = 595.28 // A4 in points
+	pdfPageHeight = 841.89
+	pdfMargin     = 72.0
+	pdfBodySize   = 11.0
+	pdfLeading    = 1.4
+	pdfListIndent = 24.0
+)
+
+// pdfHeadingSizes are font sizes for header levels 1 to 6
+var pdfHeadingSizes = [...]float64{24, 20, 16, 14, 12, 11}
+
+const (
+	fontRegular = iota
+	fontBold
+	fontItalic
+	fontBoldItalic
+)
+
+var pdfFontNames = [...]string{"Helvetica", "Helvetica-Bold", "Helvetica-Oblique", "Helvetica-BoldOblique"}
+
+// Glyph widths in 1/1000 em for ASCII 32-126, from the Adobe font metrics.
+// The oblique faces share the widths of their upright ones.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+var helveticaBoldWidths = [...]int{
+	278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+	975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+	333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+	611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+}
+
+// winAnsiPunctuation maps the characters WinAnsi places in 0x80-0x9F
+var winAnsiPunctuation = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'ˆ': 0x88, '‰': 0x89, 'Š': 0x8A, '‹': 0x8B, 'Œ': 0x8C, 'Ž': 0x8E, '‘': 0x91,
+	'’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98,
+	'™': 0x99, 'š': 0x9A, '›': 0x9B, 'œ': 0x9C, 'ž': 0x9E, 'Ÿ': 0x9F,
+}
+
+func winAnsi(text string) []byte {
+	encoded := make([]byte, 0, len(text))
+	for _, r := range text {
+		switch {
+		case r == '\t':
+			encoded = append(encoded, ' ')
+		case r >= 0x20 && r < 0x7F, r >= 0xA0 && r <= 0xFF:
+			encoded = append(encoded, byte(r))
+		case winAnsiPunctuation[r] != 0:
+			encoded = append(encoded, winAnsiPunctuation[r])
+		case r < 0x20:
+			// control characters have no glyph
+		default:
+			encoded = append(encoded, '?')
+		}
+	}
+	return encoded
+}
+
+func glyphWidth(font int, c byte, size float64) float64 {
+	width := 556
+	if c >= 32 && c <= 126 {
+		if font == fontBold || font == fontBoldItalic {
+			width = helveticaBoldWidths[c-32]
+		} else {
+			width = helveticaWidths[c-32]
+		}
+	}
+	return float64(width) * size / 1000
+}
+
+// pdfFragment is a piece of a line in one font
+type pdfFragment struct {
+	text []byte
+	font int
+	link bool
+}
+
+func fragmentWidth(fragment pdfFragment, size float64) float64 {
+	width := 0.0
+	for _, c := range fragment.text {
+		width += glyphWidth(fragment.font, c, size)
+	}
+	return width
+}
+
+// pdfLayout places lines of text on pages and collects each page's content stream
+type pdfLayout struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (l *pdfLayout) newPage() {
+	l.pages = append(l.pages, &bytes.Buffer{})
+	l.y = pdfPageHeight - pdfMargin
+}
+
+// line advances to the next baseline, starting a page when the current one is full
+func (l *pdfLayout) line(height float64) *bytes.Buffer {
+	if l.y-height < pdfMargin {
+		l.newPage()
+	}
+	l.y -= height
+	return l.pages[len(l.pages)-1]
+}
+
+func (l *pdfLayout) write(x, size float64, fragments []pdfFragment) {
+	page := l.line(size * pdfLeading)
+	fmt.Fprintf(page, "BT %.2f %.2f Td\n", x, l.y)
+	// Words in the same style are drawn with one operator
+	var merged []pdfFragment
+	for _, fragment := range fragments {
+		if last := len(merged) - 1; last >= 0 && merged[last].font == fragment.font && merged[last].link == fragment.link {
+			merged[last].text = append(merged[last].text, fragment.text...)
+			continue
+		}
+		merged = append(merged, pdfFragment{text: append([]byte(nil), fragment.text...), font: fragment.font, link: fragment.link})
+	}
+
+	font, link := -1, false
+	for _, fragment := range merged {
+		if fragment.font != font {
+			fmt.Fprintf(page, "/F%d %.2f Tf\n", fragment.font+1, size)
+			font = fragment.font
+		}
+		if fragment.link != link {
+			if fragment.link {
+				page.WriteString("0 0 0.8 rg\n")
+			} else {
+				page.WriteString("0 g\n")
+			}
+			link = fragment.link
+		}
+		page.WriteString(pdfString(fragment.text) + " Tj\n")
+	}
+	if link {
+		page.WriteString("0 g\n")
+	}
+	page.WriteString("ET\n")
+}
+
+// wrap breaks a paragraph into lines no wider than width, at spaces where possible
+func wrap(fragments []pdfFragment, size, width float64) [][]pdfFragment {
+	// Split into words, each keeping its trailing spaces
+	var words [][]pdfFragment
+	var word []pdfFragment
+	for _, fragment := range fragments {
+		start := 0
+		for i := 0; i < len(fragment.text); i++ {
+			if fragment.text[i] == ' ' && (i+1 == len(fragment.text) || fragment.text[i+1] != ' ') {
+				word = append(word, pdfFragment{text: fragment.text[start : i+1], font: fragment.font, link: fragment.link})
+				words = append(words, word)
+				word, start = nil, i+1
+			}
+		}
+		if start < len(fragment.text) {
+			word = append(word, pdfFragment{text: fragment.text[start:], font: fragment.font, link: fragment.link})
+		}
+	}
+	if word != nil {
+		words = append(words, word)
+	}
+
+	var lines [][]pdfFragment
+	var current []pdfFragment
+	currentWidth := 0.0
+	for _, word := range words {
+		wordWidth := 0.0
+		for _, fragment := range word {
+			wordWidth += fragmentWidth(fragment, size)
+		}
+		if currentWidth+wordWidth > width && current != nil {
+			lines = append(lines, current)
+			current, currentWidth = nil, 0
+		}
+		if wordWidth <= width {
+			current = append(current, word...)
+			currentWidth += wordWidth
+			continue
+		}
+		// The word is wider than a whole line, so break it between characters
+		for _, fragment := range word {
+			for _, c := range fragment.text {
+				w := glyphWidth(fragment.font, c, size)
+				if currentWidth+w > width && current != nil {
+					lines = append(lines, current)
+					current, currentWidth = nil, 0
+				}
+				current = append(current, pdfFragment{text: []byte{c}, font: fragment.font, link: fragment.link})
+				currentWidth += w
+			}
+		}
+	}
+	if current != nil {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+func renderPDF(title string, lines []exportLine) ([]byte, error) {
+	layout := &pdfLayout{}
+	layout.newPage()
+	textWidth := pdfPageWidth - 2*pdfMargin
+	ordered := 0
+
+	for _, line := range lines {
+		size := pdfBodySize
+		level := models.HeaderLevel(line.block)
+		if level > 0 {
+			size = pdfHeadingSizes[level-1]
+		}
+
+		var fragments []pdfFragment
+		for _, run := range line.runs {
+			bold := level > 0 || isTrue(run.Attributes, models.AttributeBold)
+			italic := isTrue(run.Attributes, models.AttributeItalic)
+			font := fontRegular
+			switch {
+			case bold && italic:
+				font = fontBoldItalic
+			case bold:
+				font = fontBold
+			case italic:
+				font = fontItalic
+			}
+			fragments = append(fragments, pdfFragment{text: winAnsi(run.Insert), font: font, link: safeLink(run.Attributes) != ""})
+		}
+
+		x, width := pdfMargin, textWidth
+		list := listType(line.block)
+		if list != "ordered" {
+			ordered = 0
+		}
+		var marker []byte
+		switch list {
+		case "bullet":
+			marker = []byte{0x95} // WinAnsi bullet
+		case "ordered":
+			ordered++
+			marker = []byte(fmt.Sprintf("%d.", ordered))
+		}
+		if marker != nil {
+			x, width = pdfMargin+pdfListIndent, textWidth-pdfListIndent
+		}
+
+		if len(fragments) == 0 {
+			layout.line(size * pdfLeading)
+			continue
+		}
+		for i, wrapped := range wrap(fragments, size, width) {
+			if i == 0 && marker != nil {
+				// Draw the marker in the gutter on the first line's baseline
+				layout.write(x, size, wrapped)
+				page := layout.pages[len(layout.pages)-1]
+				fmt.Fprintf(page, "BT /F1 %.2f Tf %.2f %.2f Td %s Tj ET\n", size, pdfMargin+4, layout.y, pdfString(marker))
+				continue
+			}
+			layout.write(x, size, wrapped)
+		}
+		// Space between paragraphs, but not between items of a list
+		if list == "" {
+			layout.y -= size * 0.5
+		}
+	}
+
+	return assemblePDF(title, layout.pages)
+}
+
+// assemblePDF writes the catalog, fonts and pages with a cross-reference table
+func assemblePDF(title string, pages []*bytes.Buffer) ([]byte, error) {
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-7 are fixed; each page then takes a page and a content object
+	firstPage := 8
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", firstPage+2*i)
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	fonts := make([]string, len(pdfFontNames))
+	for i, name := range pdfFontNames {
+		object(fmt.Sprintf("<< /Type /Font /Subtype /Type1 /BaseFont /%s /Encoding /WinAnsiEncoding >>", name))
+		fonts[i] = fmt.Sprintf("/F%d %d 0 R", i+1, i+3)
+	}
+	object(fmt.Sprintf("<< /Title %s /Producer (Draftly) >>", pdfString(winAnsi(title))))
+
+	for i, page := range pages {
+		var compressed bytes.Buffer
+		w := zlib.NewWriter(&compressed)
+		if _, err := w.Write(page.Bytes()); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.2f %.2f] /Resources << /Font << %s >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, strings.Join(fonts, " "), firstPage+2*i+1))
+		object(fmt.Sprintf("<< /Length %d /Filter /FlateDecode >>\nstream\n%s\nendstream", compressed.Len(), compressed.Bytes()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R /Info 7 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes(), nil
+}
+
+// pdfString writes text as a PDF literal string
+func pdfString(text []byte) string {
+	var b strings.Builder
+	b.WriteByte('(')
+	for _, c := range text {
+		if c == '(' || c == ')' || c == '\\' {
+			b.WriteByte('\\')
+		}
+		b.WriteByte(c)
+	}
+	b.WriteByte(')')
+	return b.String()
+}
@@ -0,0 +1,476 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+const defaultImportMaxBytes = 10 << 20
+
+var (
+	ErrUnsupportedImport  = errors.New("unsupported import format")
+	ErrUnsupportedCharset = errors.New("unsupported character encoding")
+)
+
+// ImportFormats lists the formats ImportDocument understands
+var ImportFormats = []string{"docx", "html", "md", "txt"}
+
+var importExtensions = map[string]string{
+	".md":       "md",
+	".markdown": "md",
+	".html":     "html",
+	".htm":      "html",
+	".docx":     "docx",
+	".txt":      "txt",
+	".text":     "txt",
+}
+
+var importMediaTypes = map[string]string{
+	"text/markdown":   "md",
+	"text/x-markdown": "md",
+	"text/html":       "html",
+	"text/plain":      "txt",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": "docx",
+}
+
+// ImportMaxBytes is the largest file accepted for import, from IMPORT_MAX_BYTES
+func ImportMaxBytes() int64 {
+	if raw := os.Getenv("IMPORT_MAX_BYTES"); raw != "" {
+		limit, err := strconv.ParseInt(raw, 10, 64)
+		if err == nil && limit > 0 {
+			return limit
+		}
+		fmt.Printf("WARNING: invalid IMPORT_MAX_BYTES %q, using %d\n", raw, defaultImportMaxBytes)
+	}
+	return defaultImportMaxBytes
+}
+
+// ImportFormatFor picks the import format from a file name, falling back to its media type
+func ImportFormatFor(fileName, mediaType string) (string, bool) {
+	if format, ok := importExtensions[strings.ToLower(path.Ext(fileName))]; ok {
+		return format, true
+	}
+	format, ok := importMediaTypes[strings.ToLower(mediaType)]
+	return format, ok
+}
+
+// ImportTitle derives a document title from an uploaded file name
+func ImportTitle(fileName string) string {
+	// Browsers may send a full Windows path
+	fileName = fileName[strings.LastIndexAny(fileName, `/\`)+1:]
+	title := strings.TrimSpace(strings.TrimSuffix(fileName, path.Ext(fileName)))
+	if title == "" {
+		return "Imported document"
+	}
+	return TruncateTitle(title)
+}
+
+// ImportDocument converts a file into the document model. charset may be empty,
+// in which case text formats are detected from byte order marks, HTML meta
+// tags and UTF-8 validity.
+func ImportDocument(data []byte, format, charset string) (models.Delta, error) {
+	if format == "docx" {
+		return importDOCX(data)
+	}
+
+	if charset == "" && format == "html" {
+		charset = htmlMetaCharset(data)
+	}
+	text, err := DecodeText(data, charset)
+	if err != nil {
+		return models.Delta{}, err
+	}
+	text = strings.NewReplacer("\r\n", "\n", "\r", "\n", "\x00", "").Replace(text)
+
+	switch format {
+	case "txt":
+		return DeltaFromText(text), nil
+	case "md":
+		return importMarkdown(text), nil
+	case "html":
+		return importHTML(text)
+	}
+	return models.Delta{}, ErrUnsupportedImport
+}
+
+// DecodeText converts text in the given charset to UTF-8. Without a charset it
+// looks for a byte order mark or UTF-16, then accepts valid UTF-8, and
+// otherwise assumes Windows-1252, the usual encoding of legacy text files.
+func DecodeText(data []byte, charset string) (string, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0xEF, 0xBB, 0xBF}):
+		return string(data[3:]), nil
+	case bytes.HasPrefix(data, []byte{0xFF, 0xFE}):
+		return decodeUTF16(data[2:], false), nil
+	case bytes.HasPrefix(data, []byte{0xFE, 0xFF}):
+		return decodeUTF16(data[2:], true), nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(charset)) {
+	case "":
+		// UTF-16 goes first: its zero bytes are valid UTF-8
+		if bigEndian, ok := looksLikeUTF16(data); ok {
+			return decodeUTF16(data, bigEndian), nil
+		}
+		if utf8.Valid(data) {
+			return string(data), nil
+		}
+		return decodeWindows1252(data), nil
+	case "utf-8", "utf8", "us-ascii", "ascii":
+		if !utf8.Valid(data) {
+			return "", fmt.Errorf("file is not valid UTF-8")
+		}
+		return string(data), nil
+	case "utf-16le":
+		return decodeUTF16(data, false), nil
+	case "utf-16be", "utf-16":
+		return decodeUTF16(data, true), nil
+	case "iso-8859-1", "latin1", "latin-1", "windows-1252", "cp1252":
+		return decodeWindows1252(data), nil
+	}
+	return "", ErrUnsupportedCharset
+}
+
+func decodeUTF16(data []byte, bigEndian bool) string {
+	units := make([]uint16, len(data)/2)
+	for i := range units {
+		if bigEndian {
+			units[i] = uint16(data[2*i])<<8 | uint16(data[2*i+1])
+		} else {
+			units[i] = uint16(data[2*i+1])<<8 | uint16(data[2*i])
+		}
+	}
+	return string(utf16.Decode(units))
+}
+
+// looksLikeUTF16 spots UTF-16 without a byte order mark by the zero high bytes
+// of ASCII characters
+func looksLikeUTF16(data []byte) (bigEndian bool, ok bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return false, false
+	}
+	sample := data
+	if len(sample) > 512 {
+		sample = sample[:512]
+	}
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case evenZeros*2 > pairs && oddZeros == 0:
+		return true, true
+	case oddZeros*2 > pairs && evenZeros == 0:
+		return false, true
+	}
+	return false, false
+}
+
+func decodeWindows1252(data []byte) string {
+	punctuation := make(map[byte]rune, len(winAnsiPunctuation))
+	for r, c := range winAnsiPunctuation {
+		punctuation[c] = r
+	}
+	runes := make([]rune, len(data))
+	for i, c := range data {
+		if r, ok := punctuation[c]; ok {
+			runes[i] = r
+		} else {
+			runes[i] = rune(c)
+		}
+	}
+	return string(runes)
+}
+
+var htmlMetaCharsetPattern = regexp.MustCompile(`(?i)<meta[^>]+charset\s*=\s*["']?\s*([a-z0-9_-]+)`)
+
+func htmlMetaCharset(data []byte) string {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	if match := htmlMetaCharsetPattern.FindSubmatch(head); match != nil {
+		return string(match[1])
+	}
+	return ""
+}
+
+// deltaBuilder assembles a delta line by line while importing
+type deltaBuilder struct {
+	chars     []richChar
+	lineStart int
+}
+
+func (b *deltaBuilder) text(text string, attributes models.Attributes) {
+	attributes = composeAttributes(nil, attributes)
+	for _, r := range text {
+		b.chars = append(b.chars, richChar{r: r, attributes: attributes})
+	}
+}
+
+func (b *deltaBuilder) lineEmpty() bool {
+	return len(b.chars) == b.lineStart
+}
+
+// endLine finishes the current line, putting block attributes on its newline
+func (b *deltaBuilder) endLine(block models.Attributes) {
+	b.chars = append(b.chars, richChar{r: '\n', attributes: composeAttributes(nil, block)})
+	b.lineStart = len(b.chars)
+}
+
+func (b *deltaBuilder) delta() models.Delta {
+	return implode(b.chars)
+}
+
+var (
+	markdownHeading = regexp.MustCompile(`^(#{1,6})\s+(.*?)(\s+#+)?$`)
+	markdownBullet  = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	markdownOrdered = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+	markdownLink    = regexp.MustCompile(`^\[([^\]]*)\]\(\s*<?([^)\s>]*)>?(?:\s+"[^"]*")?\s*\)`)
+)
+
+// importMarkdown reads the Markdown subset the editor can represent: headings,
+// lists, paragraphs, emphasis and links. Other syntax is kept as text.
+func importMarkdown(text string) models.Delta {
+	var b deltaBuilder
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			markdownInline(&b, strings.Join(paragraph, " "), nil)
+			b.endLine(nil)
+			paragraph = nil
+		}
+	}
+
+	for _, line := range strings.Split(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" {
+			flush()
+			continue
+		}
+		if match := markdownHeading.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			markdownInline(&b, match[2], nil)
+			b.endLine(models.Attributes{models.AttributeHeader: len(match[1])})
+		} else if match := markdownBullet.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			markdownInline(&b, match[1], nil)
+			b.endLine(models.Attributes{models.AttributeList: "bullet"})
+		} else if match := markdownOrdered.FindStringSubmatch(trimmed); match != nil {
+			flush()
+			markdownInline(&b, match[1], nil)
+			b.endLine(models.Attributes{models.AttributeList: "ordered"})
+		} else {
+			paragraph = append(paragraph, trimmed)
+		}
+	}
+	flush()
+	return b.delta()
+}
+
+// markdownInline adds one line of Markdown, applying emphasis and links
+func markdownInline(b *deltaBuilder, text string, base models.Attributes) {
+	bold, italic := false, false
+	current := func() models.Attributes {
+		attributes := composeAttributes(nil, base)
+		if attributes == nil {
+			attributes = models.Attributes{}
+		}
+		if bold {
+			attributes[models.AttributeBold] = true
+		}
+		if italic {
+			attributes[models.AttributeItalic] = true
+		}
+		return attributes
+	}
+
+	runes := []rune(text)
+	wordChar := func(i int) bool {
+		return i >= 0 && i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]))
+	}
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case r == '\\' && i+1 < len(runes) && (unicode.IsPunct(runes[i+1]) || unicode.IsSymbol(runes[i+1])):
+			i++
+			b.text(string(runes[i]), current())
+		case r == '`':
+			end := i + 1
+			for end < len(runes) && runes[end] != '`' {
+				end++
+			}
+			if end == len(runes) {
+				b.text("`", current())
+				continue
+			}
+			b.text(string(runes[i+1:end]), current())
+			i = end
+		case r == '[':
+			match := markdownLink.FindStringSubmatch(string(runes[i:]))
+			if match == nil || safeLink(models.Attributes{models.AttributeLink: match[2]}) == "" {
+				b.text("[", current())
+				continue
+			}
+			attributes := current()
+			attributes[models.AttributeLink] = match[2]
+			markdownInline(b, match[1], attributes)
+			i += utf8.RuneCountInString(match[0]) - 1
+		case (r == '*' || r == '_') && i+1 < len(runes) && runes[i+1] == r:
+			bold = !bold
+			i++
+		case r == '*' || r == '_':
+			// Underscores inside words are literal, as in snake_case
+			opening := !italic && i+1 < len(runes) && !unicode.IsSpace(runes[i+1])
+			closing := italic && i > 0 && !unicode.IsSpace(runes[i-1])
+			if r == '_' && wordChar(i-1) && wordChar(i+1) {
+				opening, closing = false, false
+			}
+			if opening || closing {
+				italic = !italic
+			} else {
+				b.text(string(r), current())
+			}
+		default:
+			b.text(string(r), current())
+		}
+	}
+}
+
+// htmlBlocks end the current line when they open or close
+var htmlBlocks = map[string]bool{
+	"p": true, "div": true, "li": true, "blockquote": true, "pre": true, "tr": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"section": true, "article": true, "header": true, "footer": true, "table": true,
+}
+
+var htmlWhitespace = regexp.MustCompile(`\s+`)
+
+// importHTML reads headings, paragraphs, lists, emphasis and links from HTML.
+// The standard library's XML decoder in non-strict mode copes with most HTML.
+func importHTML(text string) (models.Delta, error) {
+	decoder := xml.NewDecoder(strings.NewReader(text))
+	decoder.Strict = false
+	decoder.AutoClose = xml.HTMLAutoClose
+	decoder.Entity = xml.HTMLEntity
+
+	var b deltaBuilder
+	var lists, links []string
+	var block models.Attributes
+	bold, italic, skip := 0, 0, 0
+
+	endBlock := func() {
+		if !b.lineEmpty() || block != nil {
+			// Trailing whitespace is not significant in HTML
+			for !b.lineEmpty() && b.chars[len(b.chars)-1].r == ' ' {
+				b.chars = b.chars[:len(b.chars)-1]
+			}
+			b.endLine(block)
+		}
+		block = nil
+	}
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return models.Delta{}, fmt.Errorf("invalid HTML: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			name := strings.ToLower(t.Name.Local)
+			switch {
+			case name == "script" || name == "style" || name == "head" || name == "title":
+				skip++
+			case name == "b" || name == "strong":
+				bold++
+			case name == "i" || name == "em":
+				italic++
+			case name == "a":
+				href := ""
+				for _, attr := range t.Attr {
+					if strings.ToLower(attr.Name.Local) == "href" {
+						href = safeLink(models.Attributes{models.AttributeLink: strings.TrimSpace(attr.Value)})
+					}
+				}
+				links = append(links, href)
+			case name == "br":
+				endBlock()
+			case name == "ul" || name == "ol":
+				endBlock()
+				lists = append(lists, map[string]string{"ul": "bullet", "ol": "ordered"}[name])
+			case htmlBlocks[name]:
+				endBlock()
+				if level := strings.TrimPrefix(name, "h"); len(name) == 2 && level >= "1" && level <= "6" {
+					block = models.Attributes{models.AttributeHeader: int(level[0] - '0')}
+				} else if name == "li" && len(lists) > 0 {
+					block = models.Attributes{models.AttributeList: lists[len(lists)-1]}
+				}
+			}
+		case xml.EndElement:
+			name := strings.ToLower(t.Name.Local)
+			switch {
+			case name == "script" || name == "style" || name == "head" || name == "title":
+				skip--
+			case name == "b" || name == "strong":
+				bold--
+			case name == "i" || name == "em":
+				italic--
+			case name == "a" && len(links) > 0:
+				links = links[:len(links)-1]
+			case name == "ul" || name == "ol":
+				endBlock()
+				if len(lists) > 0 {
+					lists = lists[:len(lists)-1]
+				}
+			case htmlBlocks[name]:
+				endBlock()
+			}
+		case xml.CharData:
+			if skip > 0 {
+				continue
+			}
+			content := htmlWhitespace.ReplaceAllString(string(t), " ")
+			if b.lineEmpty() || b.chars[len(b.chars)-1].r == ' ' {
+				content = strings.TrimLeft(content, " ")
+			}
+			if content == "" {
+				continue
+			}
+			attributes := models.Attributes{}
+			if bold > 0 {
+				attributes[models.AttributeBold] = true
+			}
+			if italic > 0 {
+				attributes[models.AttributeItalic] = true
+			}
+			if len(links) > 0 && links[len(links)-1] != "" {
+				attributes[models.AttributeLink] = links[len(links)-1]
+			}
+			b.text(content, attributes)
+		}
+	}
+	endBlock()
+	return b.delta(), nil
+}
@@ -0,0 +1,243 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// maxDOCXPartBytes bounds how much a single part may inflate to, so a small
+// upload cannot expand into an arbitrarily large document
+const maxDOCXPartBytes = 64 << 20
+
+var docxHeadingStyle = regexp.MustCompile(`^(?i)heading ?([1-6])$`)
+
+// importDOCX reads paragraphs, headings, lists, bold, italic and hyperlinks
+// from the main document part of a DOCX file
+func importDOCX(data []byte) (models.Delta, error) {
+	archive, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return models.Delta{}, fmt.Errorf("invalid DOCX: %w", err)
+	}
+
+	document, err := readDOCXPart(archive, "word/document.xml")
+	if err != nil {
+		return models.Delta{}, err
+	}
+	if document == nil {
+		return models.Delta{}, fmt.Errorf("invalid DOCX: word/document.xml is missing")
+	}
+	links, err := docxHyperlinks(archive)
+	if err != nil {
+		return models.Delta{}, err
+	}
+	lists, err := docxListTypes(archive)
+	if err != nil {
+		return models.Delta{}, err
+	}
+
+	var b deltaBuilder
+	var block models.Attributes
+	var link string
+	inRun, inText := false, false
+	bold, italic := false, false
+
+	decoder := xml.NewDecoder(bytes.NewReader(document))
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return models.Delta{}, fmt.Errorf("invalid DOCX: %w", err)
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "p":
+				block = nil
+			case "pStyle":
+				style := docxAttr(t, "val")
+				if match := docxHeadingStyle.FindStringSubmatch(style); match != nil {
+					block = models.Attributes{models.AttributeHeader: int(match[1][0] - '0')}
+				} else if style == "Title" {
+					block = models.Attributes{models.AttributeHeader: 1}
+				}
+			case "numId":
+				if list, ok := lists[docxAttr(t, "val")]; ok {
+					block = models.Attributes{models.AttributeList: list}
+				}
+			case "hyperlink":
+				link = safeLink(models.Attributes{models.AttributeLink: links[docxAttr(t, "id")]})
+			case "r":
+				inRun, bold, italic = true, false, false
+			case "b":
+				bold = inRun && docxToggle(t)
+			case "i":
+				italic = inRun && docxToggle(t)
+			case "t":
+				inText = inRun
+			case "tab":
+				if inRun {
+					b.text("\t", docxRunAttributes(bold, italic, link))
+				}
+			case "br", "cr":
+				if inRun {
+					b.endLine(nil)
+				}
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "p":
+				b.endLine(block)
+				block = nil
+			case "hyperlink":
+				link = ""
+			case "r":
+				inRun = false
+			case "t":
+				inText = false
+			}
+		case xml.CharData:
+			if inText {
+				b.text(string(t), docxRunAttributes(bold, italic, link))
+			}
+		}
+	}
+	return b.delta(), nil
+}
+
+func readDOCXPart(archive *zip.Reader, name string) ([]byte, error) {
+	for _, file := range archive.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOCX: %w", err)
+		}
+		defer rc.Close()
+		data, err := io.ReadAll(io.LimitReader(rc, maxDOCXPartBytes+1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid DOCX: %w", err)
+		}
+		if len(data) > maxDOCXPartBytes {
+			return nil, fmt.Errorf("invalid DOCX: %s is too large", name)
+		}
+		return data, nil
+	}
+	return nil, nil
+}
+
+// docxHyperlinks maps relationship IDs to external link targets
+func docxHyperlinks(archive *zip.Reader) (map[string]string, error) {
+	links := map[string]string{}
+	data, err := readDOCXPart(archive, "word/_rels/document.xml.rels")
+	if err != nil || data == nil {
+		return links, err
+	}
+	var rels struct {
+		Relationships []struct {
+			ID         string `xml:"Id,attr"`
+			Type       string `xml:"Type,attr"`
+			Target     string `xml:"Target,attr"`
+			TargetMode string `xml:"TargetMode,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := xml.Unmarshal(data, &rels); err != nil {
+		return nil, fmt.Errorf("invalid DOCX relationships: %w", err)
+	}
+	for _, rel := range rels.Relationships {
+		if strings.HasSuffix(rel.Type, "/hyperlink") && rel.TargetMode == "External" {
+			links[rel.ID] = rel.Target
+		}
+	}
+	return links, nil
+}
+
+// docxListTypes maps numbering IDs to "bullet" or "ordered" using the format of
+// their first level
+func docxListTypes(archive *zip.Reader) (map[string]string, error) {
+	lists := map[string]string{}
+	data, err := readDOCXPart(archive, "word/numbering.xml")
+	if err != nil || data == nil {
+		return lists, err
+	}
+	type value struct {
+		Val string `xml:"val,attr"`
+	}
+	var numbering struct {
+		AbstractNums []struct {
+			ID     string `xml:"abstractNumId,attr"`
+			Levels []struct {
+				Level  string `xml:"ilvl,attr"`
+				Format value  `xml:"numFmt"`
+			} `xml:"lvl"`
+		} `xml:"abstractNum"`
+		Nums []struct {
+			ID       string `xml:"numId,attr"`
+			Abstract value  `xml:"abstractNumId"`
+		} `xml:"num"`
+	}
+	if err := xml.Unmarshal(data, &numbering); err != nil {
+		return nil, fmt.Errorf("invalid DOCX numbering: %w", err)
+	}
+
+	formats := map[string]string{}
+	for _, abstract := range numbering.AbstractNums {
+		for _, level := range abstract.Levels {
+			if level.Level == "0" {
+				formats[abstract.ID] = level.Format.Val
+			}
+		}
+	}
+	for _, num := range numbering.Nums {
+		switch formats[num.Abstract.Val] {
+		case "bullet":
+			lists[num.ID] = "bullet"
+		case "none", "":
+			// numId 0 and unnumbered styles are not lists
+		default:
+			lists[num.ID] = "ordered"
+		}
+	}
+	return lists, nil
+}
+
+func docxAttr(element xml.StartElement, name string) string {
+	for _, attr := range element.Attr {
+		if attr.Name.Local == name {
+			return attr.Value
+		}
+	}
+	return ""
+}
+
+// docxToggle reads on/off properties such as <w:b/> and <w:b w:val="0"/>
+func docxToggle(element xml.StartElement) bool {
+	switch docxAttr(element, "val") {
+	case "0", "false", "off":
+		return false
+	}
+	return true
+}
+
+func docxRunAttributes(bold, italic bool, link string) models.Attributes {
+	attributes := models.Attributes{}
+	if bold {
+		attributes[models.AttributeBold] = true
+	}
+	if italic {
+		attributes[models.AttributeItalic] = true
+	}
+	if link != "" {
+		attributes[models.AttributeLink] = link
+	}
+	return attributes
+}
@@ -1,10 +1,12 @@
 package services
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"log"
 	"os"
+	"time"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -12,9 +14,13 @@ import (
 
 // DatabaseService handles PostgreSQL connections and operations
 type DatabaseService struct {
-	db *sql.DB
+	db      *sql.DB
+	timeout time.Duration
 }
 
+// defaultQueryTimeout bounds a single statement when DB_QUERY_TIMEOUT is unset
+const defaultQueryTimeout = 5 * time.Second
+
 // NewDatabaseService creates a new database service instance
 func NewDatabaseService() (*DatabaseService, error) {
 	// Load .env file
@@ -61,15 +67,23 @@ func NewDatabaseService() (*DatabaseService, error) {
 		return nil, fmt.Errorf("failed to open database connection: %w", err)
 	}
 
+	timeout, err := durationFromEnv("DB_QUERY_TIMEOUT", defaultQueryTimeout)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
 	// Test the connection
-	if err := db.Ping(); err != nil {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := db.PingContext(ctx); err != nil {
 		db.Close()
 		return nil, fmt.Errorf("failed to ping database: %w", err)
 	}
 
 	log.Println("Successfully connected to PostgreSQL database")
 
-	return &DatabaseService{db: db}, nil
+	return &DatabaseService{db: db, timeout: timeout}, nil
 }
 
 // Close closes connection
@@ -80,9 +94,33 @@ func (ds *DatabaseService) Close() error {
 	return nil
 }
 
+// DB returns the connection pool, for code that scans rows into its own types
+func (ds *DatabaseService) DB() *sql.DB {
+	return ds.db
+}
+
+// Timeout is the per-statement timeout from DB_QUERY_TIMEOUT
+func (ds *DatabaseService) Timeout() time.Duration {
+	return ds.timeout
+}
+
+// WithTimeout derives a context bounded by the per-statement timeout. It is
+// used for transactions, whose statements run on the returned context.
+func (ds *DatabaseService) WithTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(ctx, ds.timeout)
+}
+
 // ExecuteQuery executes a SELECT query and returns results as a slice of maps
 func (ds *DatabaseService) ExecuteQuery(query string, args ...interface{}) ([]map[string]interface{}, error) {
-	rows, err := ds.db.Query(query, args...)
+	return ds.ExecuteQueryContext(context.Background(), query, args...)
+}
+
+// ExecuteQueryContext is ExecuteQuery bounded by ctx and the query timeout
+func (ds *DatabaseService) ExecuteQueryContext(ctx context.Context, query string, args ...interface{}) ([]map[string]interface{}, error) {
+	ctx, cancel := ds.WithTimeout(ctx)
+	defer cancel()
+
+	rows, err := ds.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to execute query: %w", err)
 	}
@@ -134,7 +172,15 @@ func (ds *DatabaseService) ExecuteQuery(query string, args ...interface{}) ([]ma
 
 // ExecuteNonQuery executes INSERT, UPDATE, DELETE queries
 func (ds *DatabaseService) ExecuteNonQuery(query string, args ...interface{}) (int64, error) {
-	result, err := ds.db.Exec(query, args...)
+	return ds.ExecuteNonQueryContext(context.Background(), query, args...)
+}
+
+// ExecuteNonQueryContext is ExecuteNonQuery bounded by ctx and the query timeout
+func (ds *DatabaseService) ExecuteNonQueryContext(ctx context.Context, query string, args ...interface{}) (int64, error) {
+	ctx, cancel := ds.WithTimeout(ctx)
+	defer cancel()
+
+	result, err := ds.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return 0, fmt.Errorf("failed to execute non-query: %w", err)
 	}
@@ -149,7 +195,15 @@ func (ds *DatabaseService) ExecuteNonQuery(query string, args ...interface{}) (i
 
 // ExecuteQueryRow executes a query that returns a single row
 func (ds *DatabaseService) ExecuteQueryRow(query string, dest []interface{}, args ...interface{}) error {
-	row := ds.db.QueryRow(query, args...)
+	return ds.ExecuteQueryRowContext(context.Background(), query, dest, args...)
+}
+
+// ExecuteQueryRowContext is ExecuteQueryRow bounded by ctx and the query timeout
+func (ds *DatabaseService) ExecuteQueryRowContext(ctx context.Context, query string, dest []interface{}, args ...interface{}) error {
+	ctx, cancel := ds.WithTimeout(ctx)
+	defer cancel()
+
+	row := ds.db.QueryRowContext(ctx, query, args...)
 	if err := row.Scan(dest...); err != nil {
 		return fmt.Errorf("failed to scan row: %w", err)
 	}
@@ -158,9 +212,39 @@ func (ds *DatabaseService) ExecuteQueryRow(query string, dest []interface{}, arg
 
 // BeginTransaction starts a new transaction
 func (ds *DatabaseService) BeginTransaction() (*sql.Tx, error) {
-	tx, err := ds.db.Begin()
+	return ds.BeginTransactionContext(context.Background())
+}
+
+// BeginTransactionContext starts a transaction that is rolled back if ctx is
+// done before it commits. Callers bound ctx with WithTimeout.
+func (ds *DatabaseService) BeginTransactionContext(ctx context.Context) (*sql.Tx, error) {
+	tx, err := ds.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to begin transaction: %w", err)
 	}
 	return tx, nil
 }
+
+// durationSetting reads a duration from the environment, warning and using
+// fallback when it is invalid
+func durationSetting(name string, fallback time.Duration) time.Duration {
+	duration, err := durationFromEnv(name, fallback)
+	if err != nil {
+		fmt.Printf("WARNING: %v, using %s\n", err, fallback)
+		return fallback
+	}
+	return duration
+}
+
+// durationFromEnv reads a Go duration such as "5s" from an environment variable
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: want a positive duration such as 5s", name, value)
+	}
+	return duration, nil
+}
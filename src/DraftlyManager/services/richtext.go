@@ -0,0 +1,138 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"reflect"
+)
+
+// richChar is one character with its formatting. Characters from the same run
+// share an Attributes map, which is never modified in place.
+type richChar struct {
+	r          rune
+	attributes models.Attributes
+}
+
+// DeltaFromText wraps plain text in an unformatted delta
+func DeltaFromText(text string) models.Delta {
+	if text == "" {
+		return models.Delta{Ops: []models.Run{}}
+	}
+	return models.Delta{Ops: []models.Run{{Insert: text}}}
+}
+
+// PlainText returns the text of a delta without its formatting
+func PlainText(delta models.Delta) string {
+	var text []rune
+	for _, run := range delta.Ops {
+		text = append(text, []rune(run.Insert)...)
+	}
+	return string(text)
+}
+
+// ApplyRichOperations replays operations on top of a rich-text snapshot.
+// Operations that are out of range are ignored, as are those with invalid
+// attributes.
+func ApplyRichOperations(snapshot models.Delta, operations []models.Operation) models.Delta {
+	chars := explode(snapshot)
+	for _, operation := range operations {
+		chars = applyRichOperation(chars, operation)
+	}
+	return implode(chars)
+}
+
+func applyRichOperation(chars []richChar, operation models.Operation) []richChar {
+	if models.ValidateAttributes(operation.Attributes) != nil {
+		return chars
+	}
+
+	switch operation.Type {
+	case "insert":
+		if operation.Position >= 0 && operation.Position <= len(chars) {
+			attributes := composeAttributes(nil, operation.Attributes)
+			inserted := make([]richChar, 0, len(operation.Text))
+			for _, r := range operation.Text {
+				inserted = append(inserted, richChar{r: r, attributes: attributes})
+			}
+			return append(chars[:operation.Position], append(inserted, chars[operation.Position:]...)...)
+		}
+	case "delete":
+		start := operation.Position
+		end := start + operation.Length
+		if start >= 0 && start <= len(chars) && end <= len(chars) {
+			return append(chars[:start], chars[end:]...)
+		}
+	case "format":
+		start := operation.Position
+		end := start + operation.Length
+		if start >= 0 && start <= end && end <= len(chars) {
+			// Neighbouring characters usually have the same formatting, so reuse
+			// the last composition
+			var lastBase, lastComposed models.Attributes
+			for i := start; i < end; i++ {
+				if i == start || !sameAttributes(chars[i].attributes, lastBase) {
+					lastBase = chars[i].attributes
+					lastComposed = composeAttributes(lastBase, operation.Attributes)
+				}
+				chars[i].attributes = lastComposed
+			}
+		}
+	}
+	return chars
+}
+
+// composeAttributes applies change on top of base. Null values remove an
+// attribute. The result is a new map, or nil if no attributes remain.
+func composeAttributes(base, change models.Attributes) models.Attributes {
+	composed := make(models.Attributes, len(base)+len(change))
+	for name, value := range base {
+		composed[name] = value
+	}
+	for name, value := range change {
+		if value == nil {
+			delete(composed, name)
+		} else {
+			composed[name] = value
+		}
+	}
+	if len(composed) == 0 {
+		return nil
+	}
+	return composed
+}
+
+func explode(delta models.Delta) []richChar {
+	var chars []richChar
+	for _, run := range delta.Ops {
+		for _, r := range run.Insert {
+			chars = append(chars, richChar{r: r, attributes: run.Attributes})
+		}
+	}
+	return chars
+}
+
+// implode merges neighbouring characters with the same formatting into runs
+func implode(chars []richChar) models.Delta {
+	delta := models.Delta{Ops: []models.Run{}}
+	var text []rune
+	for i, c := range chars {
+		text = append(text, c.r)
+		if i == len(chars)-1 || !sameAttributes(c.attributes, chars[i+1].attributes) {
+			delta.Ops = append(delta.Ops, models.Run{Insert: string(text), Attributes: c.attributes})
+			text = nil
+		}
+	}
+	return delta
+}
+
+func sameAttributes(a, b models.Attributes) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for name, value := range a {
+		other, ok := b[name]
+		if !ok || !reflect.DeepEqual(other, value) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,137 +2,160 @@ package services
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"os"
-	"strings"
-
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"time"
 )
 
-// S3Service handles document storage and retrieval from S3
+// ErrSnapshotCorrupt is returned when downloaded content does not match the
+// SHA-256 recorded for it
+var ErrSnapshotCorrupt = errors.New("snapshot checksum mismatch")
+
+// S3Service handles document storage and retrieval. Content lives in a
+// BlobStore, which is S3 in production and the local disk or memory otherwise.
+//
+// Snapshots are gzip-compressed and stored under the SHA-256 of their
+// uncompressed content, so identical content is stored once and shared
+// between documents.
 type S3Service struct {
-	client *s3.Client
-	bucket string
+	store   BlobStore
+	timeout time.Duration
 }
 
-// NewS3Service creates a new S3 service instance
-func NewS3Service() (*S3Service, error) {
-	bucket := os.Getenv("S3_BUCKET_NAME")
-	if bucket == "" {
-		return nil, fmt.Errorf("S3_BUCKET_NAME environment variable is required")
-	}
+// defaultBlobTimeout bounds a single storage call when BLOB_TIMEOUT is unset
+const defaultBlobTimeout = 30 * time.Second
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(os.Getenv("AWS_REGION")),
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to load AWS config: %w", err)
-	}
+// Snapshot identifies stored content: its key and the hex SHA-256 of the
+// uncompressed bytes, which is recorded on the document row
+type Snapshot struct {
+	Key    string
+	SHA256 string
+}
+
+// NewS3Service creates a new document storage service on top of a blob store.
+// Each call to the store is bounded by timeout.
+func NewS3Service(store BlobStore, timeout time.Duration) *S3Service {
+	return &S3Service{store: store, timeout: timeout}
+}
 
-	client := s3.NewFromConfig(cfg)
+// BlobTimeout is the per-call storage timeout, from BLOB_TIMEOUT
+func BlobTimeout() time.Duration {
+	return durationSetting("BLOB_TIMEOUT", defaultBlobTimeout)
+}
 
-	return &S3Service{
-		client: client,
-		bucket: bucket,
-	}, nil
+// Timeout is the bound on a single storage call
+func (s *S3Service) Timeout() time.Duration {
+	return s.timeout
 }
 
-// UploadDocument uploads document content to S3
-func (s *S3Service) UploadDocument(documentID int, content []byte) (string, error) {
-	key := s.generateKey(documentID)
+// DocumentSnapshot returns where a plain text snapshot of a document is stored
+func (s *S3Service) DocumentSnapshot(content []byte) Snapshot {
+	return s.snapshotFor(content, "txt")
+}
 
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(content),
-		ContentType: aws.String("text/plain"),
-	})
+// DeltaSnapshot returns where a rich-text snapshot (a JSON delta), kept
+// alongside a document's plain text, is stored
+func (s *S3Service) DeltaSnapshot(delta []byte) Snapshot {
+	return s.snapshotFor(delta, "json")
+}
 
-	if err != nil {
-		return "", fmt.Errorf("failed to upload document to S3: %w", err)
+// UploadSnapshot compresses content and stores it under the snapshot's key.
+// It is written even when an identical object already exists, since that
+// object may be deleted by the time the caller records the key; callers
+// serialize against the delete with a snapshot lock.
+func (s *S3Service) UploadSnapshot(ctx context.Context, snapshot Snapshot, content []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	var compressed bytes.Buffer
+	writer := gzip.NewWriter(&compressed)
+	if _, err := writer.Write(content); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
 	}
 
-	return key, nil
+	if err := s.store.Put(ctx, snapshot.Key, compressed.Bytes(), "application/gzip"); err != nil {
+		return fmt.Errorf("failed to upload snapshot: %w", err)
+	}
+	return nil
 }
 
-// DownloadDocument retrieves document content from S3
-func (s *S3Service) DownloadDocument(key string) ([]byte, error) {
-	result, err := s.client.GetObject(context.TODO(), &s3.GetObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
+// DownloadDocument retrieves and decompresses document content. When sha256Hex
+// is set the content must match it. Objects written before snapshots were
+// compressed are returned as they are.
+func (s *S3Service) DownloadDocument(ctx context.Context, key, sha256Hex string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
+	content, err := s.store.Get(ctx, key)
 	if err != nil {
-		return nil, fmt.Errorf("failed to download document from S3: %w", err)
+		return nil, fmt.Errorf("failed to download document: %w", err)
 	}
-	defer result.Body.Close()
 
-	content, err := io.ReadAll(result.Body)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read document content: %w", err)
+	// Text never starts with the gzip magic number, which is not valid UTF-8
+	if bytes.HasPrefix(content, []byte{0x1f, 0x8b}) {
+		reader, err := gzip.NewReader(bytes.NewReader(content))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+		content, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", key, err)
+		}
+	}
+
+	if sha256Hex != "" && contentHash(content) != sha256Hex {
+		return nil, fmt.Errorf("%w: %s", ErrSnapshotCorrupt, key)
 	}
 
 	return content, nil
 }
 
-// UpdateDocument updates existing document content in S3
-func (s *S3Service) UpdateDocument(key string, content []byte) error {
-	_, err := s.client.PutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket:      aws.String(s.bucket),
-		Key:         aws.String(key),
-		Body:        bytes.NewReader(content),
-		ContentType: aws.String("text/plain"),
-	})
-
-	if err != nil {
-		return fmt.Errorf("failed to update document in S3: %w", err)
-	}
-
-	return nil
+// snapshotFor returns the content-addressed snapshot of content
+func (s *S3Service) snapshotFor(content []byte, extension string) Snapshot {
+	hash := contentHash(content)
+	return Snapshot{Key: s.generateSnapshotKey(hash, extension), SHA256: hash}
 }
 
 // DeleteDocument removes document from S3
-func (s *S3Service) DeleteDocument(key string) error {
-	_, err := s.client.DeleteObject(context.TODO(), &s3.DeleteObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
+func (s *S3Service) DeleteDocument(ctx context.Context, key string) error {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
-	if err != nil {
-		return fmt.Errorf("failed to delete document from S3: %w", err)
+	if err := s.store.Delete(ctx, key); err != nil {
+		return fmt.Errorf("failed to delete document: %w", err)
 	}
 
 	return nil
 }
 
 // DocumentExists checks if a document exists in S3
-func (s *S3Service) DocumentExists(key string) (bool, error) {
-	_, err := s.client.HeadObject(context.TODO(), &s3.HeadObjectInput{
-		Bucket: aws.String(s.bucket),
-		Key:    aws.String(key),
-	})
+func (s *S3Service) DocumentExists(ctx context.Context, key string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
 
+	exists, err := s.store.Exists(ctx, key)
 	if err != nil {
-		if strings.Contains(err.Error(), "NotFound") {
-			return false, nil
-		}
 		return false, fmt.Errorf("failed to check document existence: %w", err)
 	}
 
-	return true, nil
+	return exists, nil
 }
 
-// GetDocumentContent retrieves document content directly
-func (s *S3Service) GetDocumentContent(documentID int) ([]byte, error) {
-	key := s.generateKey(documentID)
-	return s.DownloadDocument(key)
+// generateSnapshotKey creates the content-addressed key for a snapshot,
+// fanned out by the first byte of the hash
+func (s *S3Service) generateSnapshotKey(hash, extension string) string {
+	return fmt.Sprintf("snapshots/%s/%s.%s.gz", hash[:2], hash, extension)
 }
 
-// generateKey creates a consistent S3 key for a document
-func (s *S3Service) generateKey(documentID int) string {
-	return fmt.Sprintf("documents/%d.txt", documentID)
+func contentHash(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
 }
@@ -0,0 +1,27 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+)
+
+const shareLinkTokenLength = 32
+
+// NewShareLinkToken returns a random URL-safe token for a share link
+func NewShareLinkToken() (string, error) {
+	b := make([]byte, shareLinkTokenLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate share link token: %w", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashShareLinkToken returns the value stored in ShareLinks.token_hash. Tokens
+// are looked up by hash so a database leak does not expose working links.
+func HashShareLinkToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,114 @@
+package services
+
+import (
+	"Draftly/CRUD/models"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// Template placeholders are written {{name}} on a single line, optionally with
+// spaces inside the braces. Names start with a letter and may contain letters,
+// digits, "_", "-" and ".".
+var placeholderPattern = regexp.MustCompile(`\{\{[ \t]*([A-Za-z][A-Za-z0-9_.\-]*)[ \t]*\}\}`)
+
+const (
+	maxTemplateValues     = 100
+	maxTemplateValueRunes = 1000
+	maxTitleRunes         = 255
+)
+
+// ErrInvalidTemplateValues is returned by ValidateTemplateValues
+var ErrInvalidTemplateValues = errors.New("invalid template values")
+
+// ValidateTemplateValues checks placeholder values before they are filled in.
+// Values are inserted inline, so they cannot contain line breaks.
+func ValidateTemplateValues(values map[string]string) error {
+	if len(values) > maxTemplateValues {
+		return fmt.Errorf("%w: at most %d values are allowed", ErrInvalidTemplateValues, maxTemplateValues)
+	}
+	for name, value := range values {
+		if !placeholderPattern.MatchString("{{" + name + "}}") {
+			return fmt.Errorf("%w: %q is not a valid placeholder name", ErrInvalidTemplateValues, name)
+		}
+		if utf8.RuneCountInString(value) > maxTemplateValueRunes {
+			return fmt.Errorf("%w: %s must be at most %d characters", ErrInvalidTemplateValues, name, maxTemplateValueRunes)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return fmt.Errorf("%w: %s must not contain line breaks", ErrInvalidTemplateValues, name)
+		}
+	}
+	return nil
+}
+
+// TemplatePlaceholders returns the distinct placeholder names in texts, in the
+// order they first appear
+func TemplatePlaceholders(texts ...string) []string {
+	names := []string{}
+	seen := map[string]bool{}
+	for _, text := range texts {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				names = append(names, match[1])
+			}
+		}
+	}
+	return names
+}
+
+// FillTemplateText replaces the placeholders in text that have a value.
+// Placeholders without one are left as they are.
+func FillTemplateText(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		if value, ok := values[placeholderPattern.FindStringSubmatch(placeholder)[1]]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
+
+// FillTemplate replaces the placeholders in a delta that have a value. Each
+// value takes the formatting of the first character of its placeholder.
+// Placeholders without a value are left as they are.
+func FillTemplate(delta models.Delta, values map[string]string) models.Delta {
+	text := PlainText(delta)
+	chars := explode(delta)
+	filled := make([]richChar, 0, len(chars))
+
+	// Matches are byte offsets into text; chars is indexed by rune
+	position, offset := 0, 0
+	for _, match := range placeholderPattern.FindAllStringSubmatchIndex(text, -1) {
+		start := position + utf8.RuneCountInString(text[offset:match[0]])
+		end := start + utf8.RuneCountInString(text[match[0]:match[1]])
+		filled = append(filled, chars[position:start]...)
+
+		if value, ok := values[text[match[2]:match[3]]]; ok {
+			attributes := chars[start].attributes
+			for _, r := range value {
+				filled = append(filled, richChar{r: r, attributes: attributes})
+			}
+		} else {
+			filled = append(filled, chars[start:end]...)
+		}
+		position, offset = end, match[1]
+	}
+	filled = append(filled, chars[position:]...)
+	return implode(filled)
+}
+
+// CopyTitle derives the title of a duplicated document, keeping it within the
+// length of the title column
+func CopyTitle(title string) string {
+	return TruncateTitle("Copy of " + title)
+}
+
+// TruncateTitle shortens a derived title to fit the title column
+func TruncateTitle(title string) string {
+	if utf8.RuneCountInString(title) > maxTitleRunes {
+		title = string([]rune(title)[:maxTitleRunes])
+	}
+	return title
+}
@@ -0,0 +1,20 @@
+package services
+
+import "time"
+
+const (
+	defaultTrashRetention     = 30 * 24 * time.Hour
+	defaultTrashPurgeInterval = time.Hour
+)
+
+// TrashRetention is how long deleted documents can be restored before they are
+// purged, from TRASH_RETENTION
+func TrashRetention() time.Duration {
+	return durationSetting("TRASH_RETENTION", defaultTrashRetention)
+}
+
+// TrashPurgeInterval is how often expired documents are purged, from
+// TRASH_PURGE_INTERVAL
+func TrashPurgeInterval() time.Duration {
+	return durationSetting("TRASH_PURGE_INTERVAL", defaultTrashPurgeInterval)
+}
@@ -4,6 +4,7 @@ Test suite for Document API endpoints with operations
 """
 
 import requests
+import hashlib
 import json
 import os
 import pytest
@@ -16,6 +17,7 @@ load_dotenv()
 
 BASE_URL = "http://localhost:6060/v1"
 HEADERS = {"Content-Type": "application/json"}
+PASSWORD = "correct-horse-battery"
 
 DB_CONFIG = {
     "host": os.getenv("POSTGRESS_HOST"),
@@ -32,7 +34,7 @@ class TestDocumentEndpoints:
     def setup_method(self):
         self.base_url = BASE_URL
         self.headers = HEADERS
-        self.created_user_ids = []
+        self.created_users = []
         self.created_document_id = None
         self.db_conn = None
         self.operations_dir = "operations"
@@ -44,35 +46,52 @@ class TestDocumentEndpoints:
             self.db_conn = None
         
     def teardown_method(self):
-        if self.created_document_id and self.created_user_ids:
+        # Users cannot be deleted while they still own documents, even in the trash
+        for user in self.created_users:
             try:
-                requests.delete(f"{self.base_url}/documents/{self.created_user_ids[0]}/{self.created_document_id}")
+                owned = requests.get(f"{self.base_url}/documents?filter=owned&limit=100", headers=self.auth(user))
+                for doc in owned.json():
+                    requests.delete(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user))
+                trashed = requests.get(f"{self.base_url}/trash?limit=100", headers=self.auth(user))
+                for doc in trashed.json():
+                    requests.delete(f"{self.base_url}/trash/{doc['id']}", headers=self.auth(user))
             except Exception:
                 pass
                 
-        for user_id in self.created_user_ids:
+        for user in self.created_users:
             try:
-                requests.delete(f"{self.base_url}/users/{user_id}")
+                requests.delete(f"{self.base_url}/users/{user['id']}", headers=self.auth(user))
             except Exception:
                 pass
         
         if self.db_conn:
             self.db_conn.close()
         
-        self.created_user_ids = []
+        self.created_users = []
         self.created_document_id = None
     
     def create_test_user(self, name="Test User", email_prefix="test"):
-        unique_email = f"{email_prefix}.{self.timestamp}.{len(self.created_user_ids)}@example.com"
-        user_data = {"name": name, "email": unique_email}
+        unique_email = f"{email_prefix}.{self.timestamp}.{len(self.created_users)}@example.com"
+        user_data = {"name": name, "email": unique_email, "password": PASSWORD}
         
         response = requests.post(f"{self.base_url}/users", headers=self.headers, json=user_data)
         assert response.status_code == 201
         user = response.json()
         
-        self.created_user_ids.append(user["id"])
+        login_response = requests.post(
+            f"{self.base_url}/auth/login",
+            headers=self.headers,
+            json={"email": unique_email, "password": PASSWORD}
+        )
+        assert login_response.status_code == 200
+        user["token"] = login_response.json()["token"]
+        
+        self.created_users.append(user)
         return user
     
+    def auth(self, user):
+        return {**self.headers, "Authorization": f"Bearer {user['token']}"}
+    
     def load_operations(self, filename):
         try:
             with open(os.path.join(self.operations_dir, filename), 'r') as f:
@@ -133,8 +152,8 @@ class TestDocumentEndpoints:
         }
         
         response = requests.post(
-            f"{self.base_url}/documents/{user['id']}",
-            headers=self.headers,
+            f"{self.base_url}/documents",
+            headers=self.auth(user),
             json=doc_data
         )
         
@@ -154,8 +173,8 @@ class TestDocumentEndpoints:
         }
         
         response = requests.post(
-            f"{self.base_url}/documents/{owner['id']}",
-            headers=self.headers,
+            f"{self.base_url}/documents",
+            headers=self.auth(owner),
             json=doc_data
         )
         
@@ -168,8 +187,8 @@ class TestDocumentEndpoints:
         doc1_data = {"title": "First Document", "userId": user["id"]}
         doc2_data = {"title": "Second Document", "userId": user["id"]}
         
-        doc1_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc1_data)
-        doc2_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc2_data)
+        doc1_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc1_data)
+        doc2_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc2_data)
         
         assert doc1_response.status_code == 201
         assert doc2_response.status_code == 201
@@ -177,22 +196,209 @@ class TestDocumentEndpoints:
         self.created_document_id = doc1_response.json()["id"]
         doc2_id = doc2_response.json()["id"]
         
-        response = requests.get(f"{self.base_url}/documents/{user['id']}")
+        response = requests.get(f"{self.base_url}/documents", headers=self.auth(user))
         
         assert response.status_code == 200
         docs = response.json()
         assert len(docs) >= 2
         
         try:
-            requests.delete(f"{self.base_url}/documents/{user['id']}/{doc2_id}")
+            requests.delete(f"{self.base_url}/documents/{doc2_id}", headers=self.auth(user))
         except Exception:
             pass
     
+    def test_list_shared_documents(self):
+        owner = self.create_test_user("Sharing Owner", "share.owner")
+        collaborator = self.create_test_user("Sharing Collaborator", "share.collab")
+        
+        doc_data = {
+            "title": "Shared With Me",
+            "allowedUsers": [{"userId": collaborator["id"], "permission": "view-only"}]
+        }
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json=doc_data)
+        assert create_response.status_code == 201
+        self.created_document_id = create_response.json()["id"]
+        
+        shared = requests.get(f"{self.base_url}/documents?filter=shared", headers=self.auth(collaborator))
+        assert shared.status_code == 200
+        match = [d for d in shared.json() if d["id"] == self.created_document_id]
+        assert len(match) == 1
+        assert match[0]["permission"] == "view-only"
+        
+        owned = requests.get(f"{self.base_url}/documents?filter=owned", headers=self.auth(collaborator))
+        assert owned.status_code == 200
+        assert all(d["id"] != self.created_document_id for d in owned.json())
+    
+    def test_list_documents_pagination(self):
+        user = self.create_test_user("Paging User", "paging")
+        
+        for title in ["Alpha", "Bravo", "Charlie"]:
+            response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json={"title": title})
+            assert response.status_code == 201
+        
+        first = requests.get(f"{self.base_url}/documents?sort=title&limit=2", headers=self.auth(user))
+        assert first.status_code == 200
+        assert [d["title"] for d in first.json()] == ["Alpha", "Bravo"]
+        cursor = first.headers.get("X-Next-Cursor")
+        assert cursor
+        
+        second = requests.get(f"{self.base_url}/documents?sort=title&limit=2&cursor={cursor}", headers=self.auth(user))
+        assert second.status_code == 200
+        assert [d["title"] for d in second.json()] == ["Charlie"]
+        assert "X-Next-Cursor" not in second.headers
+    
+    def test_list_documents_title_prefix(self):
+        user = self.create_test_user("Prefix User", "prefix")
+        
+        for title in ["Roadmap 2025", "roadmap draft", "Meeting notes", "Road_trip"]:
+            response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json={"title": title})
+            assert response.status_code == 201
+        
+        response = requests.get(f"{self.base_url}/documents?q=road", headers=self.auth(user))
+        assert response.status_code == 200
+        assert sorted(d["title"] for d in response.json()) == ["Road_trip", "Roadmap 2025", "roadmap draft"]
+        
+        # LIKE wildcards in the prefix match literally
+        response = requests.get(f"{self.base_url}/documents?q=road_", headers=self.auth(user))
+        assert response.status_code == 200
+        assert [d["title"] for d in response.json()] == ["Road_trip"]
+    
+    def test_document_permissions_enforced(self):
+        owner = self.create_test_user("Perm Owner", "perm.owner")
+        editor = self.create_test_user("Perm Editor", "perm.editor")
+        viewer = self.create_test_user("Perm Viewer", "perm.viewer")
+        stranger = self.create_test_user("Perm Stranger", "perm.stranger")
+        
+        doc_data = {
+            "title": "Permission Checked",
+            "allowedUsers": [
+                {"userId": editor["id"], "permission": "edit"},
+                {"userId": viewer["id"], "permission": "view-only"}
+            ]
+        }
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json=doc_data)
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        url = f"{self.base_url}/documents/{doc['id']}"
+        
+        viewer_read = requests.get(url, headers=self.auth(viewer))
+        assert viewer_read.status_code == 200
+        assert viewer_read.json()["permission"] == "view-only"
+        assert requests.put(url, headers=self.auth(viewer), json={"title": "Nope"}).status_code == 403
+        
+        assert requests.put(url, headers=self.auth(editor), json={"title": "Renamed"}).status_code == 200
+        assert requests.delete(url, headers=self.auth(editor)).status_code == 403
+        
+        assert requests.get(url, headers=self.auth(stranger)).status_code == 404
+    
+    def test_sharing_api(self):
+        owner = self.create_test_user("Share API Owner", "shareapi.owner")
+        collaborator = self.create_test_user("Share API Collaborator", "shareapi.collab")
+        
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json={"title": "Share API"})
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        url = f"{self.base_url}/documents/{doc['id']}/permissions"
+        
+        invalid = requests.post(url, headers=self.auth(owner), json={"email": collaborator["email"], "permission": "admin"})
+        assert invalid.status_code == 422
+        
+        shared = requests.post(url, headers=self.auth(owner), json={"email": collaborator["email"], "permission": "view-only"})
+        assert shared.status_code == 201
+        assert shared.json()["userId"] == collaborator["id"]
+        
+        duplicate = requests.post(url, headers=self.auth(owner), json={"email": collaborator["email"], "permission": "edit"})
+        assert duplicate.status_code == 409
+        
+        listed = requests.get(url, headers=self.auth(collaborator))
+        assert listed.status_code == 200
+        permissions = {c["userId"]: c["permission"] for c in listed.json()}
+        assert permissions[owner["id"]] == "owner"
+        assert permissions[collaborator["id"]] == "view-only"
+        
+        forbidden = requests.patch(f"{url}/{collaborator['id']}", headers=self.auth(collaborator), json={"permission": "edit"})
+        assert forbidden.status_code == 403
+        
+        promoted = requests.patch(f"{url}/{collaborator['id']}", headers=self.auth(owner), json={"permission": "edit"})
+        assert promoted.status_code == 200
+        assert promoted.json()["permission"] == "edit"
+        
+        revoked = requests.delete(f"{url}/{collaborator['id']}", headers=self.auth(owner))
+        assert revoked.status_code == 204
+        assert requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(collaborator)).status_code == 404
+    
+    def test_transfer_ownership(self):
+        owner = self.create_test_user("Transfer Owner", "transfer.owner")
+        new_owner = self.create_test_user("Transfer Recipient", "transfer.recipient")
+        
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json={"title": "Transfer"})
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        url = f"{self.base_url}/documents/{doc['id']}/owner"
+        
+        blocked = requests.delete(f"{self.base_url}/users/{owner['id']}", headers=self.auth(owner))
+        assert blocked.status_code == 409
+        assert doc["id"] in blocked.json()["error"]["details"]["ownedDocuments"]
+        
+        not_owner = requests.put(url, headers=self.auth(new_owner), json={"userId": new_owner["id"]})
+        assert not_owner.status_code == 404
+        
+        transferred = requests.put(url, headers=self.auth(owner), json={"email": new_owner["email"]})
+        assert transferred.status_code == 200
+        assert transferred.json()["userId"] == new_owner["id"]
+        
+        listed = requests.get(f"{self.base_url}/documents/{doc['id']}/permissions", headers=self.auth(new_owner))
+        permissions = {c["userId"]: c["permission"] for c in listed.json()}
+        assert permissions[new_owner["id"]] == "owner"
+        assert permissions[owner["id"]] == "edit"
+        
+        assert requests.delete(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(owner)).status_code == 403
+        assert requests.delete(f"{self.base_url}/users/{owner['id']}", headers=self.auth(owner)).status_code == 204
+        self.created_users.remove(owner)
+    
+    def test_share_links(self):
+        owner = self.create_test_user("Link Owner", "link.owner")
+        other = self.create_test_user("Link Other", "link.other")
+        
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json={"title": "Linked"})
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        url = f"{self.base_url}/documents/{doc['id']}/links"
+        
+        assert requests.post(url, headers=self.auth(owner), json={"permission": "admin"}).status_code == 422
+        assert requests.post(url, headers=self.auth(other), json={"permission": "view-only"}).status_code == 404
+        
+        created = requests.post(url, headers=self.auth(owner), json={"permission": "comment"})
+        assert created.status_code == 201
+        link = created.json()
+        assert link["token"]
+        
+        listed = requests.get(url, headers=self.auth(owner))
+        assert listed.status_code == 200
+        assert [l["id"] for l in listed.json()] == [link["id"]]
+        assert "token" not in listed.json()[0]
+        
+        resolved = requests.get(f"{self.base_url}/share-links/{link['token']}")
+        assert resolved.status_code == 200
+        assert resolved.json()["documentId"] == doc["id"]
+        assert resolved.json()["permission"] == "comment"
+        assert resolved.json()["title"] == "Linked"
+        
+        assert requests.get(f"{self.base_url}/share-links/not-a-real-token").status_code == 404
+        
+        revoked = requests.delete(f"{url}/{link['id']}", headers=self.auth(owner))
+        assert revoked.status_code == 204
+        assert requests.get(f"{self.base_url}/share-links/{link['token']}").status_code == 410
+    
     def test_get_document_success(self):
         user = self.create_test_user("Doc Reader", "reader")
         
         doc_data = {"title": "Readable Document", "userId": user["id"]}
-        create_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc_data)
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
         
         assert create_response.status_code == 201
         doc = create_response.json()
@@ -200,16 +406,318 @@ class TestDocumentEndpoints:
         
         time.sleep(0.1)
         
-        response = requests.get(f"{self.base_url}/documents/{user['id']}/{doc['id']}")
+        response = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user))
+        
+        assert response.status_code == 200
+    
+    def test_get_document_materializes_operations(self):
+        if not self.db_conn:
+            pytest.skip("Database connection required for operations tests")
+        
+        user = self.create_test_user("Materialize User", "materialize")
+        
+        doc_data = {"title": "Materialized Document", "userId": user["id"]}
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        
+        operations = [
+            {"type": "insert", "position": 0, "text": "hello", "length": 0},
+            {"type": "delete", "position": 0, "text": "", "length": 1}
+        ]
+        self.add_operations_to_db(doc["id"], operations)
+        
+        response = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user))
+        assert response.status_code == 200
+        body = response.json()
+        assert body["content"] == "ello"
+        assert body["version"] == 2
+        assert "operations" not in body
+        
+        etag = response.headers.get("ETag")
+        assert etag
+        cached = requests.get(
+            f"{self.base_url}/documents/{doc['id']}",
+            headers={**self.auth(user), "If-None-Match": etag}
+        )
+        assert cached.status_code == 304
+    
+    def test_get_document_rich_text_delta(self):
+        if not self.db_conn:
+            pytest.skip("Database connection required for operations tests")
+        
+        user = self.create_test_user("Rich Text User", "richtext")
+        
+        doc_data = {"title": "Rich Document", "userId": user["id"]}
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        
+        operations = [
+            {"type": "insert", "position": 0, "text": "hello world", "length": 0},
+            {"type": "format", "position": 0, "text": "", "length": 5, "attributes": {"bold": True}},
+            {"type": "format", "position": 6, "text": "", "length": 5, "attributes": {"link": "https://example.com"}}
+        ]
+        self.add_operations_to_db(doc["id"], operations)
+        
+        response = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user))
+        assert response.status_code == 200
+        body = response.json()
+        assert body["content"] == "hello world"
+        assert body["delta"]["ops"] == [
+            {"insert": "hello", "attributes": {"bold": True}},
+            {"insert": " "},
+            {"insert": "world", "attributes": {"link": "https://example.com"}}
+        ]
+    
+    def test_export_document(self):
+        if not self.db_conn:
+            pytest.skip("Database connection required for operations tests")
+        
+        user = self.create_test_user("Export User", "export")
+        
+        doc_data = {"title": "Quarterly Report", "userId": user["id"]}
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        
+        operations = [
+            {"type": "insert", "position": 0, "text": "Summary\nRevenue grew", "length": 0},
+            {"type": "format", "position": 7, "text": "", "length": 1, "attributes": {"header": 1}},
+            {"type": "format", "position": 8, "text": "", "length": 7, "attributes": {"bold": True}}
+        ]
+        self.add_operations_to_db(doc["id"], operations)
+        url = f"{self.base_url}/documents/{doc['id']}/export"
+        
+        response = requests.get(url, headers=self.auth(user), params={"format": "md"})
+        assert response.status_code == 200
+        assert response.headers["Content-Type"].startswith("text/markdown")
+        assert 'filename="Quarterly Report.md"' in response.headers["Content-Disposition"]
+        assert response.text == "# Summary\n\n**Revenue** grew\n"
+        
+        response = requests.get(url, headers=self.auth(user), params={"format": "html"})
+        assert response.status_code == 200
+        assert "<h1>Summary</h1>" in response.text
+        assert "<strong>Revenue</strong>" in response.text
+        
+        response = requests.get(url, headers=self.auth(user), params={"format": "txt"})
+        assert response.status_code == 200
+        assert response.text == "Summary\nRevenue grew\n"
+        
+        response = requests.get(url, headers=self.auth(user), params={"format": "pdf"})
+        assert response.status_code == 200
+        assert response.headers["Content-Type"] == "application/pdf"
+        assert response.content.startswith(b"%PDF-")
+        
+        response = requests.get(url, headers=self.auth(user), params={"format": "docx"})
+        assert response.status_code == 200
+        assert 'filename="Quarterly Report.docx"' in response.headers["Content-Disposition"]
+        assert response.content.startswith(b"PK")
+        
+        response = requests.get(url, headers=self.auth(user), params={"format": "rtf"})
+        assert response.status_code == 400
+        assert response.json()["error"]["code"] == "invalid_argument"
+        
+        outsider = self.create_test_user("Export Outsider", "exportout")
+        response = requests.get(url, headers=self.auth(outsider), params={"format": "md"})
+        assert response.status_code == 404
+    
+    def test_folders_inherit_permissions(self):
+        owner = self.create_test_user("Folder Owner", "folder.owner")
+        reader = self.create_test_user("Folder Reader", "folder.reader")
+        stranger = self.create_test_user("Folder Stranger", "folder.stranger")
+        
+        response = requests.post(f"{self.base_url}/folders", headers=self.auth(owner), json={"name": "Projects"})
+        assert response.status_code == 201
+        top = response.json()
+        assert top["parentId"] is None
+        
+        response = requests.post(f"{self.base_url}/folders", headers=self.auth(owner), json={"name": "2025", "parentId": top["id"]})
+        assert response.status_code == 201
+        sub = response.json()
+        
+        doc = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json={"title": "Filed"}).json()
+        response = requests.put(f"{self.base_url}/documents/{doc['id']}/folder", headers=self.auth(owner), json={"folderId": sub["id"]})
+        assert response.status_code == 200
+        assert response.json()["folderId"] == sub["id"]
+        
+        # Nothing is visible before the top folder is shared
+        assert requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(reader)).status_code == 404
+        response = requests.post(
+            f"{self.base_url}/folders/{top['id']}/permissions",
+            headers=self.auth(owner),
+            json={"email": reader["email"], "permission": "view-only"}
+        )
+        assert response.status_code == 200
+        
+        response = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(reader))
+        assert response.status_code == 200
+        assert response.json()["permission"] == "view-only"
+        response = requests.put(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(reader), json={"title": "Renamed"})
+        assert response.status_code == 403
+        
+        # Inherited access shows up in listings and search like a direct share
+        listed = requests.get(f"{self.base_url}/documents?filter=shared", headers=self.auth(reader)).json()
+        assert [(d["id"], d["permission"]) for d in listed] == [(doc["id"], "view-only")]
+        hits = requests.get(f"{self.base_url}/search", headers=self.auth(reader), params={"q": "filed"}).json()
+        assert [(h["id"], h["permission"]) for h in hits] == [(doc["id"], "view-only")]
+        assert requests.get(f"{self.base_url}/documents", headers=self.auth(stranger)).json() == []
+        
+        # The highest of a direct and an inherited permission wins
+        response = requests.post(
+            f"{self.base_url}/folders/{sub['id']}/permissions",
+            headers=self.auth(owner),
+            json={"email": reader["email"], "permission": "edit"}
+        )
+        assert response.status_code == 200
+        listed = requests.get(f"{self.base_url}/documents", headers=self.auth(reader)).json()
+        assert [(d["id"], d["permission"]) for d in listed] == [(doc["id"], "edit")]
+        assert requests.delete(f"{self.base_url}/folders/{sub['id']}/permissions/{reader['id']}", headers=self.auth(owner)).status_code == 204
         
+        response = requests.get(f"{self.base_url}/folders", headers=self.auth(reader))
         assert response.status_code == 200
+        trees = [t for t in response.json() if t["id"] == top["id"]]
+        assert len(trees) == 1
+        assert [f["id"] for f in trees[0]["folders"]] == [sub["id"]]
+        filed = trees[0]["folders"][0]["documents"]
+        assert [(d["id"], d["permission"]) for d in filed] == [(doc["id"], "view-only")]
+        
+        assert requests.get(f"{self.base_url}/folders/{sub['id']}", headers=self.auth(stranger)).status_code == 404
+        assert requests.patch(f"{self.base_url}/folders/{sub['id']}", headers=self.auth(reader), json={"name": "Nope"}).status_code == 403
+        
+        # Folders cannot be moved beneath themselves or deleted while not empty
+        response = requests.put(f"{self.base_url}/folders/{top['id']}/parent", headers=self.auth(owner), json={"folderId": sub["id"]})
+        assert response.status_code == 409
+        assert requests.delete(f"{self.base_url}/folders/{top['id']}", headers=self.auth(owner)).status_code == 409
+        
+        response = requests.put(f"{self.base_url}/documents/{doc['id']}/folder", headers=self.auth(owner), json={"folderId": None})
+        assert response.status_code == 200
+        assert response.json()["folderId"] is None
+        assert requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(reader)).status_code == 404
+        assert requests.get(f"{self.base_url}/documents", headers=self.auth(reader)).json() == []
+        assert requests.delete(f"{self.base_url}/folders/{sub['id']}", headers=self.auth(owner)).status_code == 204
+    
+    def test_search_documents(self):
+        owner = self.create_test_user("Search Owner", "search.owner")
+        stranger = self.create_test_user("Search Stranger", "search.stranger")
+        word = f"zebrafish{self.timestamp}"
+        
+        text = f"Quarterly notes\n\nThe {word} migration study starts in spring.\n"
+        response = requests.post(
+            f"{self.base_url}/documents/import",
+            headers=self.auth(owner),
+            files={"file": ("notes.txt", text.encode(), "text/plain")}
+        )
+        assert response.status_code == 201
+        doc = response.json()
+        
+        response = requests.get(f"{self.base_url}/search", headers=self.auth(owner), params={"q": word})
+        assert response.status_code == 200
+        hits = [h for h in response.json() if h["id"] == doc["id"]]
+        assert len(hits) == 1
+        hit = hits[0]
+        assert hit["permission"] == "owner"
+        assert any(hit["snippet"][r["start"]:r["end"]] == word for r in hit["highlights"])
+        
+        # Users without access never see the document
+        response = requests.get(f"{self.base_url}/search", headers=self.auth(stranger), params={"q": word})
+        assert response.status_code == 200
+        assert all(h["id"] != doc["id"] for h in response.json())
+        
+        assert requests.get(f"{self.base_url}/search", headers=self.auth(owner)).status_code == 400
+    
+    def test_import_document(self):
+        user = self.create_test_user("Import User", "import")
+        url = f"{self.base_url}/documents/import"
+        
+        markdown = "# Plan\n\nShip **fast** and *often*\n\n- one\n- two\n"
+        response = requests.post(url, headers=self.auth(user), files={"file": ("plan.md", markdown.encode(), "text/markdown")})
+        assert response.status_code == 201
+        doc = response.json()
+        self.created_document_id = doc["id"]
+        assert doc["title"] == "plan"
+        assert doc["content"] == "Plan\nShip fast and often\none\ntwo\n"
+        
+        fetched = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user)).json()
+        assert fetched["content"] == doc["content"]
+        assert {"insert": "fast", "attributes": {"bold": True}} in fetched["delta"]["ops"]
+        assert {"insert": "\n", "attributes": {"header": 1}} in fetched["delta"]["ops"]
+        
+        # Windows-1252 text without a charset is detected and converted
+        legacy = "caf\u00e9 \u201cquoted\u201d".encode("cp1252")
+        response = requests.post(url, headers=self.auth(user), files={"file": ("notes.txt", legacy)}, data={"title": "Notes"})
+        assert response.status_code == 201
+        imported = response.json()
+        assert imported["title"] == "Notes"
+        assert imported["content"] == "caf\u00e9 \u201cquoted\u201d"
+        requests.delete(f"{self.base_url}/documents/{imported['id']}", headers=self.auth(user))
+        
+        response = requests.post(url, headers=self.auth(user), files={"file": ("slides.pptx", b"PK")})
+        assert response.status_code == 415
+        assert response.json()["error"]["code"] == "unsupported_media_type"
+        
+        response = requests.post(url, headers=self.auth(user), files={"file": ("broken.docx", b"not a zip")})
+        assert response.status_code == 422
+        
+        response = requests.post(url, headers=self.auth(user), data={"title": "No file"})
+        assert response.status_code == 400
+    
+    def test_comment_threads(self):
+        if not self.db_conn:
+            pytest.skip("Database connection required for operations tests")
+        
+        owner = self.create_test_user("Comment Owner", "comment.owner")
+        commenter = self.create_test_user("Commenter", "comment.commenter")
+        viewer = self.create_test_user("Comment Viewer", "comment.viewer")
+        
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json={"title": "Commented"})
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        self.add_operations_to_db(doc["id"], [{"type": "insert", "position": 0, "text": "hello world", "length": 0}])
+        
+        sharing = f"{self.base_url}/documents/{doc['id']}/permissions"
+        assert requests.post(sharing, headers=self.auth(owner), json={"email": commenter["email"], "permission": "comment"}).status_code == 201
+        assert requests.post(sharing, headers=self.auth(owner), json={"email": viewer["email"], "permission": "view-only"}).status_code == 201
+        
+        url = f"{self.base_url}/documents/{doc['id']}/comments"
+        thread = {"body": "Capitalize?", "anchorStart": 0, "anchorEnd": 5}
+        assert requests.post(url, headers=self.auth(viewer), json=thread).status_code == 403
+        assert requests.post(url, headers=self.auth(commenter), json={**thread, "anchorEnd": 50}).status_code == 422
+        
+        created = requests.post(url, headers=self.auth(commenter), json=thread)
+        assert created.status_code == 201
+        comment = created.json()
+        assert comment["quotedText"] == "hello"
+        
+        reply = requests.post(f"{url}/{comment['id']}/replies", headers=self.auth(owner), json={"body": "Yes"})
+        assert reply.status_code == 201
+        assert reply.json()["parentId"] == comment["id"]
+        
+        assert requests.patch(f"{url}/{comment['id']}", headers=self.auth(owner), json={"body": "Edited"}).status_code == 403
+        
+        resolved = requests.post(f"{url}/{comment['id']}/resolve", headers=self.auth(commenter))
+        assert resolved.status_code == 200
+        assert resolved.json()["resolved"]
+        assert requests.get(url, headers=self.auth(viewer)).json() == []
+        
+        threads = requests.get(f"{url}?status=resolved", headers=self.auth(viewer)).json()
+        assert [t["id"] for t in threads] == [comment["id"]]
+        assert [r["body"] for r in threads[0]["replies"]] == ["Yes"]
+        
+        assert requests.post(f"{url}/{comment['id']}/reopen", headers=self.auth(commenter)).status_code == 200
+        assert requests.delete(f"{url}/{comment['id']}", headers=self.auth(owner)).status_code == 204
+        assert requests.get(f"{url}?status=all", headers=self.auth(owner)).json() == []
     
     def test_update_document_metadata(self):
         user = self.create_test_user("Doc Updater", "updater")
         collaborator = self.create_test_user("Collaborator", "collab.update")
         
         doc_data = {"title": "Original Title", "userId": user["id"]}
-        create_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc_data)
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
         
         assert create_response.status_code == 201
         doc = create_response.json()
@@ -226,8 +734,8 @@ class TestDocumentEndpoints:
         }
         
         response = requests.put(
-            f"{self.base_url}/documents/{user['id']}/{doc['id']}",
-            headers=self.headers,
+            f"{self.base_url}/documents/{doc['id']}",
+            headers=self.auth(user),
             json=update_data
         )
         
@@ -237,21 +745,122 @@ class TestDocumentEndpoints:
         user = self.create_test_user("Doc Deleter", "deleter")
         
         doc_data = {"title": "To Be Deleted", "userId": user["id"]}
-        create_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc_data)
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
         
         assert create_response.status_code == 201
         doc = create_response.json()
         
         time.sleep(0.1)
         
-        response = requests.delete(f"{self.base_url}/documents/{user['id']}/{doc['id']}")
+        response = requests.delete(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user))
         
         assert response.status_code == 204
         self.created_document_id = None
     
+    def test_trash_and_restore(self):
+        user = self.create_test_user("Trash User", "trash")
+        collaborator = self.create_test_user("Trash Collaborator", "trash.collab")
+        
+        doc_data = {"title": "Trashed", "allowedUsers": [{"userId": collaborator["id"], "permission": "edit"}]}
+        doc = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data).json()
+        
+        assert requests.delete(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user)).status_code == 204
+        assert requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user)).status_code == 404
+        assert requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(collaborator)).status_code == 404
+        listed = requests.get(f"{self.base_url}/documents", headers=self.auth(user)).json()
+        assert all(d["id"] != doc["id"] for d in listed)
+        
+        # Only the owner sees the document in their trash
+        trash = requests.get(f"{self.base_url}/trash", headers=self.auth(user))
+        assert trash.status_code == 200
+        trashed = [d for d in trash.json() if d["id"] == doc["id"]]
+        assert len(trashed) == 1 and trashed[0]["deleted_at"]
+        assert all(d["id"] != doc["id"] for d in requests.get(f"{self.base_url}/trash", headers=self.auth(collaborator)).json())
+        assert requests.post(f"{self.base_url}/trash/{doc['id']}/restore", headers=self.auth(collaborator)).status_code == 404
+        
+        response = requests.post(f"{self.base_url}/trash/{doc['id']}/restore", headers=self.auth(user))
+        assert response.status_code == 200
+        assert "deleted_at" not in response.json()
+        # Sharing survives the round trip
+        response = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(collaborator))
+        assert response.status_code == 200
+        assert response.json()["permission"] == "edit"
+        
+        assert requests.delete(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user)).status_code == 204
+        assert requests.delete(f"{self.base_url}/trash/{doc['id']}", headers=self.auth(user)).status_code == 204
+        assert requests.post(f"{self.base_url}/trash/{doc['id']}/restore", headers=self.auth(user)).status_code == 404
+        assert all(d["id"] != doc["id"] for d in requests.get(f"{self.base_url}/trash", headers=self.auth(user)).json())
+    
+    def test_duplicate_document_and_templates(self):
+        owner = self.create_test_user("Template Owner", "template")
+        reader = self.create_test_user("Template Reader", "template.reader")
+        
+        markdown = "Dear **{{ name }}**,\n\nWelcome to {{company}}. {{missing}}\n"
+        files = {"file": ("letter.md", markdown.encode(), "text/markdown")}
+        doc = requests.post(f"{self.base_url}/documents/import", headers=self.auth(owner), files=files, data={"title": "Letter for {{name}}"}).json()
+        self.created_document_id = doc["id"]
+        
+        # A plain copy keeps the content and nothing else
+        response = requests.post(f"{self.base_url}/documents/{doc['id']}/duplicate", headers=self.auth(owner))
+        assert response.status_code == 201
+        copy = response.json()
+        assert copy["id"] != doc["id"]
+        assert copy["title"] == "Copy of Letter for {{name}}"
+        assert copy["content"] == doc["content"]
+        assert copy["isTemplate"] is False
+        response = requests.post(f"{self.base_url}/documents/{doc['id']}/duplicate", headers=self.auth(owner), json={"values": {"name": "Ada"}})
+        assert response.status_code == 400
+        
+        # Only the owner offers templates; readers can then fill them in
+        share = {"allowedUsers": [{"userId": reader["id"], "permission": "view-only"}], "title": doc["title"]}
+        assert requests.put(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(owner), json=share).status_code == 200
+        assert requests.put(f"{self.base_url}/documents/{doc['id']}/template", headers=self.auth(reader), json={"isTemplate": True}).status_code == 403
+        response = requests.put(f"{self.base_url}/documents/{doc['id']}/template", headers=self.auth(owner), json={"isTemplate": True})
+        assert response.status_code == 200
+        assert response.json()["isTemplate"] is True
+        
+        fetched = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(reader)).json()
+        assert fetched["placeholders"] == ["name", "company", "missing"]
+        templates = requests.get(f"{self.base_url}/documents?filter=templates", headers=self.auth(reader)).json()
+        assert [d["id"] for d in templates] == [doc["id"]]
+        
+        values = {"name": "Ada", "company": "Draftly"}
+        response = requests.post(f"{self.base_url}/documents/{doc['id']}/duplicate", headers=self.auth(reader), json={"values": values})
+        assert response.status_code == 201
+        filled = response.json()
+        assert filled["userId"] == reader["id"]
+        assert filled["title"] == "Letter for Ada"
+        assert filled["content"] == "Dear Ada,\nWelcome to Draftly. {{missing}}\n"
+        assert filled["unfilledPlaceholders"] == ["missing"]
+        assert filled["isTemplate"] is False
+        
+        # The value keeps the placeholder's formatting
+        fetched = requests.get(f"{self.base_url}/documents/{filled['id']}", headers=self.auth(reader)).json()
+        assert {"insert": "Ada", "attributes": {"bold": True}} in fetched["delta"]["ops"]
+        
+        response = requests.post(f"{self.base_url}/documents/{doc['id']}/duplicate", headers=self.auth(reader), json={"values": {"name": "two\nlines"}})
+        assert response.status_code == 400
+    
+    def test_document_access(self):
+        owner = self.create_test_user("Access Owner", "access")
+        commenter = self.create_test_user("Access Commenter", "access.commenter")
+        stranger = self.create_test_user("Access Stranger", "access.stranger")
+        
+        doc_data = {"title": "Access", "allowedUsers": [{"userId": commenter["id"], "permission": "comment"}]}
+        doc = requests.post(f"{self.base_url}/documents", headers=self.auth(owner), json=doc_data).json()
+        self.created_document_id = doc["id"]
+        url = f"{self.base_url}/documents/{doc['id']}/access"
+        
+        response = requests.get(url, headers=self.auth(owner))
+        assert response.status_code == 200
+        assert response.json() == {"documentId": doc["id"], "userId": owner["id"], "permission": "owner"}
+        assert requests.get(url, headers=self.auth(commenter)).json()["permission"] == "comment"
+        assert requests.get(url, headers=self.auth(stranger)).status_code == 404
+        assert requests.get(url).status_code == 401
+    
     def test_document_not_found(self):
         user = self.create_test_user("Not Found User", "notfound")
-        response = requests.get(f"{self.base_url}/documents/{user['id']}/99999")
+        response = requests.get(f"{self.base_url}/documents/99999", headers=self.auth(user))
         
         assert response.status_code == 404
     
@@ -262,7 +871,7 @@ class TestDocumentEndpoints:
         user = self.create_test_user("JSON Ops User", "jsonops")
         
         doc_data = {"title": "JSON Operations Document", "userId": user["id"]}
-        create_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc_data)
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
         assert create_response.status_code == 201
         doc = create_response.json()
         self.created_document_id = doc["id"]
@@ -281,7 +890,7 @@ class TestDocumentEndpoints:
             
             if operations:
                 self.add_operations_to_db(doc["id"], operations)
-                requests.put(f"{self.base_url}/documents/{doc['id']}")
+                requests.put(f"{self.base_url}/documents/{doc['id']}/content", headers=self.auth(user))
     
     def test_operations_cleared_after_processing(self):
         if not self.db_conn:
@@ -290,7 +899,7 @@ class TestDocumentEndpoints:
         user = self.create_test_user("Clear Ops User", "clearops")
         
         doc_data = {"title": "Clear Operations Document", "userId": user["id"]}
-        create_response = requests.post(f"{self.base_url}/documents/{user['id']}", headers=self.headers, json=doc_data)
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
         assert create_response.status_code == 201
         doc = create_response.json()
         self.created_document_id = doc["id"]
@@ -301,7 +910,7 @@ class TestDocumentEndpoints:
         doc_before = self.get_document_from_db(doc["id"])
         assert doc_before["operations"] is not None
         
-        process_response = requests.put(f"{self.base_url}/documents/{doc['id']}")
+        process_response = requests.put(f"{self.base_url}/documents/{doc['id']}/content", headers=self.auth(user))
         assert process_response.status_code == 200
         
         time.sleep(0.2)
@@ -309,6 +918,39 @@ class TestDocumentEndpoints:
         operations_after = json.loads(doc_after["operations"]) if doc_after["operations"] else []
         
         assert len(operations_after) == 0
+    
+    def test_compaction_snapshots_are_content_addressed(self):
+        if not self.db_conn:
+            pytest.skip("Database connection required for operations tests")
+        
+        user = self.create_test_user("Snapshot User", "snapshot")
+        
+        doc_data = {"title": "Snapshot Document", "userId": user["id"]}
+        create_response = requests.post(f"{self.base_url}/documents", headers=self.auth(user), json=doc_data)
+        assert create_response.status_code == 201
+        doc = create_response.json()
+        self.created_document_id = doc["id"]
+        
+        self.add_operations_to_db(doc["id"], [{"type": "insert", "position": 0, "text": "same text", "length": 0}])
+        assert requests.put(f"{self.base_url}/documents/{doc['id']}/content", headers=self.auth(user)).status_code == 200
+        
+        cursor = self.db_conn.cursor()
+        cursor.execute('SELECT s3_key, content_sha256 FROM "Documents" WHERE id = %s', (doc["id"],))
+        first_key, first_hash = cursor.fetchone()
+        assert first_hash == hashlib.sha256(b"same text").hexdigest()
+        assert first_hash in first_key
+        
+        # Compacting again without changes reuses the stored snapshot
+        assert requests.put(f"{self.base_url}/documents/{doc['id']}/content", headers=self.auth(user)).status_code == 200
+        cursor.execute('SELECT s3_key, content_sha256 FROM "Documents" WHERE id = %s', (doc["id"],))
+        assert cursor.fetchone() == (first_key, first_hash)
+        
+        # A recorded hash that does not match the stored content is rejected
+        cursor.execute('UPDATE "Documents" SET content_sha256 = %s, delta_key = NULL WHERE id = %s', ("0" * 64, doc["id"]))
+        self.db_conn.commit()
+        cursor.close()
+        response = requests.get(f"{self.base_url}/documents/{doc['id']}", headers=self.auth(user))
+        assert response.status_code == 500
 
 
 def test_api_health():
@@ -1,11 +1,13 @@
 import requests
 import json
 import pytest
+import time
 from typing import Dict, Any
 
 # Configuration
 BASE_URL = "http://localhost:6060/v1"
 HEADERS = {"Content-Type": "application/json"}
+PASSWORD = "correct-horse-battery"
 
 class TestUserEndpoints:
     """Test suite for User API endpoints"""
@@ -15,21 +17,46 @@ class TestUserEndpoints:
         self.base_url = BASE_URL
         self.headers = HEADERS
         self.created_user_id = None
+        self.auth_headers = None
     
     def teardown_method(self):
         """Cleanup method run after each test"""
         # Clean up created user if exists
-        if self.created_user_id:
+        if self.created_user_id and self.auth_headers:
             try:
-                requests.delete(f"{self.base_url}/users/{self.created_user_id}")
+                requests.delete(f"{self.base_url}/users/{self.created_user_id}", headers=self.auth_headers)
             except:
                 pass  # Ignore cleanup errors
     
+    def login(self, email):
+        """Log in and return headers carrying the bearer token"""
+        response = requests.post(
+            f"{self.base_url}/auth/login",
+            headers=self.headers,
+            json={"email": email, "password": PASSWORD}
+        )
+        assert response.status_code == 200
+        return {**self.headers, "Authorization": f"Bearer {response.json()['token']}"}
+    
+    def create_logged_in_user(self, prefix="auth"):
+        """Create a throwaway user and log in as them"""
+        email = f"{prefix}.{int(time.time() * 1000)}@example.com"
+        response = requests.post(
+            f"{self.base_url}/users",
+            headers=self.headers,
+            json={"name": "Auth User", "email": email, "password": PASSWORD}
+        )
+        assert response.status_code == 201
+        self.created_user_id = response.json()["id"]
+        self.auth_headers = self.login(email)
+        return self.created_user_id
+    
     def test_create_user_success(self):
         """Test successful user creation"""
         user_data = {
             "name": "John Doe",
-            "email": "john.doe@example.com"
+            "email": "john.doe@example.com",
+            "password": PASSWORD
         }
         
         response = requests.post(
@@ -59,6 +86,26 @@ class TestUserEndpoints:
         )
         
         assert response.status_code == 400
+        error = response.json()["error"]
+        assert error["code"] == "invalid_json"
+        assert error["requestId"]
+    
+    def test_create_user_duplicate_email(self):
+        """Test that reusing an email is reported as a conflict"""
+        user_data = {
+            "name": "Duplicate",
+            "email": f"duplicate.{int(time.time() * 1000)}@example.com",
+            "password": PASSWORD
+        }
+        
+        first = requests.post(f"{self.base_url}/users", headers=self.headers, json=user_data)
+        assert first.status_code == 201
+        self.created_user_id = first.json()["id"]
+        self.auth_headers = self.login(user_data["email"])
+        
+        second = requests.post(f"{self.base_url}/users", headers=self.headers, json=user_data)
+        assert second.status_code == 409
+        assert second.json()["error"]["code"] == "conflict"
     
     def test_create_user_missing_fields(self):
         """Test user creation with missing required fields"""
@@ -81,7 +128,8 @@ class TestUserEndpoints:
         # First create a user
         user_data = {
             "name": "Jane Smith",
-            "email": "jane.smith@example.com"
+            "email": "jane.smith@example.com",
+            "password": PASSWORD
         }
         
         create_response = requests.post(
@@ -93,9 +141,10 @@ class TestUserEndpoints:
         assert create_response.status_code == 201
         user_id = create_response.json()["id"]
         self.created_user_id = user_id
+        self.auth_headers = self.login(user_data["email"])
         
         # Now get the user
-        response = requests.get(f"{self.base_url}/users/{user_id}")
+        response = requests.get(f"{self.base_url}/users/{user_id}", headers=self.auth_headers)
         
         assert response.status_code == 200
         
@@ -106,13 +155,58 @@ class TestUserEndpoints:
     
     def test_get_user_not_found(self):
         """Test getting non-existent user"""
-        response = requests.get(f"{self.base_url}/users/99999")
+        self.create_logged_in_user("notfound")
+        response = requests.get(f"{self.base_url}/users/99999", headers=self.auth_headers)
         
         assert response.status_code == 404
     
     def test_get_user_invalid_id(self):
         """Test getting user with invalid ID"""
-        response = requests.get(f"{self.base_url}/users/invalid")
+        self.create_logged_in_user("invalid")
+        response = requests.get(f"{self.base_url}/users/invalid", headers=self.auth_headers)
+        
+        assert response.status_code == 400
+    
+    def test_list_users_paginated(self):
+        """Test listing users by email prefix, following the Link header"""
+        self.create_logged_in_user("lister")
+        prefix = f"listed{int(time.time() * 1000)}"
+        listed = []
+        for letter in ["a", "b", "c"]:
+            response = requests.post(
+                f"{self.base_url}/users",
+                headers=self.headers,
+                json={"name": f"Listed {letter}", "email": f"{prefix}.{letter}@example.com", "password": PASSWORD}
+            )
+            assert response.status_code == 201
+            listed.append(response.json())
+        
+        try:
+            first = requests.get(
+                f"{self.base_url}/users?q={prefix}&sort=name&limit=2",
+                headers=self.auth_headers
+            )
+            assert first.status_code == 200
+            assert [u["name"] for u in first.json()] == ["Listed a", "Listed b"]
+            assert first.headers.get("X-Next-Cursor")
+            assert first.links["next"]["url"].startswith("/v1/users?")
+            
+            second = requests.get(
+                f"{BASE_URL.replace('/v1', '')}{first.links['next']['url']}",
+                headers=self.auth_headers
+            )
+            assert second.status_code == 200
+            assert [u["name"] for u in second.json()] == ["Listed c"]
+            assert "Link" not in second.headers
+        finally:
+            for user in listed:
+                headers = self.login(user["email"])
+                requests.delete(f"{self.base_url}/users/{user['id']}", headers=headers)
+    
+    def test_list_users_invalid_sort(self):
+        """Test that unknown sort keys are rejected"""
+        self.create_logged_in_user("badsort")
+        response = requests.get(f"{self.base_url}/users?sort=email", headers=self.auth_headers)
         
         assert response.status_code == 400
     
@@ -121,7 +215,8 @@ class TestUserEndpoints:
         # First create a user
         user_data = {
             "name": "Bob Johnson",
-            "email": "bob.johnson@example.com"
+            "email": "bob.johnson@example.com",
+            "password": PASSWORD
         }
         
         create_response = requests.post(
@@ -133,6 +228,7 @@ class TestUserEndpoints:
         assert create_response.status_code == 201
         user_id = create_response.json()["id"]
         self.created_user_id = user_id
+        self.auth_headers = self.login(user_data["email"])
         
         # Update the user
         update_data = {
@@ -142,7 +238,7 @@ class TestUserEndpoints:
         
         response = requests.put(
             f"{self.base_url}/users/{user_id}",
-            headers=self.headers,
+            headers=self.auth_headers,
             json=update_data
         )
         
@@ -153,8 +249,9 @@ class TestUserEndpoints:
         assert response_data["name"] == update_data["name"]
         assert response_data["email"] == update_data["email"]
     
-    def test_update_user_not_found(self):
-        """Test updating non-existent user"""
+    def test_update_other_user_forbidden(self):
+        """Test updating a user other than yourself"""
+        self.create_logged_in_user("other")
         update_data = {
             "name": "Non Existent",
             "email": "nonexistent@example.com"
@@ -162,17 +259,18 @@ class TestUserEndpoints:
         
         response = requests.put(
             f"{self.base_url}/users/99999",
-            headers=self.headers,
+            headers=self.auth_headers,
             json=update_data
         )
         
-        assert response.status_code == 404
+        assert response.status_code == 403
     
     def test_update_user_invalid_json(self):
         """Test updating user with invalid JSON"""
+        user_id = self.create_logged_in_user("badjson")
         response = requests.put(
-            f"{self.base_url}/users/1",
-            headers=self.headers,
+            f"{self.base_url}/users/{user_id}",
+            headers=self.auth_headers,
             data="invalid json"
         )
         
@@ -183,7 +281,8 @@ class TestUserEndpoints:
         # First create a user
         user_data = {
             "name": "Delete Me",
-            "email": "delete.me@example.com"
+            "email": "delete.me@example.com",
+            "password": PASSWORD
         }
         
         create_response = requests.post(
@@ -194,28 +293,31 @@ class TestUserEndpoints:
         
         assert create_response.status_code == 201
         user_id = create_response.json()["id"]
+        self.auth_headers = self.login(user_data["email"])
         
         # Delete the user
-        response = requests.delete(f"{self.base_url}/users/{user_id}")
+        response = requests.delete(f"{self.base_url}/users/{user_id}", headers=self.auth_headers)
         
         assert response.status_code == 204
         
-        # Verify user is deleted
-        get_response = requests.get(f"{self.base_url}/users/{user_id}")
-        assert get_response.status_code == 404
+        # Verify user is deleted; their sessions go with them
+        get_response = requests.get(f"{self.base_url}/users/{user_id}", headers=self.auth_headers)
+        assert get_response.status_code == 401
         
         # Don't need cleanup since user is deleted
         self.created_user_id = None
     
-    def test_delete_user_not_found(self):
-        """Test deleting non-existent user"""
-        response = requests.delete(f"{self.base_url}/users/99999")
+    def test_delete_other_user_forbidden(self):
+        """Test deleting a user other than yourself"""
+        self.create_logged_in_user("deleteother")
+        response = requests.delete(f"{self.base_url}/users/99999", headers=self.auth_headers)
         
-        assert response.status_code == 404
+        assert response.status_code == 403
     
     def test_delete_user_invalid_id(self):
         """Test deleting user with invalid ID"""
-        response = requests.delete(f"{self.base_url}/users/invalid")
+        self.create_logged_in_user("deleteinvalid")
+        response = requests.delete(f"{self.base_url}/users/invalid", headers=self.auth_headers)
         
         assert response.status_code == 400
     
@@ -224,7 +326,8 @@ class TestUserEndpoints:
         # Create
         user_data = {
             "name": "CRUD Test User",
-            "email": "crud.test@example.com"
+            "email": "crud.test@example.com",
+            "password": PASSWORD
         }
         
         create_response = requests.post(
@@ -236,9 +339,10 @@ class TestUserEndpoints:
         assert create_response.status_code == 201
         user_id = create_response.json()["id"]
         self.created_user_id = user_id
+        self.auth_headers = self.login(user_data["email"])
         
         # Read
-        get_response = requests.get(f"{self.base_url}/users/{user_id}")
+        get_response = requests.get(f"{self.base_url}/users/{user_id}", headers=self.auth_headers)
         assert get_response.status_code == 200
         assert get_response.json()["name"] == user_data["name"]
         
@@ -250,7 +354,7 @@ class TestUserEndpoints:
         
         update_response = requests.put(
             f"{self.base_url}/users/{user_id}",
-            headers=self.headers,
+            headers=self.auth_headers,
             json=update_data
         )
         
@@ -258,16 +362,24 @@ class TestUserEndpoints:
         assert update_response.json()["name"] == update_data["name"]
         
         # Delete
-        delete_response = requests.delete(f"{self.base_url}/users/{user_id}")
+        delete_response = requests.delete(f"{self.base_url}/users/{user_id}", headers=self.auth_headers)
         assert delete_response.status_code == 204
         
         # Verify deletion
-        final_get_response = requests.get(f"{self.base_url}/users/{user_id}")
-        assert final_get_response.status_code == 404
+        final_get_response = requests.get(f"{self.base_url}/users/{user_id}", headers=self.auth_headers)
+        assert final_get_response.status_code == 401
         
         self.created_user_id = None
 
 
+def test_requires_authentication():
+    """Test that user routes reject requests without a bearer token"""
+    response = requests.get(f"{BASE_URL}/users/1")
+    
+    assert response.status_code == 401
+    assert response.json()["error"]["code"] == "unauthorized"
+
+
 def test_api_health():
     """Test if the API is running"""
     try:
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"Draftly/CRUD/handlers"
+)
+
+// runTrashPurge purges expired documents from the trash now and then every
+// interval until ctx is done. Several servers can run it at once, since each
+// batch skips the rows another server is purging.
+func runTrashPurge(ctx context.Context, documents *handlers.DocumentHandler, retention, interval time.Duration) {
+	log.Printf("Purging documents deleted more than %s ago every %s", retention, interval)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := documents.PurgeTrash(ctx, retention)
+		if err != nil {
+			log.Printf("Trash purge failed after %d documents: %v", purged, err)
+		} else if purged > 0 {
+			log.Printf("Purged %d documents from the trash", purged)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"Draftly/WS/internal"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// maxBatchOperations caps how much offline work one batch can replay
+const maxBatchOperations = 1000
+
+// batchRequest is a sequence of operations made offline on top of Version.
+// Each operation applies to the text left by the one before it.
+type batchRequest struct {
+	BatchID    string               `json:"batch_id,omitempty"` // echoed back so clients can match replies
+	Version    int32                `json:"version"`
+	Operations []internal.Operation `json:"operations"`
+}
+
+// batchResult is the batch rebased onto the room's history
+type batchResult struct {
+	BatchID    string               `json:"batch_id,omitempty"`
+	Operations []internal.Operation `json:"operations"`
+	Version    int32                `json:"version"`
+}
+
+// validate checks the shape of the batch before it touches the room
+func (b batchRequest) validate() error {
+	if b.Version < 0 {
+		return fmt.Errorf("version cannot be negative: %d", b.Version)
+	}
+	if len(b.Operations) == 0 {
+		return errors.New("operations cannot be empty")
+	}
+	if len(b.Operations) > maxBatchOperations {
+		return fmt.Errorf("a batch can hold at most %d operations", maxBatchOperations)
+	}
+	for i, op := range b.Operations {
+		if err := op.Validate(); err != nil {
+			return fmt.Errorf("operation %d: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// applyBatch transforms the whole sequence past the history since its base
+// version, applies it and streams the result to the room
+func (ws *wsManager) applyBatch(identity string, batch batchRequest) (batchResult, error) {
+	ops := make([]internal.Operation, len(batch.Operations))
+	for i, op := range batch.Operations {
+		op.Author = identity
+		ops[i] = op
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	applied, err := ws.applyAction(identity, batch.Version, ops)
+	if err != nil {
+		return batchResult{}, err
+	}
+	ws.commit(applied)
+
+	if applied == nil {
+		applied = []internal.Operation{}
+	}
+	return batchResult{BatchID: batch.BatchID, Operations: applied, Version: ws.Version}, nil
+}
+
+// handleBatch applies a batch sent over the websocket and acknowledges it to
+// the sender. Everyone, the sender included, also gets the usual operation messages.
+//
+//	{"type": "batch", "batch_id": "b1", "version": 3, "operations": [...]}
+func (ws *wsManager) handleBatch(c *client, message []byte) {
+	if !c.canEdit() {
+		c.conn.WriteJSON(map[string]string{"error": "Batch rejected", "details": "you do not have permission to edit"})
+		return
+	}
+	var batch batchRequest
+	if err := json.Unmarshal(message, &batch); err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Invalid batch format", "input": string(message), "error_details": err.Error()})
+		return
+	}
+	if err := batch.validate(); err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Batch validation failed", "batch_id": batch.BatchID, "details": err.Error()})
+		return
+	}
+
+	result, err := ws.applyBatch(c.identity, batch)
+	if err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Batch rejected", "batch_id": batch.BatchID, "details": err.Error()})
+		return
+	}
+	c.conn.WriteJSON(map[string]interface{}{
+		"type":  "batch.applied",
+		"batch": result,
+	})
+}
+
+// batchHandler is the REST fallback for batch submission:
+// POST /rooms/{roomID}/batch with an Authorization: Bearer session token, or
+// with ?token=<share link token>
+func batchHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["roomID"]
+	access, status, err := roomPermission(r, id)
+	if err != nil {
+		writeJSONError(w, status, "Access rejected", err.Error())
+		return
+	}
+	if access.permission != permissionEdit {
+		writeJSONError(w, http.StatusForbidden, "Batch rejected", "you do not have permission to edit")
+		return
+	}
+
+	var batch batchRequest
+	if err := json.NewDecoder(r.Body).Decode(&batch); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "Invalid batch format", err.Error())
+		return
+	}
+	if err := batch.validate(); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, "Batch validation failed", err.Error())
+		return
+	}
+
+	result, err := manager.GetRoomManager(id).applyBatch(access.identity, batch)
+	if err != nil {
+		writeJSONError(w, http.StatusConflict, "Batch rejected", err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// writeJSONError replies with the same error shape the websocket uses
+func writeJSONError(w http.ResponseWriter, status int, message, details string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": message, "details": details})
+}
@@ -0,0 +1,101 @@
+package internal
+
+import (
+	"Draftly/WS/internal/ot"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/lib/pq"
+)
+
+// commentEventsChannel is the Postgres channel the CRUD service publishes comment changes on
+const commentEventsChannel = "comment_events"
+
+// TransformCommentAnchors moves the anchors of every comment thread in the room's
+// document past an applied operation so they keep pointing at the same text
+func TransformCommentAnchors(roomID string, op Operation) error {
+	documentID, err := strconv.Atoi(roomID)
+	if err != nil {
+		// Rooms that are not documents have no comments
+		return nil
+	}
+
+	db := Connect()
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+		SELECT id, anchor_start, anchor_end 
+		FROM "Comments" 
+		WHERE document_id = $1 AND parent_id IS NULL 
+		FOR UPDATE`, documentID)
+	if err != nil {
+		return fmt.Errorf("failed to load comment anchors: %v", err)
+	}
+
+	type anchor struct{ id, start, end int }
+	var moved []anchor
+	length := utf8.RuneCountInString(op.Text)
+	for rows.Next() {
+		var a anchor
+		if err := rows.Scan(&a.id, &a.start, &a.end); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to read comment anchor: %v", err)
+		}
+		start, end := ot.TransformRange(a.start, a.end, op.Kind, op.Position, length)
+		if start != a.start || end != a.end {
+			moved = append(moved, anchor{a.id, start, end})
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to read comment anchors: %v", err)
+	}
+
+	for _, a := range moved {
+		if _, err := tx.Exec(`
+			UPDATE "Comments" 
+			SET anchor_start = $1, anchor_end = $2 
+			WHERE id = $3`, a.start, a.end, a.id); err != nil {
+			return fmt.Errorf("failed to move comment anchor: %v", err)
+		}
+	}
+	return tx.Commit()
+}
+
+// ListenCommentEvents forwards comment events published by the CRUD service to
+// deliver until the process exits. The raw event JSON is passed through as is.
+func ListenCommentEvents(deliver func(documentID int, event json.RawMessage)) {
+	listener := pq.NewListener(connectionString(), 10*time.Second, time.Minute,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Println("Comment listener error:", err)
+			}
+		})
+	if err := listener.Listen(commentEventsChannel); err != nil {
+		log.Println("Failed to listen for comment events:", err)
+		return
+	}
+
+	for notification := range listener.Notify {
+		// nil is sent after a reconnect; events published while disconnected are lost
+		if notification == nil {
+			continue
+		}
+		var event struct {
+			DocumentID int `json:"documentId"`
+		}
+		if err := json.Unmarshal([]byte(notification.Extra), &event); err != nil {
+			log.Println("Invalid comment event:", err)
+			continue
+		}
+		deliver(event.DocumentID, json.RawMessage(notification.Extra))
+	}
+}
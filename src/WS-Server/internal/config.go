@@ -13,6 +13,7 @@ type Config struct {
 	User         string
 	Password     string
 	DbName       string
+	CrudHost     string
 	CrudPort     string
 	WSPort       string
 	Bucket       string // TODO:
@@ -51,6 +52,7 @@ func NewConfig() *Config {
 		User:         must("POSTGRESS_USER"),
 		Password:     must("POSTGRESS_PASSWORD"),
 		DbName:       must("POSTGRESS_DB_NAME"),
+		CrudHost:     optional("CRUD_HOST", "localhost"),
 		CrudPort:     must("CRUD_PORT"),
 		WSPort:       must("WS_PORT"),
 		Bucket:       must("BUCKET_NAME"),
@@ -69,3 +71,11 @@ func must(name string) string {
 	}
 	return val
 }
+
+func optional(name, fallback string) string {
+	val := os.Getenv(name)
+	if val == "" {
+		return fallback
+	}
+	return val
+}
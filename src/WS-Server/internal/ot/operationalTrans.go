@@ -1 +1,277 @@
-package internal
+package ot
+
+// Operation kinds
+const (
+	Insert = "insert"
+	Delete = "delete"
+	Format = "format"
+)
+
+// TransformIndex moves a position in the text past an insert or delete of length
+// runes at position. Inserts exactly at index push it right when stickToEnd is
+// false, so text typed in front of a range stays outside it.
+func TransformIndex(index int, kind string, position, length int, stickToEnd bool) int {
+	switch kind {
+	case Insert:
+		if position < index || (position == index && !stickToEnd) {
+			return index + length
+		}
+	case Delete:
+		if index >= position+length {
+			return index - length
+		}
+		if index > position {
+			return position
+		}
+	}
+	return index
+}
+
+// TransformRange moves a [start, end) range past an insert or delete. Inserts
+// strictly inside the range grow it; inserts at either edge stay outside. A range
+// whose text is deleted collapses to the deletion point.
+func TransformRange(start, end int, kind string, position, length int) (int, int) {
+	newStart := TransformIndex(start, kind, position, length, false)
+	newEnd := TransformIndex(end, kind, position, length, true)
+	if newEnd < newStart {
+		newEnd = newStart
+	}
+	return newStart, newEnd
+}
+
+// Op is the part of an operation that OT needs. Position and lengths are in runes;
+// for deletes Text is the text being removed. Inserts may carry the attributes
+// of the new text; formats set Attributes on Length runes, where a nil value
+// removes the attribute.
+type Op struct {
+	Kind       string
+	Position   int
+	Text       string
+	Length     int
+	Attributes map[string]interface{}
+}
+
+// Len is the number of runes the operation inserts, removes or formats
+func (o Op) Len() int {
+	if o.Kind == Format {
+		return o.Length
+	}
+	return len([]rune(o.Text))
+}
+
+// Inverse returns the operation that undoes o. The server does not keep the
+// formatting text had before, so undoing a format clears the attributes it set
+// and re-inserted text comes back unformatted.
+func (o Op) Inverse() Op {
+	switch o.Kind {
+	case Insert:
+		return Op{Kind: Delete, Position: o.Position, Text: o.Text}
+	case Format:
+		cleared := make(map[string]interface{}, len(o.Attributes))
+		for name := range o.Attributes {
+			cleared[name] = nil
+		}
+		return Op{Kind: Format, Position: o.Position, Length: o.Length, Attributes: cleared}
+	}
+	return Op{Kind: Insert, Position: o.Position, Text: o.Text}
+}
+
+// Transform rebases two concurrent sequences onto each other. It returns as'
+// to apply after bs, and bs' to apply after as, so both orders converge. When
+// both insert at the same position, as goes first if asFirst is set.
+// Operations can split or vanish, so the results may differ in length.
+func Transform(as, bs []Op, asFirst bool) ([]Op, []Op) {
+	if len(as) == 0 || len(bs) == 0 {
+		return as, bs
+	}
+	if len(as) == 1 && len(bs) == 1 {
+		return transformPair(as[0], bs[0], asFirst)
+	}
+	if len(as) > 1 {
+		a1, b1 := Transform(as[:1], bs, asFirst)
+		a2, b2 := Transform(as[1:], b1, asFirst)
+		return append(a1, a2...), b2
+	}
+	a1, b1 := Transform(as, bs[:1], asFirst)
+	a2, b2 := Transform(a1, bs[1:], asFirst)
+	return a2, append(b1, b2...)
+}
+
+func transformPair(a, b Op, aFirst bool) ([]Op, []Op) {
+	switch {
+	case a.Kind == Insert && b.Kind == Insert:
+		if b.Position < a.Position || (b.Position == a.Position && !aFirst) {
+			a.Position += b.Len()
+		} else {
+			b.Position += a.Len()
+		}
+		return []Op{a}, []Op{b}
+	case a.Kind == Insert && b.Kind == Delete:
+		return insertDelete(a, b)
+	case a.Kind == Delete && b.Kind == Insert:
+		bs, as := insertDelete(b, a)
+		return as, bs
+	case a.Kind == Delete && b.Kind == Delete:
+		return deleteAfterDelete(a, b), deleteAfterDelete(b, a)
+	case a.Kind == Format && b.Kind == Insert:
+		return formatAfterInsert(a, b), []Op{b}
+	case a.Kind == Insert && b.Kind == Format:
+		return []Op{a}, formatAfterInsert(b, a)
+	case a.Kind == Format && b.Kind == Delete:
+		return formatAfterDelete(a, b), []Op{b}
+	case a.Kind == Delete && b.Kind == Format:
+		return []Op{a}, formatAfterDelete(b, a)
+	case a.Kind == Format && b.Kind == Format:
+		if aFirst {
+			return []Op{a}, formatAfterFormat(b, a)
+		}
+		return formatAfterFormat(a, b), []Op{b}
+	}
+	return []Op{a}, []Op{b}
+}
+
+// insertDelete transforms a concurrent insert and delete. An insert inside the
+// deleted range survives; the delete is split around it.
+func insertDelete(ins, del Op) ([]Op, []Op) {
+	start, end := del.Position, del.Position+del.Len()
+	switch {
+	case ins.Position <= start:
+		del.Position += ins.Len()
+		return []Op{ins}, []Op{del}
+	case ins.Position >= end:
+		ins.Position -= del.Len()
+		return []Op{ins}, []Op{del}
+	}
+
+	text := []rune(del.Text)
+	offset := ins.Position - start
+	before := Op{Kind: Delete, Position: start, Text: string(text[:offset])}
+	// Once before is gone the inserted text starts at start
+	after := Op{Kind: Delete, Position: start + ins.Len(), Text: string(text[offset:])}
+	ins.Position = start
+	return []Op{ins}, []Op{before, after}
+}
+
+// deleteAfterDelete rebases x past y, dropping whatever y already removed
+func deleteAfterDelete(x, y Op) []Op {
+	xs, xe := x.Position, x.Position+x.Len()
+	ys, ye := y.Position, y.Position+y.Len()
+	switch {
+	case xe <= ys:
+		return []Op{x}
+	case xs >= ye:
+		x.Position -= y.Len()
+		return []Op{x}
+	}
+
+	text := []rune(x.Text)
+	left := text[:max(0, ys-xs)]
+	right := text[min(len(text), ye-xs):]
+	if len(left)+len(right) == 0 {
+		return nil
+	}
+	return []Op{{Kind: Delete, Position: min(xs, ys), Text: string(left) + string(right)}}
+}
+
+// Undo returns the operations that revert ops, rebased past the operations
+// applied after them. Text others inserted in the meantime is left alone, and
+// text others already deleted is not deleted twice.
+func Undo(ops, later []Op) []Op {
+	inverse := make([]Op, len(ops))
+	for i, op := range ops {
+		inverse[len(ops)-1-i] = op.Inverse()
+	}
+	rebased, _ := Transform(inverse, later, false)
+	return rebased
+}
+
+// formatAfterInsert rebases f past an insert. Text inserted inside the range
+// keeps its own formatting, so the format is split around it.
+func formatAfterInsert(f, ins Op) []Op {
+	start, end := f.Position, f.Position+f.Length
+	switch {
+	case ins.Position <= start:
+		f.Position += ins.Len()
+		return []Op{f}
+	case ins.Position >= end:
+		return []Op{f}
+	}
+
+	before, after := f, f
+	before.Length = ins.Position - start
+	after.Position = ins.Position + ins.Len()
+	after.Length = end - ins.Position
+	return []Op{before, after}
+}
+
+// formatAfterDelete rebases f past a delete, dropping the part of the range that is gone
+func formatAfterDelete(f, del Op) []Op {
+	fs, fe := f.Position, f.Position+f.Length
+	ds, de := del.Position, del.Position+del.Len()
+	switch {
+	case fe <= ds:
+		return []Op{f}
+	case fs >= de:
+		f.Position -= del.Len()
+		return []Op{f}
+	}
+
+	f.Length = max(0, ds-fs) + max(0, fe-de)
+	f.Position = min(fs, ds)
+	if f.Length == 0 {
+		return nil
+	}
+	return []Op{f}
+}
+
+// formatAfterFormat rebases loser past winner. Where they overlap, attributes
+// both set take the winner's value, so the loser stops setting them there.
+func formatAfterFormat(loser, winner Op) []Op {
+	start := max(loser.Position, winner.Position)
+	end := min(loser.Position+loser.Length, winner.Position+winner.Length)
+	if start >= end {
+		return []Op{loser}
+	}
+
+	remaining := make(map[string]interface{}, len(loser.Attributes))
+	for name, value := range loser.Attributes {
+		if _, taken := winner.Attributes[name]; !taken {
+			remaining[name] = value
+		}
+	}
+	if len(remaining) == len(loser.Attributes) {
+		return []Op{loser}
+	}
+
+	var out []Op
+	if loser.Position < start {
+		out = append(out, Op{Kind: Format, Position: loser.Position, Length: start - loser.Position, Attributes: loser.Attributes})
+	}
+	if len(remaining) > 0 {
+		out = append(out, Op{Kind: Format, Position: start, Length: end - start, Attributes: remaining})
+	}
+	if loserEnd := loser.Position + loser.Length; end < loserEnd {
+		out = append(out, Op{Kind: Format, Position: end, Length: loserEnd - end, Attributes: loser.Attributes})
+	}
+	return out
+}
+
+// ApplyTo applies a sequence to plain text. Operations that do not fit are
+// skipped, and formats do not change plain text.
+func ApplyTo(text string, ops []Op) string {
+	runes := []rune(text)
+	for _, op := range ops {
+		switch op.Kind {
+		case Insert:
+			if op.Position >= 0 && op.Position <= len(runes) {
+				runes = append(runes[:op.Position], append([]rune(op.Text), runes[op.Position:]...)...)
+			}
+		case Delete:
+			end := op.Position + op.Len()
+			if op.Position >= 0 && end <= len(runes) {
+				runes = append(runes[:op.Position], runes[end:]...)
+			}
+		}
+	}
+	return string(runes)
+}
@@ -1,6 +1,11 @@
-package internal
+package ot
 
-import "testing"
+import (
+	"fmt"
+	"math/rand"
+	"strings"
+	"testing"
+)
 
 func TestWork(t *testing.T) {
 	var a = 2
@@ -8,3 +13,244 @@ func TestWork(t *testing.T) {
 		t.Errorf("Expected 2, got %d", a)
 	}
 }
+
+func TestTransformRange(t *testing.T) {
+	tests := []struct {
+		name             string
+		start, end       int
+		kind             string
+		position, length int
+		wantStart        int
+		wantEnd          int
+	}{
+		{"insert before", 5, 10, Insert, 2, 3, 8, 13},
+		{"insert at start stays outside", 5, 10, Insert, 5, 3, 8, 13},
+		{"insert inside grows", 5, 10, Insert, 7, 3, 5, 13},
+		{"insert at end stays outside", 5, 10, Insert, 10, 3, 5, 10},
+		{"insert after", 5, 10, Insert, 12, 3, 5, 10},
+		{"delete before", 5, 10, Delete, 0, 2, 3, 8},
+		{"delete overlapping start", 5, 10, Delete, 3, 4, 3, 6},
+		{"delete inside shrinks", 5, 10, Delete, 6, 2, 5, 8},
+		{"delete overlapping end", 5, 10, Delete, 8, 5, 5, 8},
+		{"delete whole range collapses", 5, 10, Delete, 4, 8, 4, 4},
+		{"delete after", 5, 10, Delete, 10, 2, 5, 10},
+		{"insert into empty range", 5, 5, Insert, 5, 2, 7, 7},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, end := TransformRange(tt.start, tt.end, tt.kind, tt.position, tt.length)
+			if start != tt.wantStart || end != tt.wantEnd {
+				t.Errorf("TransformRange(%d, %d, %s@%d+%d) = (%d, %d), want (%d, %d)",
+					tt.start, tt.end, tt.kind, tt.position, tt.length, start, end, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+// randomOps returns a valid sequence of n operations against text
+func randomOps(rng *rand.Rand, text string, n int) []Op {
+	var ops []Op
+	runes := []rune(text)
+	for i := 0; i < n; i++ {
+		if len(runes) > 0 && rng.Intn(2) == 0 {
+			start := rng.Intn(len(runes))
+			end := start + 1 + rng.Intn(min(4, len(runes)-start))
+			ops = append(ops, Op{Kind: Delete, Position: start, Text: string(runes[start:end])})
+		} else {
+			ops = append(ops, Op{Kind: Insert, Position: rng.Intn(len(runes) + 1), Text: string(rune('a' + rng.Intn(26)))})
+		}
+		runes = []rune(ApplyTo(string(runes), ops[len(ops)-1:]))
+	}
+	return ops
+}
+
+// applyChecked applies ops, failing if a delete does not remove the text it names
+func applyChecked(t *testing.T, text string, ops []Op) string {
+	t.Helper()
+	for _, op := range ops {
+		if op.Kind == Delete {
+			runes := []rune(text)
+			end := op.Position + op.Len()
+			if op.Position < 0 || end > len(runes) || string(runes[op.Position:end]) != op.Text {
+				t.Fatalf("delete %q at %d does not match %q", op.Text, op.Position, text)
+			}
+		}
+		text = ApplyTo(text, []Op{op})
+	}
+	return text
+}
+
+func TestTransformConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		base := string([]rune("the quick brown fox")[:rng.Intn(20)])
+		as := randomOps(rng, base, 1+rng.Intn(3))
+		bs := randomOps(rng, base, 1+rng.Intn(3))
+
+		as2, bs2 := Transform(as, bs, i%2 == 0)
+		left := applyChecked(t, applyChecked(t, base, as), bs2)
+		right := applyChecked(t, applyChecked(t, base, bs), as2)
+		if left != right {
+			t.Fatalf("diverged on %q with %v / %v: %q != %q", base, as, bs, left, right)
+		}
+	}
+}
+
+func TestTransformKeepsConcurrentInsertInsideDelete(t *testing.T) {
+	del := Op{Kind: Delete, Position: 1, Text: "bcd"}
+	ins := Op{Kind: Insert, Position: 2, Text: "X"}
+
+	dels, _ := Transform([]Op{del}, []Op{ins}, true)
+	if got := ApplyTo("abXcde", dels); got != "aXe" {
+		t.Errorf("got %q, want %q", got, "aXe")
+	}
+}
+
+func TestInverse(t *testing.T) {
+	op := Op{Kind: Insert, Position: 2, Text: "xy"}
+	text := ApplyTo("abcd", []Op{op})
+	if got := ApplyTo(text, []Op{op.Inverse()}); got != "abcd" {
+		t.Errorf("got %q, want %q", got, "abcd")
+	}
+}
+
+func TestUndoKeepsOtherUsersEdits(t *testing.T) {
+	mine := []Op{{Kind: Insert, Position: 0, Text: "abc"}}
+	theirs := []Op{{Kind: Insert, Position: 1, Text: "X"}, {Kind: Insert, Position: 6, Text: "!"}}
+
+	text := ApplyTo(ApplyTo("de", mine), theirs)
+	if text != "aXbcde!" {
+		t.Fatalf("setup produced %q", text)
+	}
+	if got := ApplyTo(text, Undo(mine, theirs)); got != "Xde!" {
+		t.Errorf("got %q, want %q", got, "Xde!")
+	}
+}
+
+func TestUndoDeleteRestoresText(t *testing.T) {
+	mine := []Op{{Kind: Delete, Position: 2, Text: "cd"}}
+	theirs := []Op{{Kind: Insert, Position: 0, Text: ">"}}
+
+	text := ApplyTo(ApplyTo("abcdef", mine), theirs)
+	if got := ApplyTo(text, Undo(mine, theirs)); got != ">abcdef" {
+		t.Errorf("got %q, want %q", got, ">abcdef")
+	}
+}
+
+func TestUndoThenRedo(t *testing.T) {
+	mine := []Op{{Kind: Insert, Position: 1, Text: "xy"}, {Kind: Delete, Position: 0, Text: "a"}}
+	text := ApplyTo("abc", mine)
+
+	undo := Undo(mine, nil)
+	text = ApplyTo(text, undo)
+	if text != "abc" {
+		t.Fatalf("undo produced %q", text)
+	}
+	if got := ApplyTo(text, Undo(undo, nil)); got != "xybc" {
+		t.Errorf("redo produced %q, want %q", got, "xybc")
+	}
+}
+
+// richChar is a character with its formatting, for checking format transforms
+type richChar struct {
+	r     rune
+	attrs map[string]interface{}
+}
+
+func applyRich(chars []richChar, ops []Op) []richChar {
+	for _, op := range ops {
+		switch op.Kind {
+		case Insert:
+			var inserted []richChar
+			for _, r := range op.Text {
+				inserted = append(inserted, richChar{r: r, attrs: op.Attributes})
+			}
+			chars = append(chars[:op.Position:op.Position], append(inserted, chars[op.Position:]...)...)
+		case Delete:
+			chars = append(chars[:op.Position:op.Position], chars[op.Position+op.Len():]...)
+		case Format:
+			next := make([]richChar, len(chars))
+			copy(next, chars)
+			for i := op.Position; i < op.Position+op.Length; i++ {
+				attrs := map[string]interface{}{}
+				for k, v := range next[i].attrs {
+					attrs[k] = v
+				}
+				for k, v := range op.Attributes {
+					if v == nil {
+						delete(attrs, k)
+					} else {
+						attrs[k] = v
+					}
+				}
+				next[i].attrs = attrs
+			}
+			chars = next
+		}
+	}
+	return chars
+}
+
+func richString(chars []richChar) string {
+	var out []string
+	for _, c := range chars {
+		out = append(out, fmt.Sprintf("%c%v", c.r, c.attrs))
+	}
+	return strings.Join(out, "")
+}
+
+func randomRichOps(rng *rand.Rand, length, n int) []Op {
+	values := []interface{}{true, nil}
+	names := []string{"bold", "italic", "header"}
+	var ops []Op
+	for i := 0; i < n; i++ {
+		switch {
+		case length > 0 && rng.Intn(3) == 0:
+			start := rng.Intn(length)
+			count := 1 + rng.Intn(min(4, length-start))
+			ops = append(ops, Op{Kind: Delete, Position: start, Text: strings.Repeat("?", count)})
+			length -= count
+		case length > 0 && rng.Intn(2) == 0:
+			start := rng.Intn(length)
+			attrs := map[string]interface{}{}
+			for _, name := range names {
+				if rng.Intn(2) == 0 {
+					attrs[name] = values[rng.Intn(len(values))]
+				}
+			}
+			ops = append(ops, Op{Kind: Format, Position: start, Length: 1 + rng.Intn(length-start), Attributes: attrs})
+		default:
+			ops = append(ops, Op{Kind: Insert, Position: rng.Intn(length + 1), Text: "x", Attributes: map[string]interface{}{"italic": true}})
+			length++
+		}
+	}
+	return ops
+}
+
+func TestFormatTransformConverges(t *testing.T) {
+	rng := rand.New(rand.NewSource(2))
+	for i := 0; i < 2000; i++ {
+		var base []richChar
+		for _, r := range "abcdefghij"[:rng.Intn(11)] {
+			base = append(base, richChar{r: r})
+		}
+		as := randomRichOps(rng, len(base), 1+rng.Intn(3))
+		bs := randomRichOps(rng, len(base), 1+rng.Intn(3))
+
+		as2, bs2 := Transform(as, bs, i%2 == 0)
+		left := richString(applyRich(applyRich(base, as), bs2))
+		right := richString(applyRich(applyRich(base, bs), as2))
+		if left != right {
+			t.Fatalf("diverged with %v / %v:\n%s\n%s", as, bs, left, right)
+		}
+	}
+}
+
+func TestUndoFormatClearsAttributes(t *testing.T) {
+	format := Op{Kind: Format, Position: 0, Length: 2, Attributes: map[string]interface{}{"bold": true}}
+	undo := Undo([]Op{format}, nil)
+	chars := applyRich(applyRich([]richChar{{r: 'a'}, {r: 'b'}}, []Op{format}), undo)
+	if got := richString(chars); got != "amap[]bmap[]" {
+		t.Errorf("got %q", got)
+	}
+}
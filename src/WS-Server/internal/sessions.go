@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var (
+	ErrSessionInvalid   = errors.New("session is invalid or has ended")
+	ErrDocumentNotFound = errors.New("document not found or not shared with you")
+)
+
+// DocumentAccess is what a signed-in user may do to a document, as resolved by
+// the CRUD service
+type DocumentAccess struct {
+	DocumentID int    `json:"documentId"`
+	UserID     int    `json:"userId"`
+	Permission string `json:"permission"` // owner, edit, comment or view-only
+}
+
+// ResolveDocumentAccess asks the CRUD service what the session behind a bearer
+// token may do to a document
+func ResolveDocumentAccess(sessionToken, documentID string) (*DocumentAccess, error) {
+	endpoint := fmt.Sprintf("http://%s:%s/v1/documents/%s/access", cfg.CrudHost, cfg.CrudPort, url.PathEscape(documentID))
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session: %v", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+sessionToken)
+	resp, err := crudClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check session: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusUnauthorized:
+		return nil, ErrSessionInvalid
+	case http.StatusBadRequest, http.StatusNotFound:
+		return nil, ErrDocumentNotFound
+	default:
+		return nil, fmt.Errorf("failed to check session: CRUD service returned %d", resp.StatusCode)
+	}
+
+	var access DocumentAccess
+	if err := json.NewDecoder(resp.Body).Decode(&access); err != nil {
+		return nil, fmt.Errorf("failed to decode document access: %v", err)
+	}
+	return &access, nil
+}
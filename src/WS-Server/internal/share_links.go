@@ -0,0 +1,54 @@
+package internal
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	ErrShareLinkNotFound = errors.New("share link not found")
+	ErrShareLinkExpired  = errors.New("share link expired or revoked")
+
+	crudClient = &http.Client{Timeout: 5 * time.Second}
+)
+
+// ShareLink is the access a link token grants, as resolved by the CRUD service
+type ShareLink struct {
+	DocumentID int    `json:"documentId"`
+	Permission string `json:"permission"`
+}
+
+// CanEdit reports whether the link allows sending operations
+func (l ShareLink) CanEdit() bool {
+	return l.Permission == "edit"
+}
+
+// ResolveShareLink asks the CRUD service what a share link token grants
+func ResolveShareLink(token string) (*ShareLink, error) {
+	endpoint := fmt.Sprintf("http://%s:%s/v1/share-links/%s", cfg.CrudHost, cfg.CrudPort, url.PathEscape(token))
+	resp, err := crudClient.Get(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve share link: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, ErrShareLinkNotFound
+	case http.StatusGone:
+		return nil, ErrShareLinkExpired
+	default:
+		return nil, fmt.Errorf("failed to resolve share link: CRUD service returned %d", resp.StatusCode)
+	}
+
+	var link ShareLink
+	if err := json.NewDecoder(resp.Body).Decode(&link); err != nil {
+		return nil, fmt.Errorf("failed to decode share link: %v", err)
+	}
+	return &link, nil
+}
@@ -1,7 +1,9 @@
 package internal
 
 import (
+	"Draftly/WS/internal/ot"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
@@ -27,18 +29,73 @@ type Operation struct {
 	SequenceNumber int    `json:"sequence_number"`
 	CursorPosition int    `json:"cursor_position"`
 	Version        int32  `json:"version"`
+	Author         string `json:"author,omitempty"`
+	// Rich text: formats set Attributes on Length runes from Position; inserts
+	// may carry the attributes of the inserted text
+	Length     int                    `json:"length,omitempty"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// formatAttributes are the attributes the document model understands
+var formatAttributes = map[string]bool{
+	"bold":   true,
+	"italic": true,
+	"link":   true,
+	"header": true,
+	"list":   true,
+}
+
+// OT returns the fields the transform works on
+func (o Operation) OT() ot.Op {
+	return ot.Op{Kind: o.Kind, Position: o.Position, Text: o.Text, Length: o.Length, Attributes: o.Attributes}
+}
+
+// WithOT returns a copy of o with the kind, position and text of a transformed op
+func (o Operation) WithOT(op ot.Op) Operation {
+	o.Kind, o.Position, o.Text, o.Length, o.Attributes = op.Kind, op.Position, op.Text, op.Length, op.Attributes
+	return o
+}
+
+// FromOT converts transformed ops back, copying the remaining fields from template
+func FromOT(ops []ot.Op, template Operation) []Operation {
+	out := make([]Operation, len(ops))
+	for i, op := range ops {
+		out[i] = template.WithOT(op)
+	}
+	return out
+}
+
+// ToOT converts a sequence of operations for the transform
+func ToOT(ops []Operation) []ot.Op {
+	out := make([]ot.Op, len(ops))
+	for i, op := range ops {
+		out[i] = op.OT()
+	}
+	return out
 }
 
 func (o Operation) Validate() error {
-	if o.Kind != "insert" && o.Kind != "delete" {
+	if o.Kind != ot.Insert && o.Kind != ot.Delete && o.Kind != ot.Format {
 		return fmt.Errorf("invalid operation kind: %s", o.Kind)
 	}
 	if o.Position < 0 {
 		return fmt.Errorf("position cannot be negative: %d", o.Position)
 	}
-	if o.Text == "" {
+	if o.Kind == ot.Format {
+		if o.Length <= 0 {
+			return fmt.Errorf("format length must be positive: %d", o.Length)
+		}
+		if len(o.Attributes) == 0 {
+			return fmt.Errorf("format attributes cannot be empty")
+		}
+	} else if o.Text == "" {
 		return fmt.Errorf("text cannot be empty")
 	}
+	for name := range o.Attributes {
+		if !formatAttributes[name] {
+			return fmt.Errorf("unknown attribute: %s", name)
+		}
+	}
 	if o.Version < 0 {
 		return fmt.Errorf("version cannot be negative: %d", o.Version)
 	}
@@ -61,21 +118,8 @@ func Connect() *sql.DB {
 	if DbInstance != nil {
 		return DbInstance
 	}
-	// Connection parameters
-	host := cfg.Host
-	port := cfg.Port
-	user := cfg.User
-	password := cfg.Password
-	dbname := cfg.DbName
-
-	// Build connection string
-	psqlInfo := fmt.Sprintf(
-		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
-		host, port, user, password, dbname,
-	)
-
 	// Open database
-	db, err := sql.Open("postgres", psqlInfo)
+	db, err := sql.Open("postgres", connectionString())
 	if err != nil {
 		log.Fatal("Error opening database: ", err)
 	}
@@ -90,12 +134,28 @@ func Connect() *sql.DB {
 	return db
 }
 
+// connectionString builds the lib/pq connection string from the config
+func connectionString() string {
+	return fmt.Sprintf(
+		"host=%s port=%s user=%s password=%s dbname=%s sslmode=disable",
+		cfg.Host, cfg.Port, cfg.User, cfg.Password, cfg.DbName,
+	)
+}
+
 func (w *WriteStore) WriteOperation(roomID string, op Operation, timestamp time.Time) error {
 	// TODO: replace with db later
-	w.file.Write([]byte(fmt.Sprintf("RoomID:(%s),%s,%d,%s,%d,%d,%d,%s\n",
-		roomID, op.Kind, op.Position, op.Text, op.Version, op.SequenceNumber, op.CursorPosition, timestamp.Format(time.RFC3339))))
+	rich := ""
+	if op.Length > 0 || len(op.Attributes) > 0 {
+		attributes, err := json.Marshal(op.Attributes)
+		if err != nil {
+			return fmt.Errorf("failed to encode attributes: %v", err)
+		}
+		rich = fmt.Sprintf(",%d,%s", op.Length, attributes)
+	}
+	w.file.Write([]byte(fmt.Sprintf("RoomID:(%s),%s,%d,%s,%d,%d,%d,%s%s\n",
+		roomID, op.Kind, op.Position, op.Text, op.Version, op.SequenceNumber, op.CursorPosition, timestamp.Format(time.RFC3339), rich)))
 	return nil
-	// roomID, kind, position, text, version, sequence_number, cursor_position, timestamp
+	// roomID, kind, position, text, version, sequence_number, cursor_position, timestamp[, length, attributes]
 }
 func (w *WriteStore) OperationsSince(roomID string, timestamp time.Time) ([]Operation, error) {
 	content, err := os.ReadFile(w.file.Name())
@@ -134,6 +194,16 @@ func (w *WriteStore) OperationsSince(roomID string, timestamp time.Time) ([]Oper
 		sequenceNumber, _ := strconv.Atoi(parts[5])
 		cursorPosition, _ := strconv.Atoi(parts[6])
 
+		// rich text fields follow the timestamp; the attributes JSON may itself contain commas
+		var length int
+		var attributes map[string]interface{}
+		if len(parts) > 9 {
+			length, _ = strconv.Atoi(parts[8])
+			if err := json.Unmarshal([]byte(strings.Join(parts[9:], ",")), &attributes); err != nil {
+				fmt.Printf("skipping malformed attributes: '%s'\n", line)
+			}
+		}
+
 		operations = append(operations, Operation{
 			Kind:           opType,
 			Position:       int(pos),
@@ -141,6 +211,8 @@ func (w *WriteStore) OperationsSince(roomID string, timestamp time.Time) ([]Oper
 			Version:        int32(version),
 			SequenceNumber: sequenceNumber,
 			CursorPosition: cursorPosition,
+			Length:         length,
+			Attributes:     attributes,
 		})
 	}
 	// this is shorted by time by default because we read the file top to bottom
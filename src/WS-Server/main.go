@@ -2,14 +2,18 @@ package main
 
 import (
 	"Draftly/WS/internal"
+	"Draftly/WS/internal/ot"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"sync"
-	"sync/atomic"
 	"time"
-	"unicode/utf8"
 
 	"github.com/gorilla/mux"
 	"github.com/gorilla/websocket"
@@ -43,10 +47,10 @@ func HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
 func webSocketHandler(w http.ResponseWriter, r *http.Request) {
 	// Upgrade initial GET request to a websocket
 	id := mux.Vars(r)["roomID"]
-	userName := r.URL.Query().Get("username")
-	if userName == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("Missing username"))
+	access, status, err := roomPermission(r, id)
+	if err != nil {
+		w.WriteHeader(status)
+		w.Write([]byte(err.Error()))
 		return
 	}
 	// Upgrade initial GET request to a websocket
@@ -57,7 +61,8 @@ func webSocketHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	m := manager.GetRoomManager(id)
-	m.initClient(conn, userName)
+	c := &client{conn: conn, roomAccess: access}
+	m.initClient(conn, c.identity)
 	defer conn.Close()
 	defer m.removeMember(conn)
 	for {
@@ -72,58 +77,144 @@ func webSocketHandler(w http.ResponseWriter, r *http.Request) {
 			log.Println("Read error:", err)
 			break
 		}
-		var inputOperation internal.Operation
-		err = json.Unmarshal(message, &inputOperation)
-		if err != nil {
-			conn.WriteJSON(map[string]string{"error": "Invalid operation format", "input": string(message), "error_details": err.Error()})
-			continue
+		// Plain operations have no type, so an empty type means "operation"
+		var envelope struct {
+			Type string `json:"type"`
 		}
-		err = inputOperation.Validate()
-		if err != nil {
-			conn.WriteJSON(map[string]string{"error": "Operation validation failed", "details": err.Error()})
+		if err := json.Unmarshal(message, &envelope); err != nil {
+			conn.WriteJSON(map[string]string{"error": "Invalid message format", "input": string(message), "error_details": err.Error()})
 			continue
 		}
-		log.Printf("Received: %v", inputOperation)
-		// Now you perform the operation using OT logic
-		// TODO:
+		switch envelope.Type {
+		case "", "operation":
+			m.handleOperation(c, message)
+		case "suggest":
+			m.handleSuggest(c, message)
+		case "undo", "redo":
+			m.handleUndo(c, envelope.Type == "redo")
+		case "batch":
+			m.handleBatch(c, message)
+		case "accept_suggestion", "reject_suggestion":
+			m.handleSuggestionDecision(c, envelope.Type == "accept_suggestion", message)
+		default:
+			conn.WriteJSON(map[string]string{"error": "Unknown message type", "type": envelope.Type})
+		}
+	}
+}
 
-		outputOperation := m.Apply(inputOperation)
+// handleOperation applies an edit from the client and streams it to the room
+func (ws *wsManager) handleOperation(c *client, message []byte) {
+	if !c.canEdit() {
+		c.conn.WriteJSON(map[string]string{"error": "Operation rejected", "details": "you do not have permission to edit"})
+		return
+	}
+	var inputOperation internal.Operation
+	err := json.Unmarshal(message, &inputOperation)
+	if err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Invalid operation format", "input": string(message), "error_details": err.Error()})
+		return
+	}
+	err = inputOperation.Validate()
+	if err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Operation validation failed", "details": err.Error()})
+		return
+	}
+	inputOperation.Author = c.identity
+	log.Printf("Received: %v", inputOperation)
 
-		// write this out to the postgress database
-		ts := time.Now()
-		w, err := internal.NewWriteStore()
-		if err != nil {
-			conn.WriteJSON(map[string]string{"error": "Failed to initialize storage", "details": err.Error()})
-			continue
-		}
-		err = w.WriteOperation(id, inputOperation, ts)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	outputOperations, err := ws.applyAction(c.identity, inputOperation.Version, []internal.Operation{inputOperation})
+	if err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Operation rejected", "details": err.Error()})
+		return
+	}
+	ws.commit(outputOperations)
+}
 
-		if err != nil {
-			conn.WriteJSON(map[string]string{"error": "Failed to write operation", "details": err.Error()})
-			continue
-		}
-		// process the input and stream it to everyone
-		output := map[string]interface{}{
-			"type":      "operation",
-			"ts":        ts.Format(time.RFC3339),
-			"operation": outputOperation,
+// roomPermission works out who the request is and what it may do in the room.
+// Requests with ?token=<share link token> get the link's permission. Otherwise
+// they need a DraftlyManager session, sent as an Authorization: Bearer header
+// or, since browsers cannot set headers on websockets, as ?access_token=, and
+// get the session user's permission on the document. On failure it returns the
+// HTTP status to reply with.
+func roomPermission(r *http.Request, roomID string) (roomAccess, int, error) {
+	// Rooms are document IDs; anything else never reaches the CRUD service
+	if _, err := strconv.Atoi(roomID); err != nil {
+		return roomAccess{}, http.StatusNotFound, internal.ErrDocumentNotFound
+	}
+	if token := r.URL.Query().Get("token"); token != "" {
+		return shareLinkAccess(token, roomID)
+	}
+
+	session, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if session == "" {
+		session = r.URL.Query().Get("access_token")
+	}
+	if session == "" {
+		return roomAccess{}, http.StatusUnauthorized, errors.New("Authentication required: send a session token or a share link token")
+	}
+	access, err := internal.ResolveDocumentAccess(session, roomID)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrSessionInvalid):
+			return roomAccess{}, http.StatusUnauthorized, err
+		case errors.Is(err, internal.ErrDocumentNotFound):
+			return roomAccess{}, http.StatusNotFound, err
 		}
-		fmt.Printf("broadcasting: %v to all connected clients in room %s\n", output, m.roomID)
-		m.broadcast(output, conn) // broadcast to other members
+		log.Println("Session check error:", err)
+		return roomAccess{}, http.StatusBadGateway, err
+	}
+	// Owners edit like editors; everyone else keeps their level
+	permission := access.Permission
+	if permission == permissionOwner {
+		permission = permissionEdit
+	}
+	return roomAccess{
+		userID:     access.UserID,
+		identity:   "user:" + strconv.Itoa(access.UserID),
+		permission: permission,
+	}, http.StatusOK, nil
+}
 
+// shareLinkAccess resolves a share link token for the room. Link holders are
+// anonymous, so everyone using the same link shares one identity.
+func shareLinkAccess(token, roomID string) (roomAccess, int, error) {
+	link, err := internal.ResolveShareLink(token)
+	if err != nil {
+		switch {
+		case errors.Is(err, internal.ErrShareLinkNotFound):
+			return roomAccess{}, http.StatusNotFound, err
+		case errors.Is(err, internal.ErrShareLinkExpired):
+			return roomAccess{}, http.StatusGone, err
+		}
+		log.Println("Share link error:", err)
+		return roomAccess{}, http.StatusBadGateway, err
+	}
+	if strconv.Itoa(link.DocumentID) != roomID {
+		return roomAccess{}, http.StatusForbidden, errors.New("Share link is for a different document")
 	}
+	sum := sha256.Sum256([]byte(token))
+	return roomAccess{
+		identity:   "link:" + hex.EncodeToString(sum[:8]),
+		permission: link.Permission,
+	}, http.StatusOK, nil
 }
+
 func routes() *mux.Router {
 	r := mux.NewRouter()
 	r.HandleFunc("/health", HealthCheckHandler)
-	// ?username=richard
+	// ?access_token=<session token>, or ?token=<share link token>
 	r.HandleFunc("/ws/{roomID}", webSocketHandler)
+	// REST fallback for clients that cannot hold a websocket open
+	r.HandleFunc("/rooms/{roomID}/batch", batchHandler).Methods("POST")
 	return r
 }
 
 func main() {
 	fmt.Printf("server running on port :%s\n", cfg.WSPort)
 	go manager.roomCount()
+	go internal.ListenCommentEvents(manager.deliverCommentEvent)
 	if err := http.ListenAndServe(":"+cfg.WSPort, routes()); err != nil {
 		log.Fatal("ListenAndServe: ", err)
 	}
@@ -139,51 +230,110 @@ type wsManager struct {
 	// use roomMembers to keep track of active connections in each room
 	lastUpdate   map[string]time.Time // conn/IP -> last update time
 	connUsername map[*websocket.Conn]string
-	// Operation transform Management
-	Ops     []internal.Operation
-	Version int32
+	// Operation transform Management. mu guards Ops, Version, suggestions and the
+	// undo stacks and is held while broadcasting room events so they go out in order.
+	mu          sync.Mutex
+	Ops         []internal.Operation
+	Version     int32
+	suggestions []*suggestion
+	nextID      int
+	// Per-identity undo and redo stacks of actions in Ops
+	undo map[string][]opRange
+	redo map[string][]opRange
 }
 
-func (ws *wsManager) Apply(op internal.Operation) internal.Operation {
-	for i := op.Version; i < ws.Version; i++ {
-		newer := ws.Ops[i]
+// Connection permissions, matching the CRUD service's permission levels
+const (
+	permissionOwner   = "owner"
+	permissionEdit    = "edit"
+	permissionComment = "comment"
+)
 
-		switch op.Kind {
-		case "insert":
-			if newer.Kind == "insert" && newer.Position < op.Position {
-				op.Position += utf8.RuneCountInString(newer.Text)
-			}
-			if newer.Kind == "delete" && newer.Position < op.Position {
-				op.Position -= utf8.RuneCountInString(newer.Text)
-				if op.Position < newer.Position {
-					op.Position = newer.Position
-				}
-			}
+// roomAccess is who a connection authenticated as and what it may do in the room
+type roomAccess struct {
+	userID     int    // session user, or 0 for share link holders
+	identity   string // "user:<id>" or "link:<token hash>", for attribution and per-user state
+	permission string
+}
 
-		case "delete":
-			if newer.Kind == "insert" && newer.Position < op.Position {
-				op.Position += utf8.RuneCountInString(newer.Text)
-			}
-			if newer.Kind == "delete" && newer.Position < op.Position {
-				op.Position -= utf8.RuneCountInString(newer.Text)
-				if op.Position < newer.Position {
-					op.Position = newer.Position
-				}
-			}
+// client is one websocket connection and what it may do in the room
+type client struct {
+	conn *websocket.Conn
+	roomAccess
+}
+
+// canEdit reports whether the client may change the text directly
+func (c *client) canEdit() bool {
+	return c.permission == permissionEdit
+}
+
+// canSuggest reports whether the client may propose changes
+func (c *client) canSuggest() bool {
+	return c.permission == permissionEdit || c.permission == permissionComment
+}
+
+// apply rebases a sequence of operations made at version base onto everything
+// the room has applied since, then appends them. Operations can split or vanish
+// in the transform. Pending suggestions are rebased past the result. The caller
+// must hold ws.mu.
+func (ws *wsManager) apply(base int32, ops []internal.Operation) ([]internal.Operation, error) {
+	if base > ws.Version {
+		return nil, fmt.Errorf("version %d is ahead of the room's version %d", base, ws.Version)
+	}
+
+	// Each op comes after the previous one in the sequence, so the history it is
+	// rebased against is the history rebased past its predecessors
+	against := internal.ToOT(ws.Ops[base:])
+	var applied []internal.Operation
+	for _, op := range ops {
+		var rebased []ot.Op
+		rebased, against = ot.Transform([]ot.Op{op.OT()}, against, true)
+		for _, out := range internal.FromOT(rebased, op) {
+			ws.Version++
+			out.Version = ws.Version
+			ws.Ops = append(ws.Ops, out)
+			applied = append(applied, out)
 		}
 	}
 
-	atomic.AddInt32(&ws.Version, 1)
-	op.Version = ws.Version
-	ws.Ops = append(ws.Ops, op)
-	return op
+	ws.rebaseSuggestions(applied)
+	return applied, nil
 }
 
-func (ws *wsManager) initClient(conn *websocket.Conn, userName string) {
-	since, ok := ws.lastUpdate[userName]
+// commit stores applied operations and streams them to the room. The caller
+// must hold ws.mu so every client sees operations in version order.
+func (ws *wsManager) commit(ops []internal.Operation) {
+	w, err := internal.NewWriteStore()
+	if err != nil {
+		log.Println("Error initializing storage:", err)
+	}
+	for _, op := range ops {
+		// write this out to the postgress database
+		ts := time.Now()
+		if w != nil {
+			if err := w.WriteOperation(ws.roomID, op, ts); err != nil {
+				log.Println("Failed to write operation:", err)
+			}
+		}
+		if err := internal.TransformCommentAnchors(ws.roomID, op); err != nil {
+			log.Println("Failed to transform comment anchors:", err)
+		}
+		// process the input and stream it to everyone
+		output := map[string]interface{}{
+			"type":      "operation",
+			"ts":        ts.Format(time.RFC3339),
+			"operation": op,
+		}
+		fmt.Printf("broadcasting: %v to all connected clients in room %s\n", output, ws.roomID)
+		ws.broadcast(output, nil)
+	}
+}
+
+func (ws *wsManager) initClient(conn *websocket.Conn, identity string) {
+	since, ok := ws.lastUpdate[identity]
 	if !ok {
 		// First time joining - use Unix epoch to get all operations
-		fmt.Printf("No previous timestamp for user %s, sending full history\n", userName)
+		fmt.Printf("No previous timestamp for %s, sending full history\n", identity)
 		since = time.Unix(0, 0)
 	}
 
@@ -198,18 +348,22 @@ func (ws *wsManager) initClient(conn *websocket.Conn, userName string) {
 		log.Println("Error fetching operations since last update:", err)
 		return
 	}
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
 	response := map[string]interface{}{
-		"type":       "history",
-		"operations": ops,
-		"since":      since.Format(time.RFC3339),
+		"type":            "history",
+		"operations":      ops,
+		"since":           since.Format(time.RFC3339),
+		"current_version": ws.Version,
+		"suggestions":     ws.pendingSuggestions(),
 	}
 	conn.WriteJSON(response)
-	ws.addMember(conn, userName)
+	ws.addMember(conn, identity)
 }
 
-func (ws *wsManager) addMember(conn *websocket.Conn, userName string) {
+func (ws *wsManager) addMember(conn *websocket.Conn, identity string) {
 	ws.roomMembers.Store(conn, true)
-	ws.lastUpdate[userName] = time.Now()
+	ws.lastUpdate[identity] = time.Now()
 }
 
 func (ws *wsManager) removeMember(conn *websocket.Conn) {
@@ -262,11 +416,25 @@ func (m *Managers) GetRoomManager(roomID string) *wsManager {
 		roomMembers:  sync.Map{},
 		lastUpdate:   make(map[string]time.Time),
 		connUsername: make(map[*websocket.Conn]string),
+		undo:         make(map[string][]opRange),
+		redo:         make(map[string][]opRange),
 	}
 	m.roomMembers.Store(roomID, rm)
 	return rm
 }
 
+// deliverCommentEvent broadcasts a comment event to the document's room, if anyone is in it
+func (m *Managers) deliverCommentEvent(documentID int, event json.RawMessage) {
+	v, ok := m.roomMembers.Load(strconv.Itoa(documentID))
+	if !ok {
+		return
+	}
+	ws := v.(*wsManager)
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.broadcast(event, nil)
+}
+
 func (m *Managers) roomCount() {
 	for {
 		m.roomMembers.Range(func(k, v interface{}) bool {
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"Draftly/WS/internal"
+	"Draftly/WS/internal/ot"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// suggestion is a proposed change that has not been applied to the text. Its
+// operations are kept rebased onto the room's current version.
+type suggestion struct {
+	ID         int                  `json:"id"`
+	Author     string               `json:"author"` // identity of the client that proposed it
+	Operations []internal.Operation `json:"operations"`
+	Version    int32                `json:"version"` // room version the positions refer to
+	CreatedAt  time.Time            `json:"created_at"`
+}
+
+// handleSuggest records a proposed change from an editor or commenter.
+//
+//	{"type": "suggest", "version": 3, "operations": [{"kind": "insert", ...}]}
+func (ws *wsManager) handleSuggest(c *client, message []byte) {
+	if !c.canSuggest() {
+		c.conn.WriteJSON(map[string]string{"error": "Suggestion rejected", "details": "you do not have permission to suggest changes"})
+		return
+	}
+	var input struct {
+		Version    int32                `json:"version"`
+		Operations []internal.Operation `json:"operations"`
+	}
+	if err := json.Unmarshal(message, &input); err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Invalid suggestion format", "input": string(message), "error_details": err.Error()})
+		return
+	}
+	if len(input.Operations) == 0 {
+		c.conn.WriteJSON(map[string]string{"error": "Suggestion validation failed", "details": "operations cannot be empty"})
+		return
+	}
+	for _, op := range input.Operations {
+		if err := op.Validate(); err != nil {
+			c.conn.WriteJSON(map[string]string{"error": "Suggestion validation failed", "details": err.Error()})
+			return
+		}
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if input.Version < 0 || input.Version > ws.Version {
+		c.conn.WriteJSON(map[string]string{"error": "Suggestion rejected",
+			"details": fmt.Sprintf("version %d is ahead of the room's version %d", input.Version, ws.Version)})
+		return
+	}
+
+	// Suggestions lose ties against real edits, like any later operation
+	rebased, _ := ot.Transform(internal.ToOT(input.Operations), internal.ToOT(ws.Ops[input.Version:]), false)
+	if len(rebased) == 0 {
+		c.conn.WriteJSON(map[string]string{"error": "Suggestion rejected", "details": "the suggested text has already been changed"})
+		return
+	}
+
+	ws.nextID++
+	s := &suggestion{
+		ID:         ws.nextID,
+		Author:     c.identity,
+		Operations: internal.FromOT(rebased, internal.Operation{Author: c.identity}),
+		Version:    ws.Version,
+		CreatedAt:  time.Now(),
+	}
+	ws.suggestions = append(ws.suggestions, s)
+	ws.broadcast(map[string]interface{}{
+		"type":       "suggestion.created",
+		"suggestion": s,
+	}, nil)
+}
+
+// handleSuggestionDecision accepts or rejects a pending suggestion. Editors can
+// do either; authors can withdraw their own, matched by authenticated identity.
+//
+//	{"type": "accept_suggestion", "id": 7}
+func (ws *wsManager) handleSuggestionDecision(c *client, accept bool, message []byte) {
+	var input struct {
+		ID int `json:"id"`
+	}
+	if err := json.Unmarshal(message, &input); err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Invalid suggestion format", "input": string(message), "error_details": err.Error()})
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	index := -1
+	for i, s := range ws.suggestions {
+		if s.ID == input.ID {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		c.conn.WriteJSON(map[string]interface{}{"error": "Suggestion not found", "id": input.ID})
+		return
+	}
+	s := ws.suggestions[index]
+	if !c.canEdit() && (accept || s.Author != c.identity) {
+		c.conn.WriteJSON(map[string]string{"error": "Suggestion rejected", "details": "only editors can accept or reject suggestions"})
+		return
+	}
+	ws.suggestions = append(ws.suggestions[:index], ws.suggestions[index+1:]...)
+
+	if !accept {
+		ws.broadcast(map[string]interface{}{
+			"type": "suggestion.rejected",
+			"id":   s.ID,
+			"by":   c.identity,
+		}, nil)
+		return
+	}
+
+	// The operations already refer to the current version; accepting makes the
+	// editor who accepted them their author for undo
+	ops := make([]internal.Operation, len(s.Operations))
+	for i, op := range s.Operations {
+		op.Author = c.identity
+		ops[i] = op
+	}
+	applied, err := ws.applyAction(c.identity, ws.Version, ops)
+	if err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Failed to accept suggestion", "details": err.Error()})
+		return
+	}
+	ws.broadcast(map[string]interface{}{
+		"type":         "suggestion.accepted",
+		"id":           s.ID,
+		"by":           c.identity,
+		"suggested_by": s.Author,
+	}, nil)
+	ws.commit(applied)
+}
+
+// rebaseSuggestions moves pending suggestions past newly applied operations.
+// Suggestions whose text is gone are dropped. The caller must hold ws.mu.
+func (ws *wsManager) rebaseSuggestions(applied []internal.Operation) {
+	if len(applied) == 0 {
+		return
+	}
+	pending := ws.suggestions[:0]
+	for _, s := range ws.suggestions {
+		rebased, _ := ot.Transform(internal.ToOT(s.Operations), internal.ToOT(applied), false)
+		if len(rebased) == 0 {
+			ws.broadcast(map[string]interface{}{
+				"type":   "suggestion.rejected",
+				"id":     s.ID,
+				"reason": "obsolete",
+			}, nil)
+			continue
+		}
+		s.Operations = internal.FromOT(rebased, internal.Operation{Author: s.Author})
+		s.Version = ws.Version
+		pending = append(pending, s)
+	}
+	ws.suggestions = pending
+}
+
+// pendingSuggestions returns a snapshot of the room's suggestions for new
+// clients. The caller must hold ws.mu.
+func (ws *wsManager) pendingSuggestions() []suggestion {
+	out := make([]suggestion, len(ws.suggestions))
+	for i, s := range ws.suggestions {
+		out[i] = *s
+	}
+	return out
+}
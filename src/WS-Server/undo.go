@@ -0,0 +1,91 @@
+package main
+
+import (
+	"Draftly/WS/internal"
+	"Draftly/WS/internal/ot"
+)
+
+// maxUndoDepth caps how many actions each user can undo in a room. Stacks are
+// keyed on the client's authenticated identity.
+const maxUndoDepth = 100
+
+// opRange is the operations one action appended to the room, as ws.Ops[from:to].
+// An action is applied under ws.mu, so its operations are contiguous.
+type opRange struct {
+	from, to int
+}
+
+// applyAction applies a user's edit and makes it the next thing they can undo.
+// Any redo history the user had is discarded. The caller must hold ws.mu.
+func (ws *wsManager) applyAction(identity string, base int32, ops []internal.Operation) ([]internal.Operation, error) {
+	from := len(ws.Ops)
+	applied, err := ws.apply(base, ops)
+	if err != nil {
+		return nil, err
+	}
+	ws.pushAction(ws.undo, identity, opRange{from, len(ws.Ops)})
+	delete(ws.redo, identity)
+	return applied, nil
+}
+
+// pushAction records an action on an identity's stack, dropping the oldest past maxUndoDepth
+func (ws *wsManager) pushAction(stacks map[string][]opRange, identity string, r opRange) {
+	if r.from == r.to {
+		return
+	}
+	stack := append(stacks[identity], r)
+	if len(stack) > maxUndoDepth {
+		stack = stack[len(stack)-maxUndoDepth:]
+	}
+	stacks[identity] = stack
+}
+
+// handleUndo reverts the user's most recent action (or re-applies their most
+// recently undone one). Only the user's own operations are reverted; they are
+// transformed past everything applied since, so other users' edits survive.
+//
+//	{"type": "undo"}  {"type": "redo"}
+func (ws *wsManager) handleUndo(c *client, redo bool) {
+	name := "undo"
+	from, to := ws.undo, ws.redo
+	if redo {
+		name = "redo"
+		from, to = ws.redo, ws.undo
+	}
+	if !c.canEdit() {
+		c.conn.WriteJSON(map[string]string{"error": "Operation rejected", "details": "you do not have permission to edit"})
+		return
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	stack := from[c.identity]
+	if len(stack) == 0 {
+		c.conn.WriteJSON(map[string]string{"error": "Nothing to " + name})
+		return
+	}
+	r := stack[len(stack)-1]
+	from[c.identity] = stack[:len(stack)-1]
+
+	inverse := ot.Undo(internal.ToOT(ws.Ops[r.from:r.to]), internal.ToOT(ws.Ops[r.to:]))
+	if len(inverse) == 0 {
+		// Everything the action did has since been overwritten by others
+		c.conn.WriteJSON(map[string]string{"error": "Nothing to " + name, "details": "the change has already been reverted by other edits"})
+		return
+	}
+
+	start := len(ws.Ops)
+	applied, err := ws.apply(ws.Version, internal.FromOT(inverse, internal.Operation{Author: c.identity}))
+	if err != nil {
+		c.conn.WriteJSON(map[string]string{"error": "Failed to " + name, "details": err.Error()})
+		return
+	}
+	ws.pushAction(to, c.identity, opRange{start, len(ws.Ops)})
+
+	c.conn.WriteJSON(map[string]interface{}{
+		"type":       name + ".applied",
+		"operations": applied,
+		"version":    ws.Version,
+	})
+	ws.commit(applied)
+}